@@ -0,0 +1,127 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+// Package appsec provides application security features in the form of SDK
+// functions that can be manually called to monitor specific code paths and
+// data, such as the authenticated user or its login attempts. Application
+// Security is currently transparently integrated into the APM tracer and
+// cannot be used nor started alone at the moment.
+// The functions of this package expect a context holding the span of the
+// request, such as the request context of instrumented HTTP handlers.
+package appsec // import "gopkg.in/DataDog/dd-trace-go.v1/appsec"
+
+import (
+	"context"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/httpsec"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/sharedsec"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+)
+
+// ErrBlocked is the error returned by SetUser, TrackUserLoginSuccessEvent and
+// MonitorParsedBody when the request was blocked by the security policy. The
+// caller must stop processing the request and return as soon as possible, the
+// instrumented handler taking care of writing the blocking response.
+var ErrBlocked = sharedsec.ErrBlocked
+
+// SetUser associates the given authenticated user ID, along with the user
+// information set by the options, to the trace of the request found in the
+// given context, and keeps the trace. The user ID is also monitored by AppSec
+// which can block it, in which case ErrBlocked is returned.
+func SetUser(ctx context.Context, id string, opts ...tracer.UserMonitoringOption) error {
+	span := getRootSpan(ctx)
+	if span == nil {
+		return nil
+	}
+	tracer.SetUser(span, id, opts...)
+	span.SetTag(ext.SamplingPriority, ext.PriorityUserKeep)
+	return sharedsec.MonitorUser(ctx, id)
+}
+
+// TrackUserLoginSuccessEvent sets a successful user login event, with the
+// given user ID and optional metadata, into the trace of the request found in
+// the given context. The user is also set with SetUser, whose error is
+// returned.
+func TrackUserLoginSuccessEvent(ctx context.Context, uid string, md map[string]string, opts ...tracer.UserMonitoringOption) error {
+	TrackCustomEvent(ctx, "users.login.success", md)
+	return SetUser(ctx, uid, opts...)
+}
+
+// TrackUserLoginFailureEvent sets a failed user login event, with the given
+// user ID and optional metadata, into the trace of the request found in the
+// given context. The exists argument tells if the user exists in the
+// application.
+func TrackUserLoginFailureEvent(ctx context.Context, uid string, exists bool, md map[string]string) {
+	span := getRootSpan(ctx)
+	if span == nil {
+		return
+	}
+	const tagPrefix = "appsec.events.users.login.failure."
+	trackEvent(span, tagPrefix, md)
+	span.SetTag(tagPrefix+"usr.id", uid)
+	span.SetTag(tagPrefix+"usr.exists", exists)
+}
+
+// TrackCustomEvent sets a custom event, with the given name and optional
+// metadata, into the trace of the request found in the given context.
+func TrackCustomEvent(ctx context.Context, name string, md map[string]string) {
+	span := getRootSpan(ctx)
+	if span == nil {
+		return
+	}
+	trackEvent(span, "appsec.events."+name+".", md)
+}
+
+// trackEvent sets the event tags with the given prefix and keeps the trace.
+func trackEvent(span ddtrace.Span, tagPrefix string, md map[string]string) {
+	span.SetTag(tagPrefix+"track", true)
+	for k, v := range md {
+		span.SetTag(tagPrefix+k, v)
+	}
+	span.SetTag(ext.SamplingPriority, ext.PriorityUserKeep)
+}
+
+// getRootSpan returns the local root span of the span found in the given
+// context, or nil when there is none.
+func getRootSpan(ctx context.Context) ddtrace.Span {
+	span, ok := tracer.SpanFromContext(ctx)
+	if !ok {
+		log.Error("appsec: could not find the span in the context: make sure to use the request context of an instrumented handler")
+		return nil
+	}
+	if r, ok := span.(interface{ Root() ddtrace.Span }); ok {
+		return r.Root()
+	}
+	return span
+}
+
+// MonitorParsedBody monitors the given parsed HTTP request body of the
+// request found in the given context, such as the value a JSON or form body
+// was decoded into. The value is encoded within the limits of depth, length
+// and size of the WAF. ErrBlocked is returned when the request got blocked.
+func MonitorParsedBody(ctx context.Context, body interface{}) error {
+	return httpsec.MonitorParsedBody(ctx, body)
+}
+
+// UpdateRules replaces the security rules used by AppSec with the given JSON
+// rules, without restarting it. The requests being monitored finish with the
+// previous rules. An error is returned when AppSec is not running or when the
+// given rules are invalid, in which case the previous rules are kept. When the
+// rules are loaded from the file set by DD_APPSEC_RULES, changes of that file
+// are also automatically reloaded.
+func UpdateRules(rules []byte) error {
+	return appsec.UpdateRules(rules)
+}
+
+// DisableRules disables the security rules of the given IDs, replacing the set
+// of rules previously disabled by DD_APPSEC_RULES_DISABLED or this function.
+// Calling it with no IDs enables every rule back.
+func DisableRules(ids ...string) error {
+	return appsec.DisableRules(ids)
+}
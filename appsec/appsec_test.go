@@ -0,0 +1,99 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package appsec
+
+import (
+	"context"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetUser(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "http.request")
+	require.NoError(t, SetUser(ctx, "user-id", tracer.WithUserEmail("email")))
+	span.Finish()
+
+	finished := mt.FinishedSpans()
+	require.Len(t, finished, 1)
+	tags := finished[0].Tags()
+	require.Equal(t, "user-id", tags[ext.UserID])
+	require.Equal(t, "email", tags[ext.UserEmail])
+	require.Equal(t, ext.PriorityUserKeep, tags[ext.SamplingPriority])
+}
+
+func TestTrackUserLoginSuccessEvent(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "http.request")
+	err := TrackUserLoginSuccessEvent(ctx, "user-id", map[string]string{"region": "us"}, tracer.WithUserName("name"))
+	require.NoError(t, err)
+	span.Finish()
+
+	finished := mt.FinishedSpans()
+	require.Len(t, finished, 1)
+	tags := finished[0].Tags()
+	require.Equal(t, true, tags["appsec.events.users.login.success.track"])
+	require.Equal(t, "us", tags["appsec.events.users.login.success.region"])
+	require.Equal(t, "user-id", tags[ext.UserID])
+	require.Equal(t, "name", tags[ext.UserName])
+	require.Equal(t, ext.PriorityUserKeep, tags[ext.SamplingPriority])
+}
+
+func TestTrackUserLoginFailureEvent(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "http.request")
+	TrackUserLoginFailureEvent(ctx, "user-id", false, map[string]string{"reason": "bad password"})
+	span.Finish()
+
+	finished := mt.FinishedSpans()
+	require.Len(t, finished, 1)
+	tags := finished[0].Tags()
+	require.Equal(t, true, tags["appsec.events.users.login.failure.track"])
+	require.Equal(t, "bad password", tags["appsec.events.users.login.failure.reason"])
+	require.Equal(t, "user-id", tags["appsec.events.users.login.failure.usr.id"])
+	require.Equal(t, false, tags["appsec.events.users.login.failure.usr.exists"])
+	require.Nil(t, tags[ext.UserID])
+	require.Equal(t, ext.PriorityUserKeep, tags[ext.SamplingPriority])
+}
+
+func TestTrackCustomEvent(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	span, ctx := tracer.StartSpanFromContext(context.Background(), "http.request")
+	TrackCustomEvent(ctx, "password.reset", map[string]string{"key": "value"})
+	span.Finish()
+
+	finished := mt.FinishedSpans()
+	require.Len(t, finished, 1)
+	tags := finished[0].Tags()
+	require.Equal(t, true, tags["appsec.events.password.reset.track"])
+	require.Equal(t, "value", tags["appsec.events.password.reset.key"])
+	require.Equal(t, ext.PriorityUserKeep, tags[ext.SamplingPriority])
+}
+
+func TestNoSpan(t *testing.T) {
+	require.NoError(t, SetUser(context.Background(), "user-id"))
+	require.NoError(t, TrackUserLoginSuccessEvent(context.Background(), "user-id", nil))
+	TrackUserLoginFailureEvent(context.Background(), "user-id", true, nil)
+	TrackCustomEvent(context.Background(), "event", nil)
+}
+
+func TestUpdateRulesNotRunning(t *testing.T) {
+	require.Error(t, UpdateRules([]byte(`{}`)))
+	require.Error(t, DisableRules("crs-942-100"))
+}
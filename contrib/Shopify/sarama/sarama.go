@@ -7,6 +7,7 @@
 package sarama // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/Shopify/sarama"
 
 import (
+	"context"
 	"math"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
@@ -65,6 +66,7 @@ func WrapPartitionConsumer(pc sarama.PartitionConsumer, opts ...Option) sarama.P
 			next := tracer.StartSpan("kafka.consume", opts...)
 			// reinject the span context so consumers can pick it up
 			tracer.Inject(next.Context(), carrier)
+			setConsumeCheckpoint(msg)
 
 			wrapped.messages <- msg
 
@@ -270,10 +272,33 @@ func startProducerSpan(cfg *config, version sarama.KafkaVersion, msg *sarama.Pro
 	if version.IsAtLeast(sarama.V0_11_0_0) {
 		// re-inject the span context so consumers can pick it up
 		tracer.Inject(span.Context(), carrier)
+		setProduceCheckpoint(msg)
 	}
 	return span
 }
 
+// setProduceCheckpoint sets a Data Streams produce checkpoint continuing the
+// pathway found in the message headers, if any, and propagates the resulting
+// pathway in the headers.
+func setProduceCheckpoint(msg *sarama.ProducerMessage) {
+	carrier := NewProducerMessageCarrier(msg)
+	ctx := tracer.ExtractDataStreamsPathway(context.Background(), carrier)
+	if ctx, ok := tracer.SetDataStreamsCheckpoint(ctx, "direction:out", "topic:"+msg.Topic, "type:kafka"); ok {
+		tracer.InjectDataStreamsPathway(ctx, carrier)
+	}
+}
+
+// setConsumeCheckpoint sets a Data Streams consume checkpoint continuing the
+// pathway propagated in the message headers, and re-injects the resulting
+// pathway so that it can be continued by the consumer.
+func setConsumeCheckpoint(msg *sarama.ConsumerMessage) {
+	carrier := NewConsumerMessageCarrier(msg)
+	ctx := tracer.ExtractDataStreamsPathway(context.Background(), carrier)
+	if ctx, ok := tracer.SetDataStreamsCheckpoint(ctx, "direction:in", "topic:"+msg.Topic, "type:kafka"); ok {
+		tracer.InjectDataStreamsPathway(ctx, carrier)
+	}
+}
+
 func finishProducerSpan(span ddtrace.Span, partition int32, offset int64, err error) {
 	span.SetTag("partition", partition)
 	span.SetTag("offset", offset)
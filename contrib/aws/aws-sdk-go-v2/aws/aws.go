@@ -11,22 +11,25 @@ import (
 	"math"
 	"time"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/aws/internal/servicetags"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/smithy-go/middleware"
 	smithyhttp "github.com/aws/smithy-go/transport/http"
 )
 
 const (
-	tagAWSAgent     = "aws.agent"
-	tagAWSService   = "aws.service"
-	tagAWSOperation = "aws.operation"
-	tagAWSRegion    = "aws.region"
-	tagAWSRequestID = "aws.request_id"
+	tagAWSAgent      = "aws.agent"
+	tagAWSService    = "aws.service"
+	tagAWSOperation  = "aws.operation"
+	tagAWSRegion     = "aws.region"
+	tagAWSRequestID  = "aws.request_id"
+	tagAWSRetryCount = "aws.retry_count"
 )
 
 type spanTimestampKey struct{}
@@ -82,10 +85,20 @@ func (mw *traceMiddleware) startTraceMiddleware(stack *middleware.Stack) error {
 		if !math.IsNaN(mw.cfg.analyticsRate) {
 			opts = append(opts, tracer.Tag(ext.EventSampleRate, mw.cfg.analyticsRate))
 		}
+		for k, v := range servicetags.Extract(serviceID, operation, in.Parameters) {
+			opts = append(opts, tracer.Tag(k, v))
+		}
+		for k, fn := range mw.cfg.tagFns {
+			opts = append(opts, tracer.Tag(k, fn(ctx, in)))
+		}
 		span, spanctx := tracer.StartSpanFromContext(ctx, fmt.Sprintf("%s.request", serviceID), opts...)
+		injectMessageAttributes(span, in.Parameters)
 
 		// Handle initialize and continue through the middleware chain.
 		out, metadata, err = next.HandleInitialize(spanctx, in)
+		if res, ok := retry.GetAttemptResults(metadata); ok && len(res.Results) > 0 {
+			span.SetTag(tagAWSRetryCount, len(res.Results)-1)
+		}
 		span.Finish(tracer.WithError(err))
 
 		return out, metadata, err
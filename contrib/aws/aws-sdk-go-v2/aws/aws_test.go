@@ -10,13 +10,17 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/smithy-go/middleware"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAppendMiddleware(t *testing.T) {
@@ -197,3 +201,55 @@ func TestAppendMiddleware_WithOpts(t *testing.T) {
 		})
 	}
 }
+
+func TestServiceTags(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	awsCfg := newMessagingConfig(t, WithCustomTag("custom.body", func(ctx context.Context, in middleware.InitializeInput) interface{} {
+		return *in.Parameters.(*sqs.SendMessageInput).MessageBody
+	}))
+	sqs.NewFromConfig(awsCfg).SendMessage(context.Background(), &sqs.SendMessageInput{
+		QueueUrl:    aws.String("https://sqs.eu-west-1.amazonaws.com/123456789012/queue"),
+		MessageBody: aws.String("body"),
+	})
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 1)
+	s := spans[0]
+	assert.Equal(t, "queue", s.Tag("queuename"))
+	assert.Equal(t, "body", s.Tag("custom.body"))
+	assert.Equal(t, 0, s.Tag(tagAWSRetryCount))
+}
+
+func TestRetryCount(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	server := mockAWS(500)
+	defer server.Close()
+	resolver := aws.EndpointResolverFunc(func(service, region string) (aws.Endpoint, error) {
+		return aws.Endpoint{
+			PartitionID:   "aws",
+			URL:           server.URL,
+			SigningRegion: "eu-west-1",
+		}, nil
+	})
+	awsCfg := aws.Config{
+		Region:           "eu-west-1",
+		Credentials:      aws.AnonymousCredentials{},
+		EndpointResolver: resolver,
+		Retryer: func() aws.Retryer {
+			return retry.NewStandard(func(o *retry.StandardOptions) {
+				o.MaxAttempts = 3
+				o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+			})
+		},
+	}
+	AppendMiddleware(&awsCfg)
+	sqs.NewFromConfig(awsCfg).ListQueues(context.Background(), &sqs.ListQueuesInput{})
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, 2, spans[0].Tag(tagAWSRetryCount))
+}
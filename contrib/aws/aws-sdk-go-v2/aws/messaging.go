@@ -0,0 +1,104 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package aws
+
+import (
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/aws/internal/messaging"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// ExtractSQSMessage returns the span context propagated with msg, as injected by a
+// traced SendMessage or SendMessageBatch call. Messages delivered to the queue by an
+// SNS subscription without raw message delivery are also supported, in which case the
+// span context is looked up within the SNS notification found in the message body.
+func ExtractSQSMessage(msg sqstypes.Message) (ddtrace.SpanContext, error) {
+	if attr, ok := msg.MessageAttributes[messaging.AttributeKey]; ok {
+		if attr.StringValue != nil {
+			return messaging.Extract([]byte(*attr.StringValue))
+		}
+		return messaging.Extract(attr.BinaryValue)
+	}
+	return messaging.ExtractNotification(aws.ToString(msg.Body))
+}
+
+// injectMessageAttributes injects the context of span into the message attributes
+// of the SQS and SNS operations sending messages, and makes sure that receiving
+// SQS operations ask for the attribute holding it.
+func injectMessageAttributes(span ddtrace.Span, params interface{}) {
+	switch in := params.(type) {
+	case *sqs.SendMessageInput:
+		in.MessageAttributes = injectSQS(span, in.MessageAttributes)
+	case *sqs.SendMessageBatchInput:
+		for i := range in.Entries {
+			in.Entries[i].MessageAttributes = injectSQS(span, in.Entries[i].MessageAttributes)
+		}
+	case *sqs.ReceiveMessageInput:
+		for _, name := range in.MessageAttributeNames {
+			if messaging.Requested(name) {
+				return
+			}
+		}
+		in.MessageAttributeNames = append(in.MessageAttributeNames, messaging.AttributeKey)
+	case *sns.PublishInput:
+		in.MessageAttributes = injectSNS(span, in.MessageAttributes)
+	case *sns.PublishBatchInput:
+		for i := range in.PublishBatchRequestEntries {
+			entry := &in.PublishBatchRequestEntries[i]
+			entry.MessageAttributes = injectSNS(span, entry.MessageAttributes)
+		}
+	}
+}
+
+func injectSQS(span ddtrace.Span, attrs map[string]sqstypes.MessageAttributeValue) map[string]sqstypes.MessageAttributeValue {
+	_, exists := attrs[messaging.AttributeKey]
+	if !messaging.CanInject(len(attrs), exists) {
+		log.Debug("contrib/aws/aws-sdk-go-v2/aws: Not injecting trace context: message already has %d attributes.", len(attrs))
+		return attrs
+	}
+	data, err := messaging.Inject(span.Context())
+	if err != nil {
+		log.Debug("contrib/aws/aws-sdk-go-v2/aws: Failed to inject trace context: %v", err)
+		return attrs
+	}
+	if attrs == nil {
+		attrs = make(map[string]sqstypes.MessageAttributeValue, 1)
+	}
+	attrs[messaging.AttributeKey] = sqstypes.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(string(data)),
+	}
+	return attrs
+}
+
+func injectSNS(span ddtrace.Span, attrs map[string]snstypes.MessageAttributeValue) map[string]snstypes.MessageAttributeValue {
+	_, exists := attrs[messaging.AttributeKey]
+	if !messaging.CanInject(len(attrs), exists) {
+		log.Debug("contrib/aws/aws-sdk-go-v2/aws: Not injecting trace context: message already has %d attributes.", len(attrs))
+		return attrs
+	}
+	data, err := messaging.Inject(span.Context())
+	if err != nil {
+		log.Debug("contrib/aws/aws-sdk-go-v2/aws: Failed to inject trace context: %v", err)
+		return attrs
+	}
+	if attrs == nil {
+		attrs = make(map[string]snstypes.MessageAttributeValue, 1)
+	}
+	// The attribute is sent as binary data, which SNS notifications delivered to
+	// SQS carry base64 encoded (see messaging.ExtractNotification).
+	attrs[messaging.AttributeKey] = snstypes.MessageAttributeValue{
+		DataType:    aws.String("Binary"),
+		BinaryValue: data,
+	}
+	return attrs
+}
@@ -0,0 +1,146 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMessagingConfig(t *testing.T, opts ...Option) aws.Config {
+	server := mockAWS(200)
+	t.Cleanup(server.Close)
+	resolver := aws.EndpointResolverFunc(func(service, region string) (aws.Endpoint, error) {
+		return aws.Endpoint{
+			PartitionID:   "aws",
+			URL:           server.URL,
+			SigningRegion: "eu-west-1",
+		}, nil
+	})
+	awsCfg := aws.Config{
+		Region:           "eu-west-1",
+		Credentials:      aws.AnonymousCredentials{},
+		EndpointResolver: resolver,
+	}
+	AppendMiddleware(&awsCfg, opts...)
+	return awsCfg
+}
+
+func TestSQSPropagation(t *testing.T) {
+	t.Run("send", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		in := &sqs.SendMessageInput{
+			QueueUrl:    aws.String("queue"),
+			MessageBody: aws.String("body"),
+		}
+		sqs.NewFromConfig(newMessagingConfig(t)).SendMessage(context.Background(), in)
+
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 1)
+		sctx, err := ExtractSQSMessage(sqstypes.Message{MessageAttributes: in.MessageAttributes})
+		require.NoError(t, err)
+		assert.Equal(t, spans[0].SpanID(), sctx.SpanID())
+		assert.Equal(t, spans[0].TraceID(), sctx.TraceID())
+	})
+
+	t.Run("send-batch", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		in := &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String("queue"),
+			Entries: []sqstypes.SendMessageBatchRequestEntry{
+				{Id: aws.String("1"), MessageBody: aws.String("body")},
+				{Id: aws.String("2"), MessageBody: aws.String("body")},
+			},
+		}
+		sqs.NewFromConfig(newMessagingConfig(t)).SendMessageBatch(context.Background(), in)
+
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 1)
+		for _, entry := range in.Entries {
+			sctx, err := ExtractSQSMessage(sqstypes.Message{MessageAttributes: entry.MessageAttributes})
+			require.NoError(t, err)
+			assert.Equal(t, spans[0].SpanID(), sctx.SpanID())
+		}
+	})
+
+	t.Run("attribute-limit", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		attrs := make(map[string]sqstypes.MessageAttributeValue)
+		for i := 0; i < 10; i++ {
+			attrs[fmt.Sprintf("attr%d", i)] = sqstypes.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String("value"),
+			}
+		}
+		in := &sqs.SendMessageInput{
+			QueueUrl:          aws.String("queue"),
+			MessageBody:       aws.String("body"),
+			MessageAttributes: attrs,
+		}
+		sqs.NewFromConfig(newMessagingConfig(t)).SendMessage(context.Background(), in)
+
+		assert.Len(t, in.MessageAttributes, 10)
+		assert.NotContains(t, in.MessageAttributes, "_datadog")
+	})
+
+	t.Run("receive", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		in := &sqs.ReceiveMessageInput{QueueUrl: aws.String("queue")}
+		sqs.NewFromConfig(newMessagingConfig(t)).ReceiveMessage(context.Background(), in)
+		assert.Equal(t, []string{"_datadog"}, in.MessageAttributeNames)
+
+		in = &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String("queue"),
+			MessageAttributeNames: []string{".*"},
+		}
+		sqs.NewFromConfig(newMessagingConfig(t)).ReceiveMessage(context.Background(), in)
+		assert.Equal(t, []string{".*"}, in.MessageAttributeNames)
+	})
+}
+
+func TestSNSPropagation(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	in := &sns.PublishInput{
+		TopicArn: aws.String("arn:aws:sns:eu-west-1:123456789012:topic"),
+		Message:  aws.String("body"),
+	}
+	sns.NewFromConfig(newMessagingConfig(t)).Publish(context.Background(), in)
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 1)
+	attr, ok := in.MessageAttributes["_datadog"]
+	require.True(t, ok)
+	assert.Equal(t, "Binary", *attr.DataType)
+
+	// Raw message delivery forwards the binary attribute as is.
+	sctx, err := ExtractSQSMessage(sqstypes.Message{
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+			"_datadog": {DataType: attr.DataType, BinaryValue: attr.BinaryValue},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, spans[0].SpanID(), sctx.SpanID())
+}
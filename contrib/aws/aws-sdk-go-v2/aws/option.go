@@ -6,14 +6,18 @@
 package aws
 
 import (
+	"context"
 	"math"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/internal"
+
+	"github.com/aws/smithy-go/middleware"
 )
 
 type config struct {
 	serviceName   string
 	analyticsRate float64
+	tagFns        map[string]func(ctx context.Context, in middleware.InitializeInput) interface{}
 }
 
 // Option represents an option that can be passed to Dial.
@@ -58,3 +62,15 @@ func WithAnalyticsRate(rate float64) Option {
 		}
 	}
 }
+
+// WithCustomTag will cause the given tagFn to be evaluated before the request is
+// sent and attach the result to the span tagged by the key. The operation input,
+// such as *sqs.SendMessageInput, is available to tagFn as in.Parameters.
+func WithCustomTag(tag string, tagFn func(ctx context.Context, in middleware.InitializeInput) interface{}) Option {
+	return func(cfg *config) {
+		if cfg.tagFns == nil {
+			cfg.tagFns = make(map[string]func(ctx context.Context, in middleware.InitializeInput) interface{})
+		}
+		cfg.tagFns[tag] = tagFn
+	}
+}
@@ -4,12 +4,17 @@
 // Copyright 2016 Datadog, Inc.
 
 // Package aws provides functions to trace aws/aws-sdk-go (https://github.com/aws/aws-sdk-go).
+//
+// The trace context is propagated in the message attributes of the SQS
+// SendMessage and SendMessageBatch operations and of the SNS Publish operation,
+// and can be extracted from the received SQS messages with ExtractSQSMessage.
 package aws // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/aws/aws-sdk-go/aws"
 
 import (
 	"math"
 	"strconv"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/aws/internal/servicetags"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -21,8 +26,10 @@ import (
 
 const (
 	tagAWSAgent      = "aws.agent"
+	tagAWSService    = "aws.service"
 	tagAWSOperation  = "aws.operation"
 	tagAWSRegion     = "aws.region"
+	tagAWSRequestID  = "aws.request_id"
 	tagAWSRetryCount = "aws.retry_count"
 )
 
@@ -40,6 +47,10 @@ func WrapSession(s *session.Session, opts ...Option) *session.Session {
 	log.Debug("contrib/aws/aws-sdk-go/aws: Wrapping Session: %#v", cfg)
 	h := &handlers{cfg: cfg}
 	s = s.Copy()
+	s.Handlers.Build.PushFrontNamed(request.NamedHandler{
+		Name: "gopkg.in/DataDog/dd-trace-go.v1/contrib/aws/aws-sdk-go/aws/handlers.Build",
+		Fn:   h.Build,
+	})
 	s.Handlers.Send.PushFrontNamed(request.NamedHandler{
 		Name: "gopkg.in/DataDog/dd-trace-go.v1/contrib/aws/aws-sdk-go/aws/handlers.Send",
 		Fn:   h.Send,
@@ -51,25 +62,69 @@ func WrapSession(s *session.Session, opts ...Option) *session.Session {
 	return s
 }
 
+// Build starts the span of the SQS and SNS operations sending messages, so that
+// its context gets injected into the messages before the request is serialized.
+// The span of the other requests is only started once they are sent, as they
+// can be built without ever being sent. Presigned requests aren't traced, and
+// their messages carry the context of the span calling AWS, if any.
+func (h *handlers) Build(req *request.Request) {
+	var sctx ddtrace.SpanContext
+	switch {
+	case !sendsMessages(req.Params):
+	case req.ExpireTime > 0:
+		// The request is being presigned
+		if span, ok := tracer.SpanFromContext(req.Context()); ok {
+			sctx = span.Context()
+		}
+	default:
+		sctx = h.startSpan(req).Context()
+	}
+	injectMessageAttributes(sctx, req.Params)
+}
+
 func (h *handlers) Send(req *request.Request) {
 	if req.RetryCount != 0 {
 		return
 	}
+	var span ddtrace.Span
+	if sendsMessages(req.Params) {
+		// The span was started when the request was built
+		var ok bool
+		if span, ok = tracer.SpanFromContext(req.Context()); !ok {
+			return
+		}
+	} else {
+		span = h.startSpan(req)
+	}
+	// The user agent and the URL are only final once the request is built.
+	span.SetTag(tagAWSAgent, h.awsAgent(req))
+	span.SetTag(ext.HTTPURL, req.HTTPRequest.URL.String())
+	for k, fn := range h.cfg.tagFns {
+		span.SetTag(k, fn(req))
+	}
+}
+
+// startSpan starts the span of the given request and sets it into the request
+// context.
+func (h *handlers) startSpan(req *request.Request) ddtrace.Span {
 	opts := []ddtrace.StartSpanOption{
 		tracer.SpanType(ext.SpanTypeHTTP),
 		tracer.ServiceName(h.serviceName(req)),
 		tracer.ResourceName(h.resourceName(req)),
-		tracer.Tag(tagAWSAgent, h.awsAgent(req)),
+		tracer.Tag(tagAWSService, h.awsServiceID(req)),
 		tracer.Tag(tagAWSOperation, h.awsOperation(req)),
 		tracer.Tag(tagAWSRegion, h.awsRegion(req)),
 		tracer.Tag(ext.HTTPMethod, req.Operation.HTTPMethod),
-		tracer.Tag(ext.HTTPURL, req.HTTPRequest.URL.String()),
 	}
 	if !math.IsNaN(h.cfg.analyticsRate) {
 		opts = append(opts, tracer.Tag(ext.EventSampleRate, h.cfg.analyticsRate))
 	}
-	_, ctx := tracer.StartSpanFromContext(req.Context(), h.operationName(req), opts...)
+	for k, v := range servicetags.Extract(h.awsServiceID(req), h.awsOperation(req), req.Params) {
+		opts = append(opts, tracer.Tag(k, v))
+	}
+	span, ctx := tracer.StartSpanFromContext(req.Context(), h.operationName(req), opts...)
 	req.SetContext(ctx)
+	return span
 }
 
 func (h *handlers) Complete(req *request.Request) {
@@ -78,6 +133,9 @@ func (h *handlers) Complete(req *request.Request) {
 		return
 	}
 	span.SetTag(tagAWSRetryCount, req.RetryCount)
+	if req.RequestID != "" {
+		span.SetTag(tagAWSRequestID, req.RequestID)
+	}
 	if req.HTTPResponse != nil {
 		span.SetTag(ext.HTTPCode, strconv.Itoa(req.HTTPResponse.StatusCode))
 	}
@@ -117,3 +175,7 @@ func (h *handlers) awsRegion(req *request.Request) string {
 func (h *handlers) awsService(req *request.Request) string {
 	return req.ClientInfo.ServiceName
 }
+
+func (h *handlers) awsServiceID(req *request.Request) string {
+	return req.ClientInfo.ServiceID
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/stretchr/testify/assert"
@@ -177,3 +178,27 @@ func TestRetries(t *testing.T) {
 	assert.Len(t, mt.FinishedSpans(), 1)
 	assert.Equal(t, mt.FinishedSpans()[0].Tag(tagAWSRetryCount), 3)
 }
+
+func TestServiceTags(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	session := newMessagingSession(t, WithCustomTag("custom.key", func(req *request.Request) interface{} {
+		return *req.Params.(*dynamodb.GetItemInput).Key["id"].S
+	}))
+	dynamodb.New(session).GetItemWithContext(context.Background(), &dynamodb.GetItemInput{
+		TableName: aws.String("table"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String("key")},
+		},
+	})
+
+	spans := mt.FinishedSpans()
+	assert.Len(t, spans, 1)
+	s := spans[0]
+	assert.Equal(t, "table", s.Tag("tablename"))
+	assert.Equal(t, "key", s.Tag("custom.key"))
+	assert.Equal(t, "DynamoDB", s.Tag(tagAWSService))
+	assert.Equal(t, "test_req", s.Tag(tagAWSRequestID))
+	assert.Equal(t, 0, s.Tag(tagAWSRetryCount))
+}
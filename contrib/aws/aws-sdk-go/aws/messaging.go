@@ -0,0 +1,120 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package aws
+
+import (
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/aws/internal/messaging"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// ExtractSQSMessage returns the span context propagated with msg, as injected by a
+// traced SendMessage or SendMessageBatch call. Messages delivered to the queue by an
+// SNS subscription without raw message delivery are also supported, in which case the
+// span context is looked up within the SNS notification found in the message body.
+func ExtractSQSMessage(msg *sqs.Message) (ddtrace.SpanContext, error) {
+	if msg == nil {
+		return nil, tracer.ErrSpanContextNotFound
+	}
+	if attr, ok := msg.MessageAttributes[messaging.AttributeKey]; ok && attr != nil {
+		if attr.StringValue != nil {
+			return messaging.Extract([]byte(*attr.StringValue))
+		}
+		return messaging.Extract(attr.BinaryValue)
+	}
+	return messaging.ExtractNotification(aws.StringValue(msg.Body))
+}
+
+// injectMessageAttributes injects the given span context, when not nil, into the
+// message attributes of the SQS and SNS operations sending messages, and makes sure
+// that receiving SQS operations ask for the attribute holding it.
+func injectMessageAttributes(sctx ddtrace.SpanContext, params interface{}) {
+	switch in := params.(type) {
+	case *sqs.SendMessageInput:
+		in.MessageAttributes = injectSQS(sctx, in.MessageAttributes)
+	case *sqs.SendMessageBatchInput:
+		for _, entry := range in.Entries {
+			if entry != nil {
+				entry.MessageAttributes = injectSQS(sctx, entry.MessageAttributes)
+			}
+		}
+	case *sqs.ReceiveMessageInput:
+		for _, name := range in.MessageAttributeNames {
+			if messaging.Requested(aws.StringValue(name)) {
+				return
+			}
+		}
+		in.MessageAttributeNames = append(in.MessageAttributeNames, aws.String(messaging.AttributeKey))
+	case *sns.PublishInput:
+		in.MessageAttributes = injectSNS(sctx, in.MessageAttributes)
+	}
+}
+
+// sendsMessages returns true for the parameters of the SQS and SNS operations
+// sending messages, whose trace context is propagated in the message
+// attributes: SQS SendMessage and SendMessageBatch, and SNS Publish.
+func sendsMessages(params interface{}) bool {
+	switch params.(type) {
+	case *sqs.SendMessageInput, *sqs.SendMessageBatchInput, *sns.PublishInput:
+		return true
+	}
+	return false
+}
+
+func injectSQS(sctx ddtrace.SpanContext, attrs map[string]*sqs.MessageAttributeValue) map[string]*sqs.MessageAttributeValue {
+	if sctx == nil {
+		return attrs
+	}
+	_, exists := attrs[messaging.AttributeKey]
+	if !messaging.CanInject(len(attrs), exists) {
+		log.Debug("contrib/aws/aws-sdk-go/aws: Not injecting trace context: message already has %d attributes.", len(attrs))
+		return attrs
+	}
+	data, err := messaging.Inject(sctx)
+	if err != nil {
+		log.Debug("contrib/aws/aws-sdk-go/aws: Failed to inject trace context: %v", err)
+		return attrs
+	}
+	if attrs == nil {
+		attrs = make(map[string]*sqs.MessageAttributeValue, 1)
+	}
+	attrs[messaging.AttributeKey] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(string(data)),
+	}
+	return attrs
+}
+
+func injectSNS(sctx ddtrace.SpanContext, attrs map[string]*sns.MessageAttributeValue) map[string]*sns.MessageAttributeValue {
+	if sctx == nil {
+		return attrs
+	}
+	_, exists := attrs[messaging.AttributeKey]
+	if !messaging.CanInject(len(attrs), exists) {
+		log.Debug("contrib/aws/aws-sdk-go/aws: Not injecting trace context: message already has %d attributes.", len(attrs))
+		return attrs
+	}
+	data, err := messaging.Inject(sctx)
+	if err != nil {
+		log.Debug("contrib/aws/aws-sdk-go/aws: Failed to inject trace context: %v", err)
+		return attrs
+	}
+	if attrs == nil {
+		attrs = make(map[string]*sns.MessageAttributeValue, 1)
+	}
+	// The attribute is sent as binary data, which SNS notifications delivered to
+	// SQS carry base64 encoded (see messaging.ExtractNotification).
+	attrs[messaging.AttributeKey] = &sns.MessageAttributeValue{
+		DataType:    aws.String("Binary"),
+		BinaryValue: data,
+	}
+	return attrs
+}
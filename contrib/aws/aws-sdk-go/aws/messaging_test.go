@@ -0,0 +1,201 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package aws
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+func newMessagingSession(t *testing.T, opts ...Option) *session.Session {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Amzn-Requestid", "test_req")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	cfg := aws.NewConfig().
+		WithRegion("us-west-2").
+		WithEndpoint(server.URL).
+		WithMaxRetries(0).
+		WithCredentials(credentials.AnonymousCredentials)
+	return WrapSession(session.Must(session.NewSession(cfg)), opts...)
+}
+
+func TestSQSPropagation(t *testing.T) {
+	t.Run("send", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		parent, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+		in := &sqs.SendMessageInput{
+			QueueUrl:    aws.String("queue"),
+			MessageBody: aws.String("body"),
+		}
+		sqs.New(newMessagingSession(t)).SendMessageWithContext(ctx, in)
+		parent.Finish()
+
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 2)
+		assert.Equal(t, parent.Context().SpanID(), spans[0].ParentID())
+		// The messages are parented to the span of the request
+		sctx, err := ExtractSQSMessage(&sqs.Message{MessageAttributes: in.MessageAttributes})
+		require.NoError(t, err)
+		assert.Equal(t, spans[0].SpanID(), sctx.SpanID())
+		assert.Equal(t, parent.Context().TraceID(), sctx.TraceID())
+		assert.Equal(t, "String", *in.MessageAttributes["_datadog"].DataType)
+	})
+
+	t.Run("send-batch", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		parent, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+		in := &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String("queue"),
+			Entries: []*sqs.SendMessageBatchRequestEntry{
+				{Id: aws.String("1"), MessageBody: aws.String("body")},
+				{Id: aws.String("2"), MessageBody: aws.String("body")},
+			},
+		}
+		sqs.New(newMessagingSession(t)).SendMessageBatchWithContext(ctx, in)
+		parent.Finish()
+
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 2)
+		for _, entry := range in.Entries {
+			sctx, err := ExtractSQSMessage(&sqs.Message{MessageAttributes: entry.MessageAttributes})
+			require.NoError(t, err)
+			assert.Equal(t, spans[0].SpanID(), sctx.SpanID())
+		}
+	})
+
+	t.Run("no-parent", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		in := &sqs.SendMessageInput{
+			QueueUrl:    aws.String("queue"),
+			MessageBody: aws.String("body"),
+		}
+		sqs.New(newMessagingSession(t)).SendMessageWithContext(context.Background(), in)
+
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 1)
+		sctx, err := ExtractSQSMessage(&sqs.Message{MessageAttributes: in.MessageAttributes})
+		require.NoError(t, err)
+		assert.Equal(t, spans[0].SpanID(), sctx.SpanID())
+		assert.Equal(t, spans[0].TraceID(), sctx.TraceID())
+	})
+
+	t.Run("presign", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		parent, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+		in := &sqs.SendMessageInput{
+			QueueUrl:    aws.String("queue"),
+			MessageBody: aws.String("body"),
+		}
+		req, _ := sqs.New(newMessagingSession(t)).SendMessageRequest(in)
+		req.SetContext(ctx)
+		_, err := req.Presign(time.Minute)
+		require.NoError(t, err)
+		parent.Finish()
+
+		sctx, err := ExtractSQSMessage(&sqs.Message{MessageAttributes: in.MessageAttributes})
+		require.NoError(t, err)
+		assert.Equal(t, parent.Context().SpanID(), sctx.SpanID())
+		assert.Len(t, mt.FinishedSpans(), 1, "presigned requests aren't traced")
+		assert.Empty(t, mt.OpenSpans())
+	})
+
+	t.Run("attribute-limit", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		_, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+		attrs := make(map[string]*sqs.MessageAttributeValue)
+		for i := 0; i < 10; i++ {
+			attrs[fmt.Sprintf("attr%d", i)] = &sqs.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String("value"),
+			}
+		}
+		in := &sqs.SendMessageInput{
+			QueueUrl:          aws.String("queue"),
+			MessageBody:       aws.String("body"),
+			MessageAttributes: attrs,
+		}
+		sqs.New(newMessagingSession(t)).SendMessageWithContext(ctx, in)
+
+		assert.Len(t, in.MessageAttributes, 10)
+		assert.NotContains(t, in.MessageAttributes, "_datadog")
+	})
+
+	t.Run("receive", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		in := &sqs.ReceiveMessageInput{QueueUrl: aws.String("queue")}
+		sqs.New(newMessagingSession(t)).ReceiveMessageWithContext(context.Background(), in)
+		assert.Equal(t, []*string{aws.String("_datadog")}, in.MessageAttributeNames)
+
+		in = &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String("queue"),
+			MessageAttributeNames: []*string{aws.String("All")},
+		}
+		sqs.New(newMessagingSession(t)).ReceiveMessageWithContext(context.Background(), in)
+		assert.Equal(t, []*string{aws.String("All")}, in.MessageAttributeNames)
+	})
+
+	t.Run("not-found", func(t *testing.T) {
+		_, err := ExtractSQSMessage(&sqs.Message{Body: aws.String("body")})
+		assert.Error(t, err)
+	})
+}
+
+func TestSNSPropagation(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	parent, ctx := tracer.StartSpanFromContext(context.Background(), "parent")
+	in := &sns.PublishInput{
+		TopicArn: aws.String("arn:aws:sns:us-west-2:123456789012:topic"),
+		Message:  aws.String("body"),
+	}
+	sns.New(newMessagingSession(t)).PublishWithContext(ctx, in)
+	parent.Finish()
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	attr := in.MessageAttributes["_datadog"]
+	require.NotNil(t, attr)
+	assert.Equal(t, "Binary", *attr.DataType)
+
+	// SNS-over-SQS delivery wraps the message and its attributes into a notification.
+	body := fmt.Sprintf(`{"Type":"Notification","Message":"body","MessageAttributes":{"_datadog":{"Type":"Binary","Value":%q}}}`,
+		base64.StdEncoding.EncodeToString(attr.BinaryValue))
+	sctx, err := ExtractSQSMessage(&sqs.Message{Body: aws.String(body)})
+	require.NoError(t, err)
+	assert.Equal(t, spans[0].SpanID(), sctx.SpanID())
+	assert.Equal(t, parent.Context().TraceID(), sctx.TraceID())
+}
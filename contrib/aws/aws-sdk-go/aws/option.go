@@ -9,11 +9,14 @@ import (
 	"math"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/internal"
+
+	"github.com/aws/aws-sdk-go/aws/request"
 )
 
 type config struct {
 	serviceName   string
 	analyticsRate float64
+	tagFns        map[string]func(req *request.Request) interface{}
 }
 
 // Option represents an option that can be passed to Dial.
@@ -59,3 +62,15 @@ func WithAnalyticsRate(rate float64) Option {
 		}
 	}
 }
+
+// WithCustomTag will cause the given tagFn to be evaluated when the request is
+// about to be sent and attach the result to the span tagged by the key. The
+// request input is available to tagFn as req.Params.
+func WithCustomTag(tag string, tagFn func(req *request.Request) interface{}) Option {
+	return func(cfg *config) {
+		if cfg.tagFns == nil {
+			cfg.tagFns = make(map[string]func(req *request.Request) interface{})
+		}
+		cfg.tagFns[tag] = tagFn
+	}
+}
@@ -0,0 +1,88 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+// Package messaging holds the trace context propagation logic shared by the
+// aws-sdk-go and aws-sdk-go-v2 integrations for SQS and SNS messages.
+package messaging // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/aws/internal/messaging"
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+const (
+	// AttributeKey is the name of the message attribute carrying the
+	// propagated trace context.
+	AttributeKey = "_datadog"
+
+	// MaxAttributes is the maximum number of message attributes allowed
+	// by SQS and SNS on a single message.
+	MaxAttributes = 10
+)
+
+// Inject returns the JSON encoded propagation headers for the given span context.
+func Inject(ctx ddtrace.SpanContext) ([]byte, error) {
+	carrier := tracer.TextMapCarrier{}
+	if err := tracer.Inject(ctx, carrier); err != nil {
+		return nil, err
+	}
+	return json.Marshal(carrier)
+}
+
+// Extract returns the span context encoded in data, as previously returned by Inject.
+func Extract(data []byte) (ddtrace.SpanContext, error) {
+	var carrier tracer.TextMapCarrier
+	if err := json.Unmarshal(data, &carrier); err != nil {
+		return nil, tracer.ErrSpanContextCorrupted
+	}
+	return tracer.Extract(carrier)
+}
+
+// CanInject reports whether the trace context attribute can be added to a message
+// already holding the given attributes count, without going above MaxAttributes.
+// The exists argument specifies whether the trace context attribute is already set.
+func CanInject(count int, exists bool) bool {
+	return exists || count < MaxAttributes
+}
+
+// Requested reports whether the given attribute name passed to ReceiveMessage
+// already selects the trace context attribute.
+func Requested(name string) bool {
+	return name == AttributeKey || name == "All" || name == ".*"
+}
+
+// snsNotification is the envelope wrapping SNS messages delivered to SQS queues
+// when raw message delivery is disabled.
+type snsNotification struct {
+	Type              string `json:"Type"`
+	MessageAttributes map[string]struct {
+		Type  string `json:"Type"`
+		Value string `json:"Value"`
+	} `json:"MessageAttributes"`
+}
+
+// ExtractNotification returns the span context found in the message attributes of
+// an SNS notification envelope, as received in the body of an SQS message.
+func ExtractNotification(body string) (ddtrace.SpanContext, error) {
+	var n snsNotification
+	if err := json.Unmarshal([]byte(body), &n); err != nil || n.Type != "Notification" {
+		return nil, tracer.ErrSpanContextNotFound
+	}
+	attr, ok := n.MessageAttributes[AttributeKey]
+	if !ok {
+		return nil, tracer.ErrSpanContextNotFound
+	}
+	data := []byte(attr.Value)
+	if attr.Type == "Binary" {
+		var err error
+		if data, err = base64.StdEncoding.DecodeString(attr.Value); err != nil {
+			return nil, tracer.ErrSpanContextCorrupted
+		}
+	}
+	return Extract(data)
+}
@@ -0,0 +1,76 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package messaging
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInjectExtract(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	span := tracer.StartSpan("test")
+	data, err := Inject(span.Context())
+	require.NoError(t, err)
+
+	sctx, err := Extract(data)
+	require.NoError(t, err)
+	assert.Equal(t, span.Context().SpanID(), sctx.SpanID())
+
+	_, err = Extract([]byte("not json"))
+	assert.Equal(t, tracer.ErrSpanContextCorrupted, err)
+}
+
+func TestExtractNotification(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	span := tracer.StartSpan("test")
+	data, err := Inject(span.Context())
+	require.NoError(t, err)
+
+	t.Run("binary", func(t *testing.T) {
+		body := fmt.Sprintf(`{"Type":"Notification","MessageAttributes":{"_datadog":{"Type":"Binary","Value":%q}}}`,
+			base64.StdEncoding.EncodeToString(data))
+		sctx, err := ExtractNotification(body)
+		require.NoError(t, err)
+		assert.Equal(t, span.Context().SpanID(), sctx.SpanID())
+	})
+
+	t.Run("string", func(t *testing.T) {
+		body := fmt.Sprintf(`{"Type":"Notification","MessageAttributes":{"_datadog":{"Type":"String","Value":%q}}}`, data)
+		sctx, err := ExtractNotification(body)
+		require.NoError(t, err)
+		assert.Equal(t, span.Context().SpanID(), sctx.SpanID())
+	})
+
+	t.Run("not-found", func(t *testing.T) {
+		for _, body := range []string{
+			"plain body",
+			`{"Type":"Notification","MessageAttributes":{}}`,
+			`{"Type":"SubscriptionConfirmation"}`,
+		} {
+			_, err := ExtractNotification(body)
+			assert.Equal(t, tracer.ErrSpanContextNotFound, err)
+		}
+	})
+}
+
+func TestCanInject(t *testing.T) {
+	assert.True(t, CanInject(0, false))
+	assert.True(t, CanInject(9, false))
+	assert.False(t, CanInject(10, false))
+	assert.True(t, CanInject(10, true))
+}
@@ -0,0 +1,94 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+// Package servicetags extracts the span tags identifying the resource targeted by
+// an AWS request, shared by the aws-sdk-go and aws-sdk-go-v2 integrations.
+package servicetags // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/aws/internal/servicetags"
+
+import (
+	"reflect"
+	"strings"
+)
+
+const (
+	// TableName is the tag holding the name of a DynamoDB table.
+	TableName = "tablename"
+	// BucketName is the tag holding the name of an S3 bucket.
+	BucketName = "bucketname"
+	// QueueName is the tag holding the name of an SQS queue.
+	QueueName = "queuename"
+	// StreamName is the tag holding the name of a Kinesis stream.
+	StreamName = "streamname"
+	// TopicName is the tag holding the name of an SNS topic.
+	TopicName = "topicname"
+	// RuleName is the tag holding the name of an EventBridge rule.
+	RuleName = "rulename"
+)
+
+// Extract returns the tags found in the input params of the given operation of the
+// service identified by serviceID, such as "DynamoDB" or "S3". It returns nil when
+// the service is not supported or the input does not target a known resource.
+func Extract(serviceID, operation string, params interface{}) map[string]string {
+	switch serviceID {
+	case "DynamoDB":
+		return tag(TableName, field(params, "TableName"))
+	case "S3":
+		return tag(BucketName, field(params, "Bucket"))
+	case "SQS":
+		if url := field(params, "QueueUrl"); url != "" {
+			return tag(QueueName, url[strings.LastIndexByte(url, '/')+1:])
+		}
+		return tag(QueueName, field(params, "QueueName"))
+	case "Kinesis":
+		if name := field(params, "StreamName"); name != "" {
+			return tag(StreamName, name)
+		}
+		arn := field(params, "StreamARN")
+		return tag(StreamName, arn[strings.LastIndexByte(arn, '/')+1:])
+	case "SNS":
+		arn := field(params, "TopicArn")
+		return tag(TopicName, arn[strings.LastIndexByte(arn, ':')+1:])
+	case "EventBridge":
+		if name := field(params, "Rule"); name != "" {
+			return tag(RuleName, name)
+		}
+		if strings.HasSuffix(operation, "Rule") {
+			// PutRule, DescribeRule, DeleteRule, etc. name the rule with Name.
+			return tag(RuleName, field(params, "Name"))
+		}
+	}
+	return nil
+}
+
+func tag(key, value string) map[string]string {
+	if value == "" {
+		return nil
+	}
+	return map[string]string{key: value}
+}
+
+// field returns the value of the string, or string pointer, field called name
+// in the struct pointed to by params.
+func field(params interface{}, name string) string {
+	v := reflect.ValueOf(params)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return ""
+	}
+	v = v.Elem()
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	f := v.FieldByName(name)
+	if f.Kind() == reflect.Ptr {
+		if f.IsNil() {
+			return ""
+		}
+		f = f.Elem()
+	}
+	if f.Kind() != reflect.String {
+		return ""
+	}
+	return f.String()
+}
@@ -0,0 +1,42 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package servicetags
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func strptr(s string) *string { return &s }
+
+func TestExtract(t *testing.T) {
+	for _, tt := range []struct {
+		service, operation string
+		params             interface{}
+		want               map[string]string
+	}{
+		{"DynamoDB", "GetItem", &struct{ TableName *string }{strptr("table")}, map[string]string{TableName: "table"}},
+		{"S3", "GetObject", &struct{ Bucket *string }{strptr("bucket")}, map[string]string{BucketName: "bucket"}},
+		{"SQS", "SendMessage", &struct{ QueueUrl *string }{strptr("https://sqs.us-east-1.amazonaws.com/123456789012/queue")}, map[string]string{QueueName: "queue"}},
+		{"SQS", "CreateQueue", &struct{ QueueName *string }{strptr("queue")}, map[string]string{QueueName: "queue"}},
+		{"Kinesis", "PutRecord", &struct{ StreamName *string }{strptr("stream")}, map[string]string{StreamName: "stream"}},
+		{"Kinesis", "PutRecord", &struct{ StreamARN *string }{strptr("arn:aws:kinesis:us-east-1:123456789012:stream/stream")}, map[string]string{StreamName: "stream"}},
+		{"SNS", "Publish", &struct{ TopicArn *string }{strptr("arn:aws:sns:us-east-1:123456789012:topic")}, map[string]string{TopicName: "topic"}},
+		{"EventBridge", "PutRule", &struct{ Name *string }{strptr("rule")}, map[string]string{RuleName: "rule"}},
+		{"EventBridge", "PutTargets", &struct{ Rule *string }{strptr("rule")}, map[string]string{RuleName: "rule"}},
+		{"EventBridge", "CreateEventBus", &struct{ Name *string }{strptr("bus")}, nil},
+		{"S3", "ListBuckets", &struct{}{}, nil},
+		{"S3", "GetObject", &struct{ Bucket *string }{}, nil},
+		{"S3", "GetObject", &struct{ Bucket string }{"bucket"}, map[string]string{BucketName: "bucket"}},
+		{"S3", "GetObject", nil, nil},
+		{"EC2", "DescribeInstances", &struct{}{}, nil},
+	} {
+		t.Run(tt.service+"."+tt.operation, func(t *testing.T) {
+			assert.Equal(t, tt.want, Extract(tt.service, tt.operation, tt.params))
+		})
+	}
+}
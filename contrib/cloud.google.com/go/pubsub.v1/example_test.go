@@ -36,7 +36,8 @@ func ExampleReceive() {
 	sub := client.Subscription("subscription")
 	err = sub.Receive(context.Background(), pubsubtrace.WrapReceiveHandler(sub, func(ctx context.Context, msg *pubsub.Message) {
 		// TODO: Handle message.
-	}))
+		pubsubtrace.Ack(ctx, msg)
+	}, pubsubtrace.WithFlowControlTracing()))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -9,6 +9,7 @@ package pubsub
 import (
 	"context"
 	"sync"
+	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
@@ -22,8 +23,9 @@ import (
 // This function is functionally equivalent to t.Publish(ctx, msg), but it also starts a publish
 // span and it ensures that the tracing metadata is propagated as attributes attached to
 // the published message.
-// It is required to call (*PublishResult).Get(ctx) on the value returned by Publish to complete
-// the span.
+// The span is completed as soon as the message is acknowledged by the server, regardless of
+// when (*PublishResult).Get(ctx) is called, so that it covers the time spent by the message
+// in the batching publisher.
 func Publish(ctx context.Context, t *pubsub.Topic, msg *pubsub.Message) *PublishResult {
 	span, ctx := tracer.StartSpanFromContext(
 		ctx,
@@ -36,14 +38,25 @@ func Publish(ctx context.Context, t *pubsub.Topic, msg *pubsub.Message) *Publish
 	if msg.Attributes == nil {
 		msg.Attributes = make(map[string]string)
 	}
-	if err := tracer.Inject(span.Context(), tracer.TextMapCarrier(msg.Attributes)); err != nil {
+	carrier := tracer.TextMapCarrier(msg.Attributes)
+	if err := tracer.Inject(span.Context(), carrier); err != nil {
 		log.Debug("contrib/cloud.google.com/go/pubsub.v1/: failed injecting tracing attributes: %v", err)
 	}
+	// a pathway found in the attributes takes precedence over the one in ctx
+	dsCtx := tracer.ExtractDataStreamsPathway(ctx, carrier)
+	if dsCtx, ok := tracer.SetDataStreamsCheckpoint(dsCtx, "direction:out", "topic:"+t.ID(), "type:google-pubsub"); ok {
+		tracer.InjectDataStreamsPathway(dsCtx, carrier)
+	}
 	span.SetTag("num_attributes", len(msg.Attributes))
-	return &PublishResult{
+	r := &PublishResult{
 		PublishResult: t.Publish(ctx, msg),
 		span:          span,
 	}
+	go func() {
+		<-r.Ready()
+		r.finish()
+	}()
+	return r
 }
 
 // PublishResult wraps *pubsub.PublishResult
@@ -53,19 +66,32 @@ type PublishResult struct {
 	span tracer.Span
 }
 
-// Get wraps (pubsub.PublishResult).Get(ctx). When this function returns the publish
-// span created in Publish is completed.
+// Get wraps (pubsub.PublishResult).Get(ctx). When this function returns successfully the
+// publish span created in Publish is completed.
 func (r *PublishResult) Get(ctx context.Context) (string, error) {
 	serverID, err := r.PublishResult.Get(ctx)
+	select {
+	case <-r.Ready():
+		// the span may not have been finished yet by the goroutine started in Publish
+		r.finish()
+	default:
+		// ctx is done before the server acknowledged the message
+	}
+	return serverID, err
+}
+
+// finish completes the publish span. It must only be called once the result is ready.
+func (r *PublishResult) finish() {
 	r.once.Do(func() {
+		serverID, err := r.PublishResult.Get(context.Background())
 		r.span.SetTag("server_id", serverID)
 		r.span.Finish(tracer.WithError(err))
 	})
-	return serverID, err
 }
 
 type config struct {
-	serviceName string
+	serviceName      string
+	traceFlowControl bool
 }
 
 // A ReceiveOption is used to customize spans started by WrapReceiveHandler.
@@ -78,17 +104,42 @@ func WithServiceName(serviceName string) ReceiveOption {
 	}
 }
 
+// WithFlowControlTracing enables the tracing of the periods during which the wrapped
+// subscription stops pulling messages because the limits set in its ReceiveSettings
+// are reached. Each of these periods is reported as a "pubsub.flow_control" span.
+// Messages are considered outstanding until they are acknowledged using Ack or Nack,
+// or until the handler returns.
+func WithFlowControlTracing() ReceiveOption {
+	return func(cfg *config) {
+		cfg.traceFlowControl = true
+	}
+}
+
 // WrapReceiveHandler returns a receive handler that wraps the supplied handler,
 // extracts any tracing metadata attached to the received message, and starts a
-// receive span.
+// receive span. Messages acknowledged using Ack or Nack with the context passed
+// to the handler have their outcome and ack latency recorded on this span.
 func WrapReceiveHandler(s *pubsub.Subscription, f func(context.Context, *pubsub.Message), opts ...ReceiveOption) func(context.Context, *pubsub.Message) {
 	var cfg config
 	for _, opt := range opts {
 		opt(&cfg)
 	}
 	log.Debug("contrib/cloud.google.com/go/pubsub.v1: Wrapping Receive Handler: %#v", cfg)
+	var fc *flowControl
+	if cfg.traceFlowControl {
+		fc = newFlowControl(s, cfg.serviceName)
+	}
 	return func(ctx context.Context, msg *pubsub.Message) {
-		parentSpanCtx, _ := tracer.Extract(tracer.TextMapCarrier(msg.Attributes))
+		start := time.Now()
+		if fc != nil {
+			fc.acquire(len(msg.Data))
+		}
+		carrier := tracer.TextMapCarrier(msg.Attributes)
+		parentSpanCtx, _ := tracer.Extract(carrier)
+		// the handler's context holds the resulting Data Streams pathway, so that
+		// it is continued by any message published using it
+		ctx = tracer.ExtractDataStreamsPathway(ctx, carrier)
+		ctx, _ = tracer.SetDataStreamsCheckpoint(ctx, "direction:in", "subscription:"+s.ID(), "type:google-pubsub")
 		opts := []ddtrace.StartSpanOption{
 			tracer.ResourceName(s.String()),
 			tracer.SpanType(ext.SpanTypeMessageConsumer),
@@ -106,7 +157,124 @@ func WrapReceiveHandler(s *pubsub.Subscription, f func(context.Context, *pubsub.
 		if msg.DeliveryAttempt != nil {
 			span.SetTag("delivery_attempt", *msg.DeliveryAttempt)
 		}
-		defer span.Finish()
-		f(ctx, msg)
+		rcpt := &receipt{msg: msg, span: span, start: start, fc: fc}
+		defer func() {
+			rcpt.settle("")
+			span.Finish()
+		}()
+		f(context.WithValue(ctx, receiptKey{}, rcpt), msg)
+	}
+}
+
+type receiptKey struct{}
+
+// receipt holds the state of a message being handled by a wrapped receive handler.
+type receipt struct {
+	msg   *pubsub.Message
+	span  ddtrace.Span
+	start time.Time
+	fc    *flowControl
+	once  sync.Once
+}
+
+// settle records the given ack outcome, if any, and releases the message from
+// flow control. Only the first call has any effect.
+func (r *receipt) settle(outcome string) {
+	r.once.Do(func() {
+		if outcome != "" {
+			r.span.SetTag("ack_outcome", outcome)
+			r.span.SetTag("ack_latency_ms", float64(time.Since(r.start))/float64(time.Millisecond))
+		}
+		if r.fc != nil {
+			r.fc.release(len(r.msg.Data))
+		}
+	})
+}
+
+// Ack is functionally equivalent to msg.Ack(). When ctx is the context passed to a
+// handler wrapped by WrapReceiveHandler for this message, the receive span is tagged
+// with the "ack" outcome and the time elapsed since the message was received.
+func Ack(ctx context.Context, msg *pubsub.Message) {
+	if r, ok := ctx.Value(receiptKey{}).(*receipt); ok && r.msg == msg {
+		r.settle("ack")
+	}
+	msg.Ack()
+}
+
+// Nack is functionally equivalent to msg.Nack(). When ctx is the context passed to a
+// handler wrapped by WrapReceiveHandler for this message, the receive span is tagged
+// with the "nack" outcome and the time elapsed since the message was received.
+func Nack(ctx context.Context, msg *pubsub.Message) {
+	if r, ok := ctx.Value(receiptKey{}).(*receipt); ok && r.msg == msg {
+		r.settle("nack")
+	}
+	msg.Nack()
+}
+
+// flowControl mirrors the flow control limits of a subscription in order to trace
+// the periods during which they are reached.
+type flowControl struct {
+	resource    string
+	serviceName string
+	maxCount    int // maximum outstanding messages, none when <= 0
+	maxBytes    int // maximum outstanding bytes, none when <= 0
+
+	mu    sync.Mutex
+	count int
+	bytes int
+	stall ddtrace.Span // non-nil while a limit is reached
+}
+
+func newFlowControl(s *pubsub.Subscription, serviceName string) *flowControl {
+	fc := &flowControl{
+		resource:    s.String(),
+		serviceName: serviceName,
+		maxCount:    s.ReceiveSettings.MaxOutstandingMessages,
+		maxBytes:    s.ReceiveSettings.MaxOutstandingBytes,
+	}
+	// zero values stand for the defaults, see pubsub.ReceiveSettings
+	if fc.maxCount == 0 {
+		fc.maxCount = pubsub.DefaultReceiveSettings.MaxOutstandingMessages
+	}
+	if fc.maxBytes == 0 {
+		fc.maxBytes = pubsub.DefaultReceiveSettings.MaxOutstandingBytes
+	}
+	return fc
+}
+
+func (fc *flowControl) full() bool {
+	return (fc.maxCount > 0 && fc.count >= fc.maxCount) || (fc.maxBytes > 0 && fc.bytes >= fc.maxBytes)
+}
+
+func (fc *flowControl) acquire(size int) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.count++
+	fc.bytes += size
+	if fc.stall != nil || !fc.full() {
+		return
+	}
+	opts := []ddtrace.StartSpanOption{
+		tracer.ResourceName(fc.resource),
+		tracer.SpanType(ext.SpanTypeMessageConsumer),
+		tracer.Tag("outstanding_messages", fc.count),
+		tracer.Tag("outstanding_bytes", fc.bytes),
+		tracer.Tag("max_outstanding_messages", fc.maxCount),
+		tracer.Tag("max_outstanding_bytes", fc.maxBytes),
+	}
+	if fc.serviceName != "" {
+		opts = append(opts, tracer.ServiceName(fc.serviceName))
+	}
+	fc.stall = tracer.StartSpan("pubsub.flow_control", opts...)
+}
+
+func (fc *flowControl) release(size int) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.count--
+	fc.bytes -= size
+	if fc.stall != nil && !fc.full() {
+		fc.stall.Finish()
+		fc.stall = nil
 	}
 }
@@ -221,6 +221,81 @@ func TestPropagationNoPubsliherSpan(t *testing.T) {
 	}, spans[0].Tags())
 }
 
+func TestPublishSpanEndsOnServerAck(t *testing.T) {
+	assert := assert.New(t)
+	ctx, topic, _, mt, cleanup := setup(t)
+	defer cleanup()
+
+	// Get is never called: the span must still be completed once the
+	// server acknowledged the message.
+	res := Publish(ctx, topic, &pubsub.Message{Data: []byte("hello")})
+	<-res.Ready()
+	assert.Eventually(func() bool { return len(mt.FinishedSpans()) == 1 }, time.Second, 10*time.Millisecond)
+
+	spans := mt.FinishedSpans()
+	assert.Equal("pubsub.publish", spans[0].OperationName())
+	srvID, err := res.Get(ctx)
+	assert.NoError(err)
+	assert.Equal(srvID, spans[0].Tag("server_id"))
+	assert.Len(mt.FinishedSpans(), 1, "span finished twice")
+}
+
+func TestAckOutcome(t *testing.T) {
+	for _, outcome := range []string{"ack", "nack"} {
+		t.Run(outcome, func(t *testing.T) {
+			assert := assert.New(t)
+			ctx, topic, sub, mt, cleanup := setup(t)
+			defer cleanup()
+
+			_, err := Publish(ctx, topic, &pubsub.Message{Data: []byte("hello")}).Get(ctx)
+			assert.NoError(err)
+
+			rctx, cancel := context.WithCancel(ctx)
+			err = sub.Receive(rctx, WrapReceiveHandler(sub, func(ctx context.Context, msg *pubsub.Message) {
+				defer cancel()
+				time.Sleep(10 * time.Millisecond)
+				if outcome == "ack" {
+					Ack(ctx, msg)
+				} else {
+					Nack(ctx, msg)
+				}
+			}))
+			assert.NoError(err)
+
+			spans := mt.FinishedSpans()
+			assert.Len(spans, 2, "wrong number of spans")
+			assert.Equal("pubsub.receive", spans[1].OperationName())
+			assert.Equal(outcome, spans[1].Tag("ack_outcome"))
+			assert.GreaterOrEqual(spans[1].Tag("ack_latency_ms"), float64(10))
+		})
+	}
+}
+
+func TestFlowControlTracing(t *testing.T) {
+	assert := assert.New(t)
+	ctx, topic, sub, mt, cleanup := setup(t)
+	defer cleanup()
+
+	_, err := Publish(ctx, topic, &pubsub.Message{Data: []byte("hello")}).Get(ctx)
+	assert.NoError(err)
+
+	sub.ReceiveSettings.MaxOutstandingMessages = 1
+	rctx, cancel := context.WithCancel(ctx)
+	err = sub.Receive(rctx, WrapReceiveHandler(sub, func(ctx context.Context, msg *pubsub.Message) {
+		defer cancel()
+		Ack(ctx, msg)
+	}, WithFlowControlTracing()))
+	assert.NoError(err)
+
+	spans := mt.FinishedSpans()
+	assert.Len(spans, 3, "wrong number of spans")
+	assert.Equal("pubsub.flow_control", spans[1].OperationName())
+	assert.Equal("projects/project/subscriptions/subscription", spans[1].Tag(ext.ResourceName))
+	assert.Equal(1, spans[1].Tag("outstanding_messages"))
+	assert.Equal(1, spans[1].Tag("max_outstanding_messages"))
+	assert.Equal("pubsub.receive", spans[2].OperationName())
+}
+
 func setup(t *testing.T) (context.Context, *pubsub.Topic, *pubsub.Subscription, mocktracer.Tracer, func()) {
 	assert := assert.New(t)
 	mt := mocktracer.Start()
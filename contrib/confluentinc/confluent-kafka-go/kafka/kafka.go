@@ -7,6 +7,7 @@
 package kafka // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/confluentinc/confluent-kafka-go/kafka"
 
 import (
+	"context"
 	"math"
 	"time"
 
@@ -24,6 +25,12 @@ func NewConsumer(conf *kafka.ConfigMap, opts ...Option) (*Consumer, error) {
 	if err != nil {
 		return nil, err
 	}
+	if v, err := conf.Get("group.id", ""); err == nil {
+		if groupID, ok := v.(string); ok && groupID != "" {
+			// the user provided options take precedence
+			opts = append([]Option{withGroupID(groupID)}, opts...)
+		}
+	}
 	return WrapConsumer(c, opts...), nil
 }
 
@@ -109,9 +116,25 @@ func (c *Consumer) startSpan(msg *kafka.Message) ddtrace.Span {
 	span, _ := tracer.StartSpanFromContext(c.cfg.ctx, "kafka.consume", opts...)
 	// reinject the span context so consumers can pick it up
 	tracer.Inject(span.Context(), carrier)
+	c.setConsumeCheckpoint(msg)
 	return span
 }
 
+// setConsumeCheckpoint sets a Data Streams consume checkpoint continuing the
+// pathway propagated in the message headers, and re-injects the resulting
+// pathway so that it can be continued by the consumer.
+func (c *Consumer) setConsumeCheckpoint(msg *kafka.Message) {
+	edges := []string{"direction:in", "topic:" + *msg.TopicPartition.Topic, "type:kafka"}
+	if c.cfg.groupID != "" {
+		edges = append(edges, "group:"+c.cfg.groupID)
+	}
+	carrier := NewMessageCarrier(msg)
+	ctx := tracer.ExtractDataStreamsPathway(context.Background(), carrier)
+	if ctx, ok := tracer.SetDataStreamsCheckpoint(ctx, edges...); ok {
+		tracer.InjectDataStreamsPathway(ctx, carrier)
+	}
+}
+
 // Close calls the underlying Consumer.Close and if polling is enabled, finishes
 // any remaining span.
 func (c *Consumer) Close() error {
@@ -214,9 +237,21 @@ func (p *Producer) startSpan(msg *kafka.Message) ddtrace.Span {
 	span, _ := tracer.StartSpanFromContext(p.cfg.ctx, "kafka.produce", opts...)
 	// inject the span context so consumers can pick it up
 	tracer.Inject(span.Context(), carrier)
+	setProduceCheckpoint(msg)
 	return span
 }
 
+// setProduceCheckpoint sets a Data Streams produce checkpoint continuing the
+// pathway found in the message headers, if any, and propagates the resulting
+// pathway in the headers.
+func setProduceCheckpoint(msg *kafka.Message) {
+	carrier := NewMessageCarrier(msg)
+	ctx := tracer.ExtractDataStreamsPathway(context.Background(), carrier)
+	if ctx, ok := tracer.SetDataStreamsCheckpoint(ctx, "direction:out", "topic:"+*msg.TopicPartition.Topic, "type:kafka"); ok {
+		tracer.InjectDataStreamsPathway(ctx, carrier)
+	}
+}
+
 // Close calls the underlying Producer.Close and also closes the internal
 // wrapping producer channel.
 func (p *Producer) Close() {
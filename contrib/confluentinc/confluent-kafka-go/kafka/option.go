@@ -18,6 +18,7 @@ type config struct {
 	consumerServiceName string
 	producerServiceName string
 	analyticsRate       float64
+	groupID             string
 }
 
 // An Option customizes the config.
@@ -52,6 +53,13 @@ func WithContext(ctx context.Context) Option {
 	}
 }
 
+// withGroupID sets the consumer group used to tag Data Streams checkpoints.
+func withGroupID(groupID string) Option {
+	return func(cfg *config) {
+		cfg.groupID = groupID
+	}
+}
+
 // WithServiceName sets the config service name to serviceName.
 func WithServiceName(serviceName string) Option {
 	return func(cfg *config) {
@@ -0,0 +1,72 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package restful
+
+import (
+	"net/http"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/httpsec"
+
+	"github.com/emicklei/go-restful"
+)
+
+// processFilterWithAppSec processes the filter chain with its execution
+// monitored by AppSec, along with the path parameters of the selected route.
+func processFilterWithAppSec(req *restful.Request, resp *restful.Response, chain *restful.FilterChain, span tracer.Span) {
+	w := &responseWriter{ResponseWriter: resp.ResponseWriter}
+	resp.ResponseWriter = w
+	h := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		req.Request = r
+		chain.ProcessFilter(req, resp)
+	})
+	httpsec.WrapHandler(h, span, req.PathParameters()).ServeHTTP(w, req.Request)
+}
+
+// responseWriter wraps the restful response writer to monitor the response
+// status code and to sample the response body, as expected by httpsec.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	body   httpsec.ResponseBodySample
+}
+
+// WriteHeader implements http.ResponseWriter interface method to monitor the
+// response status code.
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter interface method to sample the written
+// response body.
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher interface method when the wrapped response
+// writer does.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Status returns the response status code, or 0 when not written yet.
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+// ResponseBodySample returns the sample of the written response body.
+func (w *responseWriter) ResponseBodySample() []byte {
+	return w.body.Bytes()
+}
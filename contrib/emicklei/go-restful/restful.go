@@ -13,6 +13,7 @@ import (
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 
 	"github.com/emicklei/go-restful"
@@ -45,7 +46,11 @@ func FilterFunc(configOpts ...Option) restful.FilterFunction {
 		// pass the span through the request context
 		req.Request = req.Request.WithContext(ctx)
 
-		chain.ProcessFilter(req, resp)
+		if appsec.Enabled() {
+			processFilterWithAppSec(req, resp, chain, span)
+		} else {
+			chain.ProcessFilter(req, resp)
+		}
 
 		span.SetTag(ext.HTTPCode, strconv.Itoa(resp.StatusCode()))
 		span.SetTag(ext.Error, resp.Error())
@@ -69,7 +74,11 @@ func Filter(req *restful.Request, resp *restful.Response, chain *restful.FilterC
 	// pass the span through the request context
 	req.Request = req.Request.WithContext(ctx)
 
-	chain.ProcessFilter(req, resp)
+	if appsec.Enabled() {
+		processFilterWithAppSec(req, resp, chain, span)
+	} else {
+		chain.ProcessFilter(req, resp)
+	}
 
 	span.SetTag(ext.HTTPCode, strconv.Itoa(resp.StatusCode()))
 	span.SetTag(ext.Error, resp.Error())
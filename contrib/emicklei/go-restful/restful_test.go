@@ -14,9 +14,11 @@ import (
 	"github.com/emicklei/go-restful"
 	"github.com/stretchr/testify/assert"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/appsectest"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/globalconfig"
 )
 
@@ -176,3 +178,25 @@ func TestAnalyticsSettings(t *testing.T) {
 		assertRate(t, mt, 0.23, WithAnalyticsRate(0.23))
 	})
 }
+
+func TestAppSec(t *testing.T) {
+	appsec.Start()
+	defer appsec.Stop()
+	if !appsec.Enabled() {
+		t.Skip("appsec disabled")
+	}
+
+	ws := new(restful.WebService)
+	ws.Filter(FilterFunc())
+	handler := func(request *restful.Request, response *restful.Response) {
+		response.Write([]byte(appsectest.ResponseBody))
+	}
+	ws.Route(ws.GET("/").To(handler))
+	ws.Route(ws.GET("/path/{" + appsectest.PathParam + "}").To(handler))
+	container := restful.NewContainer()
+	container.Add(ws)
+	srv := httptest.NewServer(container)
+	defer srv.Close()
+
+	appsectest.Run(t, srv.URL, appsectest.Config{PathParams: true})
+}
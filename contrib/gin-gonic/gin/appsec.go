@@ -0,0 +1,123 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package gin
+
+import (
+	"net"
+	"net/http"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/httpsec"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/sharedsec"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// useAppSec monitors the execution of the next handlers of the given gin
+// context with AppSec. The request is aborted with the blocking response when
+// AppSec blocks it before the handlers get called, or while they are running
+// if they didn't write any response yet.
+// The request bodies bound by the handlers are only monitored when bound with
+// a binding wrapped by WrapBinding.
+func useAppSec(c *gin.Context, span tracer.Span) {
+	req := c.Request
+	httpsec.SetAppSecTags(span)
+	var params map[string]string
+	if len(c.Params) > 0 {
+		params = make(map[string]string, len(c.Params))
+		for _, p := range c.Params {
+			params[p.Key] = p.Value
+		}
+	}
+	args := httpsec.MakeHandlerOperationArgs(req, params)
+	op := httpsec.StartOperation(args, nil)
+	c.Request = req.WithContext(sharedsec.ContextWithOperation(req.Context(), op))
+	body := &bodySampler{ResponseWriter: c.Writer}
+	c.Writer = body
+	defer func() {
+		events := op.Finish(httpsec.HandlerOperationRes{
+			Status:  c.Writer.Status(),
+			Headers: httpsec.MakeResponseHeaders(c.Writer.Header()),
+			Body:    body.sample.Bytes(),
+		})
+		httpsec.SetTags(span, op.Tags())
+		if len(events) > 0 {
+			remoteIP, _, err := net.SplitHostPort(req.RemoteAddr)
+			if err != nil {
+				remoteIP = req.RemoteAddr
+			}
+			httpsec.SetSecurityEventTags(span, events, remoteIP, args.Headers, c.Writer.Header())
+		}
+	}()
+	if h := op.BlockingHandler(); h != nil {
+		httpsec.SetBlockedTags(span)
+		h.ServeHTTP(c.Writer, c.Request)
+		c.Abort()
+		return
+	}
+	c.Next()
+	if h := op.BlockingHandler(); h != nil {
+		// The operation got blocked while the handlers were running
+		httpsec.SetBlockedTags(span)
+		if !c.Writer.Written() {
+			h.ServeHTTP(c.Writer, c.Request)
+		}
+	}
+}
+
+// WrapBinding returns a gin binding monitoring with AppSec the values the
+// request bodies are bound to by the given binding. Gin doesn't let the
+// middleware monitor the bodies bound by the handlers, which need to bind them
+// with the wrapped binding, as in:
+//
+//	b := binding.Default(c.Request.Method, c.ContentType())
+//	if err := c.ShouldBindWith(&body, WrapBinding(b)); err != nil {
+//		...
+//	}
+//
+// The returned binding returns an error when AppSec blocks the request so that
+// the handler stops processing it.
+func WrapBinding(b binding.Binding) binding.Binding {
+	if _, ok := b.(appsecBinding); ok {
+		return b
+	}
+	return appsecBinding{Binding: b}
+}
+
+// appsecBinding is a gin binding monitoring the values the request bodies are
+// bound to.
+type appsecBinding struct {
+	binding.Binding
+}
+
+// Bind implements binding.Binding interface method to monitor the bound value.
+func (b appsecBinding) Bind(req *http.Request, obj interface{}) error {
+	if err := b.Binding.Bind(req, obj); err != nil {
+		return err
+	}
+	return httpsec.MonitorParsedBody(req.Context(), obj)
+}
+
+// bodySampler wraps the gin response writer to sample the response body.
+type bodySampler struct {
+	gin.ResponseWriter
+	sample httpsec.ResponseBodySample
+}
+
+// Write implements http.ResponseWriter interface method to sample the written
+// response body.
+func (w *bodySampler) Write(b []byte) (int, error) {
+	w.sample.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// WriteString implements gin.ResponseWriter interface method to sample the
+// written response body.
+func (w *bodySampler) WriteString(s string) (int, error) {
+	w.sample.Write([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
@@ -15,6 +15,7 @@ import (
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 
 	"github.com/gin-gonic/gin"
@@ -54,7 +55,11 @@ func Middleware(service string, opts ...Option) gin.HandlerFunc {
 		c.Request = c.Request.WithContext(ctx)
 
 		// serve the request to the next middleware
-		c.Next()
+		if appsec.Enabled() {
+			useAppSec(c, span)
+		} else {
+			c.Next()
+		}
 
 		status := c.Writer.Status()
 		span.SetTag(ext.HTTPCode, strconv.Itoa(status))
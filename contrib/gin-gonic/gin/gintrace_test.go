@@ -9,17 +9,22 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/appsectest"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/globalconfig"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func init() {
@@ -460,3 +465,86 @@ func TestServiceName(t *testing.T) {
 		assert.Equal("my-service", span.Tag(ext.ServiceName))
 	})
 }
+
+func TestAppSec(t *testing.T) {
+	appsec.Start()
+	defer appsec.Stop()
+	if !appsec.Enabled() {
+		t.Skip("appsec disabled")
+	}
+
+	router := gin.New()
+	router.Use(Middleware("appsec"))
+	handler := func(c *gin.Context) {
+		c.String(200, appsectest.ResponseBody)
+	}
+	router.GET("/", handler)
+	router.GET("/path/:"+appsectest.PathParam, handler)
+	router.POST("/body", func(c *gin.Context) {
+		var body struct {
+			Name string `json:"name"`
+		}
+		if err := c.ShouldBindWith(&body, WrapBinding(binding.JSON)); err != nil {
+			c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		c.String(200, "Hello "+body.Name+"!\n")
+	})
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	appsectest.Run(t, srv.URL, appsectest.Config{PathParams: true})
+
+	// Test a shell code attack via the bound request body
+	t.Run("request-body", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+		// Send a shell code attack (according to appsec rule id crs-932-160)
+		req, err := http.NewRequest("POST", srv.URL+"/body", strings.NewReader(`{"name":"/etc/passwd"}`))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		res, err := srv.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		// The span should contain the security event
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 1)
+		event := spans[0].Tag("_dd.appsec.json").(string)
+		require.True(t, strings.Contains(event, "crs-932-160"))
+		require.True(t, strings.Contains(event, "server.request.body"))
+	})
+
+	t.Run("blocking", func(t *testing.T) {
+		// Replace the rules with a rule blocking the Arachni security scanner
+		require.NoError(t, appsec.UpdateRules([]byte(`{
+			"version": "2.1",
+			"rules": [{
+				"id": "ua0-600-12x",
+				"name": "Arachni",
+				"tags": {"type": "security_scanner", "category": "attack_attempt"},
+				"conditions": [{
+					"operator": "match_regex",
+					"parameters": {"inputs": [{"address": "server.request.headers.no_cookies", "key_path": ["user-agent"]}], "regex": "^Arachni"}
+				}],
+				"transformers": [],
+				"on_match": ["block"]
+			}]
+		}`)))
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		req, err := http.NewRequest("GET", srv.URL+"/", nil)
+		require.NoError(t, err)
+		req.Header.Set("User-Agent", "Arachni/v1")
+		res, err := srv.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 1)
+		require.Equal(t, true, spans[0].Tag("appsec.blocked"))
+		require.Equal(t, "403", spans[0].Tag(ext.HTTPCode))
+	})
+}
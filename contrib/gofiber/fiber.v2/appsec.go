@@ -0,0 +1,172 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package fiber
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/httpsec"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/sharedsec"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// useAppSec monitors the execution of the next handlers of the given fiber
+// context with AppSec. The response is replaced with the blocking response
+// when AppSec blocks the request, which is always possible as fiber buffers
+// the response until the handlers return.
+// The path parameters are monitored once the handlers returned, as the route
+// of the request is not known yet when the middleware is called.
+func useAppSec(c *fiber.Ctx, span tracer.Span) error {
+	httpsec.SetAppSecTags(span)
+	args := makeHandlerOperationArgs(c)
+	op := httpsec.StartOperation(args, nil)
+	c.SetUserContext(sharedsec.ContextWithOperation(c.UserContext(), op))
+	defer func() {
+		res := makeHandlerOperationRes(c)
+		events := op.Finish(res)
+		httpsec.SetTags(span, op.Tags())
+		if len(events) > 0 {
+			remoteIP, _, err := net.SplitHostPort(c.Context().RemoteAddr().String())
+			if err != nil {
+				remoteIP = c.Context().RemoteAddr().String()
+			}
+			httpsec.SetSecurityEventTags(span, events, remoteIP, args.Headers, res.Headers)
+		}
+	}()
+	if h := op.BlockingHandler(); h != nil {
+		httpsec.SetBlockedTags(span)
+		block(c, h)
+		return nil
+	}
+	err := c.Next()
+	if h := op.BlockingHandler(); h != nil {
+		// The operation got blocked while the handlers were running
+		httpsec.SetBlockedTags(span)
+		c.Response().Reset()
+		block(c, h)
+		return nil
+	}
+	return err
+}
+
+// makeHandlerOperationArgs creates the HandlerOperationArgs out of the fiber
+// request. The values are copied as fiber reuses its buffers once the request
+// is handled.
+func makeHandlerOperationArgs(c *fiber.Ctx) httpsec.HandlerOperationArgs {
+	headers := make(map[string][]string)
+	var cookies []string
+	c.Request().Header.VisitAll(func(k, v []byte) {
+		key := strings.ToLower(string(k))
+		if key == "cookie" {
+			// Do not include cookies in the request headers
+			cookies = append(cookies, string(v))
+			return
+		}
+		headers[key] = append(headers[key], string(v))
+	})
+	var query map[string][]string
+	if args := c.Request().URI().QueryArgs(); args.Len() > 0 {
+		query = make(map[string][]string, args.Len())
+		args.VisitAll(func(k, v []byte) {
+			query[string(k)] = append(query[string(k)], string(v))
+		})
+	}
+	return httpsec.HandlerOperationArgs{
+		RequestURI: string(c.Request().RequestURI()),
+		Headers:    headers,
+		Cookies:    cookies,
+		Query:      query,
+		ClientIP:   httpsec.ClientIP(headers, c.Context().RemoteAddr().String()),
+	}
+}
+
+// makeHandlerOperationRes creates the HandlerOperationRes out of the fiber
+// response.
+func makeHandlerOperationRes(c *fiber.Ctx) httpsec.HandlerOperationRes {
+	headers := make(map[string][]string)
+	c.Response().Header.VisitAll(func(k, v []byte) {
+		key := strings.ToLower(string(k))
+		if key == "set-cookie" {
+			// Do not include cookies in the response headers
+			return
+		}
+		headers[key] = append(headers[key], string(v))
+	})
+	var body httpsec.ResponseBodySample
+	body.Write(c.Response().Body())
+	return httpsec.HandlerOperationRes{
+		Status:     c.Response().StatusCode(),
+		Headers:    headers,
+		Body:       body.Bytes(),
+		PathParams: makePathParams(c),
+	}
+}
+
+// makePathParams returns the path parameters of the route of the request,
+// which is the route of the last handler called once the handlers returned.
+// The values are copied as fiber reuses its buffers once the request is
+// handled.
+func makePathParams(c *fiber.Ctx) map[string]string {
+	route := c.Route()
+	if route == nil || len(route.Params) == 0 {
+		return nil
+	}
+	params := make(map[string]string, len(route.Params))
+	for _, p := range route.Params {
+		params[p] = utils.CopyString(c.Params(p))
+	}
+	return params
+}
+
+// block writes the response of the given blocking handler into the fiber
+// response.
+func block(c *fiber.Ctx, h http.Handler) {
+	r := &http.Request{
+		Method: c.Method(),
+		Header: http.Header{"Accept": {c.Get(fiber.HeaderAccept)}},
+	}
+	h.ServeHTTP(&responseWriter{c: c, header: make(http.Header)}, r)
+}
+
+// responseWriter adapts the fiber response to the http.ResponseWriter
+// interface expected by the blocking handler.
+type responseWriter struct {
+	c           *fiber.Ctx
+	header      http.Header
+	wroteHeader bool
+}
+
+// Header implements http.ResponseWriter interface method.
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader implements http.ResponseWriter interface method by setting the
+// response headers and status code into the fiber response.
+func (w *responseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	for k, values := range w.header {
+		for _, v := range values {
+			w.c.Response().Header.Add(k, v)
+		}
+	}
+	w.c.Status(status)
+}
+
+// Write implements http.ResponseWriter interface method by writing into the
+// fiber response body.
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.c.Write(b)
+}
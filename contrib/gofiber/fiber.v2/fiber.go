@@ -17,6 +17,7 @@ import (
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 )
 
@@ -56,7 +57,12 @@ func Middleware(opts ...Option) func(c *fiber.Ctx) error {
 		span.SetTag(ext.ResourceName, resourceName)
 
 		// pass the execution down the line
-		err := c.Next()
+		var err error
+		if appsec.Enabled() {
+			err = useAppSec(c, span)
+		} else {
+			err = c.Next()
+		}
 
 		status := c.Response().StatusCode()
 		// on the off chance we don't yet have a status after the rest of the things have run
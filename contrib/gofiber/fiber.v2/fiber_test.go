@@ -7,17 +7,21 @@ package fiber
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/appsectest"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/globalconfig"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestChildSpan(t *testing.T) {
@@ -277,3 +281,61 @@ func TestAnalyticsSettings(t *testing.T) {
 		assertRate(t, mt, 0.23, WithAnalyticsRate(0.23))
 	})
 }
+
+func TestAppSec(t *testing.T) {
+	appsec.Start()
+	defer appsec.Stop()
+	if !appsec.Enabled() {
+		t.Skip("appsec disabled")
+	}
+
+	app := fiber.New()
+	app.Use(Middleware())
+	handler := func(c *fiber.Ctx) error {
+		return c.SendString(appsectest.ResponseBody)
+	}
+	app.Get("/", handler)
+	app.Get("/path/:"+appsectest.PathParam, handler)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln)
+	defer app.Shutdown()
+	srvURL := "http://" + ln.Addr().String()
+
+	appsectest.Run(t, srvURL, appsectest.Config{PathParams: true})
+
+	t.Run("blocking", func(t *testing.T) {
+		// Replace the rules with a rule blocking the Arachni security scanner
+		require.NoError(t, appsec.UpdateRules([]byte(`{
+			"version": "2.1",
+			"rules": [{
+				"id": "ua0-600-12x",
+				"name": "Arachni",
+				"tags": {"type": "security_scanner", "category": "attack_attempt"},
+				"conditions": [{
+					"operator": "match_regex",
+					"parameters": {"inputs": [{"address": "server.request.headers.no_cookies", "key_path": ["user-agent"]}], "regex": "^Arachni"}
+				}],
+				"transformers": [],
+				"on_match": ["block"]
+			}]
+		}`)))
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		req, err := http.NewRequest("GET", srvURL+"/", nil)
+		require.NoError(t, err)
+		req.Header.Set("User-Agent", "Arachni/v1")
+		req.Header.Set("Accept", "application/json")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+		require.Equal(t, "application/json", res.Header.Get("Content-Type"))
+
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 1)
+		require.Equal(t, true, spans[0].Tag("appsec.blocked"))
+		require.Equal(t, "403", spans[0].Tag(ext.HTTPCode))
+	})
+}
@@ -12,27 +12,44 @@ import (
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/grpcsec"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/httpsec"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/sharedsec"
 
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
+// errBlocked is the error returned to the client when AppSec blocks the RPC.
+var errBlocked = status.Error(codes.PermissionDenied, "request blocked by the security policy")
+
 // UnaryHandler wrapper to use when AppSec is enabled to monitor its execution.
 func appsecUnaryHandlerMiddleware(span ddtrace.Span, handler grpc.UnaryHandler) grpc.UnaryHandler {
 	httpsec.SetAppSecTags(span)
 	return func(ctx context.Context, req interface{}) (interface{}, error) {
-		op := grpcsec.StartHandlerOperation(grpcsec.HandlerOperationArgs{}, nil)
+		op := grpcsec.StartHandlerOperation(makeHandlerOperationArgs(ctx), nil)
+		ctx = sharedsec.ContextWithOperation(ctx, op)
 		defer func() {
 			events := op.Finish(grpcsec.HandlerOperationRes{})
+			httpsec.SetTags(span, op.Tags())
 			if len(events) == 0 {
 				return
 			}
 			setAppSecTags(ctx, span, events)
 		}()
-		defer grpcsec.StartReceiveOperation(grpcsec.ReceiveOperationArgs{}, op).Finish(grpcsec.ReceiveOperationRes{Message: req})
-		return handler(ctx, req)
+		grpcsec.StartReceiveOperation(grpcsec.ReceiveOperationArgs{}, op).Finish(grpcsec.ReceiveOperationRes{Message: req})
+		if op.Blocked() {
+			httpsec.SetBlockedTags(span)
+			return nil, errBlocked
+		}
+		res, err := handler(ctx, req)
+		if op.Blocked() {
+			httpsec.SetBlockedTags(span)
+			return nil, errBlocked
+		}
+		return res, err
 	}
 }
 
@@ -40,31 +57,66 @@ func appsecUnaryHandlerMiddleware(span ddtrace.Span, handler grpc.UnaryHandler)
 func appsecStreamHandlerMiddleware(span ddtrace.Span, handler grpc.StreamHandler) grpc.StreamHandler {
 	httpsec.SetAppSecTags(span)
 	return func(srv interface{}, stream grpc.ServerStream) error {
-		op := grpcsec.StartHandlerOperation(grpcsec.HandlerOperationArgs{}, nil)
+		op := grpcsec.StartHandlerOperation(makeHandlerOperationArgs(stream.Context()), nil)
 		defer func() {
 			events := op.Finish(grpcsec.HandlerOperationRes{})
+			httpsec.SetTags(span, op.Tags())
 			if len(events) == 0 {
 				return
 			}
 			setAppSecTags(stream.Context(), span, events)
 		}()
-		return handler(srv, appsecServerStream{ServerStream: stream, handlerOperation: op})
+		if op.Blocked() {
+			httpsec.SetBlockedTags(span)
+			return errBlocked
+		}
+		err := handler(srv, appsecServerStream{
+			ServerStream:     stream,
+			handlerOperation: op,
+			ctx:              sharedsec.ContextWithOperation(stream.Context(), op),
+		})
+		if op.Blocked() {
+			httpsec.SetBlockedTags(span)
+			return errBlocked
+		}
+		return err
 	}
 }
 
 type appsecServerStream struct {
 	grpc.ServerStream
 	handlerOperation *grpcsec.HandlerOperation
+	ctx              context.Context
+}
+
+// Context implements grpc.ServerStream interface method to return the stream
+// context holding the handler operation.
+func (ss appsecServerStream) Context() context.Context {
+	return ss.ctx
 }
 
 // RecvMsg implements grpc.ServerStream interface method to monitor its
-// execution with AppSec.
+// execution with AppSec. An error is returned when the RPC gets blocked so
+// that the handler stops processing the stream.
 func (ss appsecServerStream) RecvMsg(m interface{}) error {
 	op := grpcsec.StartReceiveOperation(grpcsec.ReceiveOperationArgs{}, ss.handlerOperation)
-	defer func() {
-		op.Finish(grpcsec.ReceiveOperationRes{Message: m})
-	}()
-	return ss.ServerStream.RecvMsg(m)
+	err := ss.ServerStream.RecvMsg(m)
+	op.Finish(grpcsec.ReceiveOperationRes{Message: m})
+	if ss.handlerOperation.Blocked() {
+		return errBlocked
+	}
+	return err
+}
+
+// makeHandlerOperationArgs creates the handler operation arguments out of the
+// incoming context metadata and peer address.
+func makeHandlerOperationArgs(ctx context.Context) grpcsec.HandlerOperationArgs {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var remoteAddr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remoteAddr = p.Addr.String()
+	}
+	return grpcsec.HandlerOperationArgs{ClientIP: httpsec.ClientIP(md, remoteAddr)}
 }
 
 // Set the AppSec tags when security events were found.
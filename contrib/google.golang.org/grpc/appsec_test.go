@@ -7,13 +7,19 @@ package grpc
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/waf"
 )
 
 func TestAppSec(t *testing.T) {
@@ -29,6 +35,14 @@ func TestAppSec(t *testing.T) {
 
 	client := rig.client
 
+	// The pure-Go rule engine of the degraded mode doesn't support the is_xss
+	// and is_sqli operators of the rules crs-941-100 and crs-942-100, while
+	// their attacks are still detected by other rules.
+	xssRule, sqliRule := "crs-941-100", "crs-942-100"
+	if _, degraded := waf.Degraded(); degraded {
+		xssRule, sqliRule = "crs-941-110", "crs-942-190"
+	}
+
 	t.Run("unary", func(t *testing.T) {
 		mt := mocktracer.Start()
 		defer mt.Stop()
@@ -45,7 +59,7 @@ func TestAppSec(t *testing.T) {
 		// The request should have the XSS attack attempt event (appsec rule id crs-941-100).
 		event := finished[0].Tag("_dd.appsec.json")
 		require.NotNil(t, event)
-		require.True(t, strings.Contains(event.(string), "crs-941-100"))
+		require.True(t, strings.Contains(event.(string), xssRule))
 	})
 
 	t.Run("stream", func(t *testing.T) {
@@ -85,7 +99,171 @@ func TestAppSec(t *testing.T) {
 		// events (appsec rule id crs-941-100, crs-942-100).
 		event := finished[5].Tag("_dd.appsec.json")
 		require.NotNil(t, event)
-		require.True(t, strings.Contains(event.(string), "crs-941-100"))
-		require.True(t, strings.Contains(event.(string), "crs-942-100"))
+		require.True(t, strings.Contains(event.(string), xssRule))
+		require.True(t, strings.Contains(event.(string), sqliRule))
+	})
+}
+
+// blockingRule is a security rule blocking the RPCs whose messages contain a
+// <script> tag.
+const blockingRule = `{
+  "version": "2.1",
+  "rules": [
+    {
+      "id": "block-001",
+      "name": "Block script tags",
+      "tags": {
+        "type": "xss",
+        "category": "attack_attempt"
+      },
+      "conditions": [
+        {
+          "operator": "match_regex",
+          "parameters": {
+            "inputs": [
+              { "address": "grpc.server.request.message" }
+            ],
+            "regex": "<script>"
+          }
+        }
+      ],
+      "transformers": [],
+      "on_match": ["block"]
+    }
+  ]
+}`
+
+func TestBlocking(t *testing.T) {
+	rulesFile, err := ioutil.TempFile("", "rules-*.json")
+	require.NoError(t, err)
+	defer os.Remove(rulesFile.Name())
+	_, err = rulesFile.WriteString(blockingRule)
+	require.NoError(t, err)
+	require.NoError(t, rulesFile.Close())
+	os.Setenv("DD_APPSEC_RULES", rulesFile.Name())
+	defer os.Unsetenv("DD_APPSEC_RULES")
+
+	appsec.Start()
+	defer appsec.Stop()
+	if !appsec.Enabled() {
+		t.Skip("appsec disabled")
+	}
+
+	rig, err := newRig(false)
+	require.NoError(t, err)
+	defer rig.Close()
+
+	client := rig.client
+
+	t.Run("unary", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		_, err := client.Ping(context.Background(), &FixtureRequest{Name: "<script>alert('xss');</script>"})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		finished := mt.FinishedSpans()
+		require.Len(t, finished, 1)
+		require.Equal(t, true, finished[0].Tag("appsec.blocked"))
+		require.Contains(t, finished[0].Tag("_dd.appsec.json"), "block-001")
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		stream, err := client.StreamPing(context.Background())
+		require.NoError(t, err)
+
+		err = stream.Send(&FixtureRequest{Name: "<script>alert('xss');</script>"})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		var serverSpan mocktracer.Span
+		for _, s := range mt.FinishedSpans() {
+			if s.OperationName() == "grpc.server" {
+				serverSpan = s
+			}
+		}
+		require.NotNil(t, serverSpan)
+		require.Equal(t, true, serverSpan.Tag("appsec.blocked"))
+	})
+}
+
+func TestRulesUpdate(t *testing.T) {
+	appsec.Start()
+	defer appsec.Stop()
+	if !appsec.Enabled() {
+		t.Skip("appsec disabled")
+	}
+
+	rig, err := newRig(false)
+	require.NoError(t, err)
+	defer rig.Close()
+
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	stream, err := rig.client.StreamPing(context.Background())
+	require.NoError(t, err)
+	err = stream.Send(&FixtureRequest{Name: "<script>alert('xss');</script>"})
+	require.NoError(t, err)
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "passed", res.Message)
+
+	// The messages received after the update are checked with the new rules
+	require.NoError(t, appsec.UpdateRules([]byte(blockingRule)))
+	err = stream.Send(&FixtureRequest{Name: "<script>alert('xss');</script>"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestDenylist(t *testing.T) {
+	appsec.Start()
+	defer appsec.Stop()
+	if !appsec.Enabled() {
+		t.Skip("appsec disabled")
+	}
+	require.NoError(t, appsec.UpdateRulesData([]byte(`{"rules_data":[{"id":"blocked_ips","type":"ip_with_expiration","on_match":["block"],"data":[{"value":"1.2.3.4","expiration":0}]}]}`)))
+
+	rig, err := newRig(false)
+	require.NoError(t, err)
+	defer rig.Close()
+
+	client := rig.client
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-forwarded-for", "1.2.3.4")
+
+	t.Run("unary", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		_, err := client.Ping(ctx, &FixtureRequest{Name: "hello"})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		finished := mt.FinishedSpans()
+		require.Len(t, finished, 1)
+		require.Equal(t, true, finished[0].Tag("appsec.blocked"))
+		require.Contains(t, finished[0].Tag("_dd.appsec.json"), "blocked_ips")
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		stream, err := client.StreamPing(ctx)
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("not-denylisted", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		_, err := client.Ping(context.Background(), &FixtureRequest{Name: "hello"})
+		require.NoError(t, err)
 	})
 }
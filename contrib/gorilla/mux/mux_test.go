@@ -14,6 +14,7 @@ import (
 	"strings"
 	"testing"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/appsectest"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -385,3 +386,22 @@ func TestAppSec(t *testing.T) {
 		require.True(t, strings.Contains(event, "server.request.path_params"))
 	})
 }
+
+func TestAppSecConformance(t *testing.T) {
+	appsec.Start()
+	defer appsec.Stop()
+	if !appsec.Enabled() {
+		t.Skip("appsec disabled")
+	}
+
+	router := NewRouter()
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(appsectest.ResponseBody))
+	}
+	router.HandleFunc("/", handler)
+	router.HandleFunc("/path/{"+appsectest.PathParam+"}", handler)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	appsectest.Run(t, srv.URL, appsectest.Config{PathParams: true})
+}
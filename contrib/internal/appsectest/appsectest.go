@@ -0,0 +1,96 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+// Package appsectest provides the AppSec conformance tests shared by the HTTP
+// framework integrations.
+package appsectest // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/appsectest"
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Response body the handlers of the tested server must write.
+const ResponseBody = "Hello World!\n"
+
+// PathParam is the name of the path parameter of the route the tested server
+// must register, using the framework syntax, for the URL paths /path/<value>,
+// along with a route for the root URL path /.
+const PathParam = "myPathParam"
+
+// Config of the conformance tests.
+type Config struct {
+	// PathParams must be true when the integration monitors the route path
+	// parameters.
+	PathParams bool
+}
+
+// Run the AppSec conformance tests against the given HTTP server URL. The
+// server must be traced by the tested integration, with AppSec started. Its
+// handlers must write ResponseBody.
+func Run(t *testing.T, srvURL string, cfg Config) {
+	t.Run("security-scanner", func(t *testing.T) {
+		// Send a security scanner attack (according to appsec rule id ua0-600-12x)
+		span := send(t, srvURL+"/", "Arachni/v1")
+		require.Equal(t, true, span.Tag("appsec.event"))
+		event, _ := span.Tag("_dd.appsec.json").(string)
+		require.Contains(t, event, "ua0-600-12x")
+		require.Contains(t, event, "server.request.headers.no_cookies")
+	})
+
+	if cfg.PathParams {
+		t.Run("path-params", func(t *testing.T) {
+			// Send a security scanner attack via path parameters (according to
+			// appsec rule id crs-913-120)
+			span := send(t, srvURL+"/path/appscan_fingerprint", "")
+			event, _ := span.Tag("_dd.appsec.json").(string)
+			require.Contains(t, event, "crs-913-120")
+			require.Contains(t, event, "server.request.path_params")
+			require.Contains(t, event, PathParam)
+		})
+	}
+
+	t.Run("no-attack", func(t *testing.T) {
+		span := send(t, srvURL+"/", "")
+		require.Nil(t, span.Tag("_dd.appsec.json"))
+		require.Nil(t, span.Tag("appsec.event"))
+	})
+}
+
+// send sends a GET request to the given URL, with the given user-agent when
+// not empty, and returns the web span of the request.
+func send(t *testing.T, url, userAgent string) mocktracer.Span {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, ResponseBody, string(b))
+
+	var spans []mocktracer.Span
+	for _, span := range mt.FinishedSpans() {
+		if span.Tag(ext.SpanType) == ext.SpanTypeWeb {
+			spans = append(spans, span)
+		}
+	}
+	require.Len(t, spans, 1)
+	require.Equal(t, 1, spans[0].Tag("_dd.appsec.enabled"))
+	return spans[0]
+}
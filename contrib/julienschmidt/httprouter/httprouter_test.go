@@ -10,9 +10,11 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/appsectest"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/globalconfig"
 
 	"github.com/julienschmidt/httprouter"
@@ -150,3 +152,22 @@ func handler200(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 func handler500(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	http.Error(w, "500!", http.StatusInternalServerError)
 }
+
+func TestAppSec(t *testing.T) {
+	appsec.Start()
+	defer appsec.Stop()
+	if !appsec.Enabled() {
+		t.Skip("appsec disabled")
+	}
+
+	router := New()
+	handler := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.Write([]byte(appsectest.ResponseBody))
+	}
+	router.GET("/", handler)
+	router.GET("/path/:"+appsectest.PathParam, handler)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	appsectest.Run(t, srv.URL, appsectest.Config{PathParams: true})
+}
@@ -6,10 +6,13 @@
 package echo
 
 import (
+	"bufio"
 	"net"
+	"net/http"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/httpsec"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/sharedsec"
 
 	"github.com/labstack/echo/v4"
 )
@@ -28,8 +31,16 @@ func withAppSec(next echo.HandlerFunc) echo.HandlerFunc {
 		}
 		args := httpsec.MakeHandlerOperationArgs(req, params)
 		op := httpsec.StartOperation(args, nil)
+		c.SetRequest(req.WithContext(sharedsec.ContextWithOperation(req.Context(), op)))
+		body := &bodySampler{ResponseWriter: c.Response().Writer}
+		c.Response().Writer = body
 		defer func() {
-			events := op.Finish(httpsec.HandlerOperationRes{Status: c.Response().Status})
+			events := op.Finish(httpsec.HandlerOperationRes{
+				Status:  c.Response().Status,
+				Headers: httpsec.MakeResponseHeaders(c.Response().Header()),
+				Body:    body.sample.Bytes(),
+			})
+			httpsec.SetTags(span, op.Tags())
 			if len(events) > 0 {
 				remoteIP, _, err := net.SplitHostPort(req.RemoteAddr)
 				if err != nil {
@@ -38,6 +49,87 @@ func withAppSec(next echo.HandlerFunc) echo.HandlerFunc {
 				httpsec.SetSecurityEventTags(span, events, remoteIP, args.Headers, c.Response().Writer.Header())
 			}
 		}()
-		return next(c)
+		if h := op.BlockingHandler(); h != nil {
+			httpsec.SetBlockedTags(span)
+			h.ServeHTTP(c.Response(), req)
+			return nil
+		}
+		err := next(c)
+		if h := op.BlockingHandler(); h != nil {
+			// The operation got blocked while the handler was running
+			httpsec.SetBlockedTags(span)
+			if !c.Response().Committed {
+				h.ServeHTTP(c.Response(), req)
+				return nil
+			}
+		}
+		return err
+	}
+}
+
+// WrapBinder returns an echo binder monitoring with AppSec the values the
+// request bodies are bound to by the given binder, or by echo's default binder
+// when nil. Echo doesn't let the middleware monitor the request bodies, so the
+// binder of the echo instance needs to be wrapped when setting it up, before
+// it serves requests:
+//
+//	e := echo.New()
+//	e.Use(Middleware())
+//	e.Binder = WrapBinder(e.Binder)
+//
+// The returned binder returns an error when AppSec blocks the request so that
+// the handler stops processing it.
+func WrapBinder(b echo.Binder) echo.Binder {
+	if b == nil {
+		b = &echo.DefaultBinder{}
+	}
+	if _, ok := b.(appsecBinder); ok {
+		return b
+	}
+	return appsecBinder{Binder: b}
+}
+
+// appsecBinder is an echo binder monitoring the values the request bodies are
+// bound to.
+type appsecBinder struct {
+	echo.Binder
+}
+
+// Bind implements echo.Binder interface method to monitor the bound value.
+// An error is returned when the request gets blocked so that the handler
+// stops processing the request.
+func (b appsecBinder) Bind(i interface{}, c echo.Context) error {
+	if err := b.Binder.Bind(i, c); err != nil {
+		return err
 	}
+	return httpsec.MonitorParsedBody(c.Request().Context(), i)
+}
+
+// bodySampler wraps the echo response writer to sample the response body.
+type bodySampler struct {
+	http.ResponseWriter
+	sample httpsec.ResponseBodySample
+}
+
+// Write implements http.ResponseWriter interface method to sample the written
+// response body.
+func (w *bodySampler) Write(b []byte) (int, error) {
+	w.sample.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher interface method the same way echo does.
+func (w *bodySampler) Flush() {
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+// Hijack implements http.Hijacker interface method the same way echo does.
+func (w *bodySampler) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// Unwrap returns the wrapped response writer, allowing http.ResponseController
+// to access its features.
+func (w *bodySampler) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
@@ -10,9 +10,11 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/appsectest"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
@@ -282,6 +284,7 @@ func TestAppSec(t *testing.T) {
 	// Start and trace an HTTP server
 	e := echo.New()
 	e.Use(Middleware())
+	e.Binder = WrapBinder(e.Binder)
 
 	// Add some testing routes
 	e.POST("/path0.0/:myPathParam0/path0.1/:myPathParam1/path0.2/:myPathParam2/path0.3/*myPathParam3", func(c echo.Context) error {
@@ -290,9 +293,37 @@ func TestAppSec(t *testing.T) {
 	e.POST("/", func(c echo.Context) error {
 		return c.String(200, "Hello World!\n")
 	})
+	e.POST("/body", func(c echo.Context) error {
+		var body struct {
+			Name string `json:"name"`
+		}
+		if err := c.Bind(&body); err != nil {
+			return err
+		}
+		return c.String(200, "Hello "+body.Name+"!\n")
+	})
 	srv := httptest.NewServer(e)
 	defer srv.Close()
 
+	// Test a shell code attack via the bound request body
+	t.Run("request-body", func(t *testing.T) {
+		mt := mocktracer.Start()
+		defer mt.Stop()
+		// Send a shell code attack (according to appsec rule id crs-932-160)
+		req, err := http.NewRequest("POST", srv.URL+"/body", strings.NewReader(`{"name":"/etc/passwd"}`))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		res, err := srv.Client().Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		// The span should contain the security event
+		finished := mt.FinishedSpans()
+		require.Len(t, finished, 1)
+		event := finished[0].Tag("_dd.appsec.json").(string)
+		require.True(t, strings.Contains(event, "crs-932-160"))
+		require.True(t, strings.Contains(event, "server.request.body"))
+	})
+
 	// Test an LFI attack via path parameters
 	t.Run("request-uri", func(t *testing.T) {
 		mt := mocktracer.Start()
@@ -369,3 +400,68 @@ func TestAppSec(t *testing.T) {
 		})
 	})
 }
+
+func TestAppSecBlocking(t *testing.T) {
+	const blockingRule = `{"version":"2.1","rules":[{"id":"ua0-600-12x","name":"Arachni","tags":{"type":"security_scanner","category":"attack_attempt"},"conditions":[{"operator":"match_regex","parameters":{"inputs":[{"address":"server.request.headers.no_cookies","key_path":["user-agent"]}],"regex":"^Arachni"}}],"transformers":[],"on_match":["block"]}]}`
+	rulesFile, err := ioutil.TempFile("", "rules-*.json")
+	require.NoError(t, err)
+	defer os.Remove(rulesFile.Name())
+	_, err = rulesFile.WriteString(blockingRule)
+	require.NoError(t, err)
+	require.NoError(t, rulesFile.Close())
+	os.Setenv("DD_APPSEC_RULES", rulesFile.Name())
+	defer os.Unsetenv("DD_APPSEC_RULES")
+
+	appsec.Start()
+	defer appsec.Stop()
+	if !appsec.Enabled() {
+		t.Skip("appsec disabled")
+	}
+
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	var called bool
+	e := echo.New()
+	e.Use(Middleware())
+	e.GET("/", func(c echo.Context) error {
+		called = true
+		return c.String(200, "Hello World!\n")
+	})
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("User-Agent", "Arachni/v1")
+	res, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.False(t, called)
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+	finished := mt.FinishedSpans()
+	require.Len(t, finished, 1)
+	require.Equal(t, true, finished[0].Tag("appsec.blocked"))
+	require.Equal(t, "403", finished[0].Tag(ext.HTTPCode))
+}
+
+func TestAppSecConformance(t *testing.T) {
+	appsec.Start()
+	defer appsec.Stop()
+	if !appsec.Enabled() {
+		t.Skip("appsec disabled")
+	}
+
+	e := echo.New()
+	e.Use(Middleware())
+	handler := func(c echo.Context) error {
+		return c.String(http.StatusOK, appsectest.ResponseBody)
+	}
+	e.GET("/", handler)
+	e.GET("/path/:"+appsectest.PathParam, handler)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	appsectest.Run(t, srv.URL, appsectest.Config{PathParams: true})
+}
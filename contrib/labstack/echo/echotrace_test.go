@@ -11,9 +11,11 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/appsectest"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec"
 
 	"github.com/labstack/echo"
 	"github.com/stretchr/testify/assert"
@@ -266,3 +268,23 @@ func TestNoDebugStack(t *testing.T) {
 	assert.Equal(wantErr.Error(), span.Tag(ext.Error).(error).Error())
 	assert.Equal("<debug stack disabled>", span.Tag(ext.ErrorStack))
 }
+
+func TestAppSec(t *testing.T) {
+	appsec.Start()
+	defer appsec.Stop()
+	if !appsec.Enabled() {
+		t.Skip("appsec disabled")
+	}
+
+	e := echo.New()
+	e.Use(Middleware())
+	handler := func(c echo.Context) error {
+		return c.String(http.StatusOK, appsectest.ResponseBody)
+	}
+	e.GET("/", handler)
+	e.GET("/path/:"+appsectest.PathParam, handler)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	appsectest.Run(t, srv.URL, appsectest.Config{PathParams: true})
+}
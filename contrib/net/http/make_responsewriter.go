@@ -64,6 +64,7 @@ func wrapResponseWriter(w http.ResponseWriter, span ddtrace.Span) http.ResponseW
 	type monitoredResponseWriter interface {
 		http.ResponseWriter
 		Status() int
+		ResponseBodySample() []byte
 	}
 	switch {
 {{- range .Combinations }}
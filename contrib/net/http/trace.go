@@ -73,15 +73,22 @@ func TraceAndServe(h http.Handler, w http.ResponseWriter, r *http.Request, cfg *
 }
 
 // responseWriter is a small wrapper around an http response writer that will
-// intercept and store the status of a request.
+// intercept and store the status of a request. When AppSec is enabled, it also
+// samples the beginning of the response body if the AppSec response body
+// monitoring is enabled with DD_APPSEC_RESPONSE_BODY_ENABLED.
 type responseWriter struct {
 	http.ResponseWriter
 	span   ddtrace.Span
 	status int
+	body   *httpsec.ResponseBodySample
 }
 
 func newResponseWriter(w http.ResponseWriter, span ddtrace.Span) *responseWriter {
-	return &responseWriter{w, span, 0}
+	rw := &responseWriter{ResponseWriter: w, span: span}
+	if appsec.Enabled() {
+		rw.body = new(httpsec.ResponseBodySample)
+	}
+	return rw
 }
 
 // Status returns the status code that was monitored.
@@ -89,6 +96,15 @@ func (w *responseWriter) Status() int {
 	return w.status
 }
 
+// ResponseBodySample returns the sample of the response body, which is nil
+// when AppSec is disabled.
+func (w *responseWriter) ResponseBodySample() []byte {
+	if w.body == nil {
+		return nil
+	}
+	return w.body.Bytes()
+}
+
 // Write writes the data to the connection as part of an HTTP reply.
 // We explicitly call WriteHeader with the 200 status code
 // in order to get it reported into the span.
@@ -96,6 +112,9 @@ func (w *responseWriter) Write(b []byte) (int, error) {
 	if w.status == 0 {
 		w.WriteHeader(http.StatusOK)
 	}
+	if w.body != nil {
+		w.body.Write(b)
+	}
 	return w.ResponseWriter.Write(b)
 }
 
@@ -31,6 +31,7 @@ func wrapResponseWriter(w http.ResponseWriter, span ddtrace.Span) http.ResponseW
 	type monitoredResponseWriter interface {
 		http.ResponseWriter
 		Status() int
+		ResponseBodySample() []byte
 	}
 	switch {
 	case okFlusher && okPusher && okCloseNotifier && okHijacker:
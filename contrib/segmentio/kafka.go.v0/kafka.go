@@ -0,0 +1,188 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+// Package kafka provides functions to trace the segmentio/kafka-go package (https://github.com/segmentio/kafka-go).
+package kafka // import "gopkg.in/DataDog/dd-trace-go.v1/contrib/segmentio/kafka.go.v0"
+
+import (
+	"context"
+	"math"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// NewReader calls kafka.NewReader and wraps the resulting Reader.
+func NewReader(conf kafka.ReaderConfig, opts ...Option) *Reader {
+	return WrapReader(kafka.NewReader(conf), opts...)
+}
+
+// NewWriter calls kafka.NewWriter and wraps the resulting Writer.
+func NewWriter(conf kafka.WriterConfig, opts ...Option) *Writer {
+	return WrapWriter(kafka.NewWriter(conf), opts...)
+}
+
+// A Reader wraps a kafka.Reader.
+type Reader struct {
+	*kafka.Reader
+	cfg  *config
+	prev ddtrace.Span
+}
+
+// WrapReader wraps a kafka.Reader so that any consumed messages are traced.
+func WrapReader(r *kafka.Reader, opts ...Option) *Reader {
+	wrapped := &Reader{
+		Reader: r,
+		cfg:    newConfig(opts...),
+	}
+	log.Debug("contrib/segmentio/kafka.go.v0: Wrapping Reader: %#v", wrapped.cfg)
+	return wrapped
+}
+
+func (r *Reader) startSpan(ctx context.Context, msg *kafka.Message) ddtrace.Span {
+	opts := []tracer.StartSpanOption{
+		tracer.ServiceName(r.cfg.consumerServiceName),
+		tracer.ResourceName("Consume Topic " + msg.Topic),
+		tracer.SpanType(ext.SpanTypeMessageConsumer),
+		tracer.Tag("partition", msg.Partition),
+		tracer.Tag("offset", msg.Offset),
+		tracer.Measured(),
+	}
+	if !math.IsNaN(r.cfg.analyticsRate) {
+		opts = append(opts, tracer.Tag(ext.EventSampleRate, r.cfg.analyticsRate))
+	}
+	// kafka supports headers, so try to extract a span context, which takes
+	// precedence over the span of the consumer context
+	carrier := NewMessageCarrier(msg)
+	if spanctx, err := tracer.Extract(carrier); err == nil {
+		opts = append(opts, tracer.ChildOf(spanctx))
+	} else if parent, ok := tracer.SpanFromContext(ctx); ok {
+		opts = append(opts, tracer.ChildOf(parent.Context()))
+	}
+	span := tracer.StartSpan("kafka.consume", opts...)
+	// reinject the span context so consumers can pick it up
+	tracer.Inject(span.Context(), carrier)
+	return span
+}
+
+// finishPrev finishes the span of the previously consumed message, if any.
+func (r *Reader) finishPrev() {
+	if r.prev != nil {
+		r.prev.Finish()
+		r.prev = nil
+	}
+}
+
+// Close calls the underlying Reader.Close and finishes any remaining span.
+func (r *Reader) Close() error {
+	err := r.Reader.Close()
+	r.finishPrev()
+	return err
+}
+
+// ReadMessage reads and returns the next message from the Reader, committing
+// its offset when a consumer group is used. The message will be traced, and
+// its span will be finished on the next call to the Reader.
+func (r *Reader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	r.finishPrev()
+	msg, err := r.Reader.ReadMessage(ctx)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	r.prev = r.startSpan(ctx, &msg)
+	return msg, nil
+}
+
+// FetchMessage reads and returns the next message from the Reader without
+// committing its offset. The message will be traced, and its span will be
+// finished on the next call to the Reader, including CommitMessages.
+func (r *Reader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.finishPrev()
+	msg, err := r.Reader.FetchMessage(ctx)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	r.prev = r.startSpan(ctx, &msg)
+	return msg, nil
+}
+
+// CommitMessages calls the underlying Reader.CommitMessages. Committing marks
+// the end of the processing of the last fetched message, so its span is
+// finished.
+func (r *Reader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	err := r.Reader.CommitMessages(ctx, msgs...)
+	r.finishPrev()
+	return err
+}
+
+// A Writer wraps a kafka.Writer.
+type Writer struct {
+	*kafka.Writer
+	cfg *config
+}
+
+// WrapWriter wraps a kafka.Writer so that all produced messages are traced.
+func WrapWriter(w *kafka.Writer, opts ...Option) *Writer {
+	wrapped := &Writer{
+		Writer: w,
+		cfg:    newConfig(opts...),
+	}
+	log.Debug("contrib/segmentio/kafka.go.v0: Wrapping Writer: %#v", wrapped.cfg)
+	return wrapped
+}
+
+func (w *Writer) startSpan(ctx context.Context, msg *kafka.Message) ddtrace.Span {
+	// the topic is either set on the Writer or on each message, never both
+	topic := w.Writer.Topic
+	if topic == "" {
+		topic = msg.Topic
+	}
+	opts := []tracer.StartSpanOption{
+		tracer.ServiceName(w.cfg.producerServiceName),
+		tracer.ResourceName("Produce Topic " + topic),
+		tracer.SpanType(ext.SpanTypeMessageProducer),
+	}
+	if !math.IsNaN(w.cfg.analyticsRate) {
+		opts = append(opts, tracer.Tag(ext.EventSampleRate, w.cfg.analyticsRate))
+	}
+	// if there's a span context in the headers, use that as the parent over
+	// the span of the producer context
+	carrier := NewMessageCarrier(msg)
+	if spanctx, err := tracer.Extract(carrier); err == nil {
+		opts = append(opts, tracer.ChildOf(spanctx))
+	} else if parent, ok := tracer.SpanFromContext(ctx); ok {
+		opts = append(opts, tracer.ChildOf(parent.Context()))
+	}
+	span := tracer.StartSpan("kafka.produce", opts...)
+	// inject the span context so consumers can pick it up
+	tracer.Inject(span.Context(), carrier)
+	return span
+}
+
+func finishProducerSpan(span ddtrace.Span, partition int, offset int64, err error) {
+	span.SetTag("partition", partition)
+	span.SetTag("offset", offset)
+	span.Finish(tracer.WithError(err))
+}
+
+// WriteMessages calls the underlying Writer.WriteMessages and traces the
+// requests.
+func (w *Writer) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	// although there's only one call made to the Writer, the messages are
+	// treated individually, so we create a span for each one
+	spans := make([]ddtrace.Span, len(msgs))
+	for i := range msgs {
+		spans[i] = w.startSpan(ctx, &msgs[i])
+	}
+	err := w.Writer.WriteMessages(ctx, msgs...)
+	for i, span := range spans {
+		finishProducerSpan(span, msgs[i].Partition, msgs[i].Offset, err)
+	}
+	return err
+}
@@ -0,0 +1,190 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package kafka
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testGroupID = "gosegtest"
+	testTopic   = "gosegtest"
+)
+
+func TestMessageCarrier(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	msg := &kafka.Message{
+		Headers: []kafka.Header{{Key: "other", Value: []byte("value")}},
+	}
+	span := tracer.StartSpan("test")
+	carrier := NewMessageCarrier(msg)
+	assert.NoError(t, tracer.Inject(span.Context(), carrier))
+	// injecting twice must not duplicate headers
+	assert.NoError(t, tracer.Inject(span.Context(), carrier))
+	n := len(msg.Headers)
+	assert.NoError(t, tracer.Inject(span.Context(), carrier))
+	assert.Len(t, msg.Headers, n)
+
+	spanctx, err := tracer.Extract(NewMessageCarrier(msg))
+	assert.NoError(t, err)
+	assert.Equal(t, span.Context().TraceID(), spanctx.TraceID())
+	assert.Equal(t, span.Context().SpanID(), spanctx.SpanID())
+	assert.Equal(t, "other", msg.Headers[0].Key)
+}
+
+func TestReaderStartSpan(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	r := &Reader{cfg: newConfig()}
+	consumer, ctx := tracer.StartSpanFromContext(context.Background(), "consumer")
+	defer consumer.Finish()
+
+	t.Run("producer", func(t *testing.T) {
+		producer := tracer.StartSpan("producer")
+		defer producer.Finish()
+		msg := &kafka.Message{Topic: testTopic}
+		require.NoError(t, tracer.Inject(producer.Context(), NewMessageCarrier(msg)))
+
+		span := r.startSpan(ctx, msg)
+		span.Finish()
+		s := span.(mocktracer.Span)
+		// the span of the message producer takes precedence
+		assert.Equal(t, producer.Context().SpanID(), s.ParentID())
+		assert.Equal(t, producer.Context().TraceID(), s.TraceID())
+	})
+
+	t.Run("context", func(t *testing.T) {
+		span := r.startSpan(ctx, &kafka.Message{Topic: testTopic})
+		span.Finish()
+		s := span.(mocktracer.Span)
+		assert.Equal(t, consumer.Context().SpanID(), s.ParentID())
+	})
+}
+
+func TestWriterStartSpan(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	w := &Writer{Writer: &kafka.Writer{}, cfg: newConfig()}
+	producer, ctx := tracer.StartSpanFromContext(context.Background(), "producer")
+	defer producer.Finish()
+
+	t.Run("headers", func(t *testing.T) {
+		upstream := tracer.StartSpan("upstream")
+		defer upstream.Finish()
+		msg := &kafka.Message{Topic: testTopic}
+		require.NoError(t, tracer.Inject(upstream.Context(), NewMessageCarrier(msg)))
+
+		span := w.startSpan(ctx, msg)
+		span.Finish()
+		s := span.(mocktracer.Span)
+		// the span context of the message headers takes precedence
+		assert.Equal(t, upstream.Context().SpanID(), s.ParentID())
+		assert.Equal(t, upstream.Context().TraceID(), s.TraceID())
+	})
+
+	t.Run("context", func(t *testing.T) {
+		span := w.startSpan(ctx, &kafka.Message{Topic: testTopic})
+		span.Finish()
+		s := span.(mocktracer.Span)
+		assert.Equal(t, producer.Context().SpanID(), s.ParentID())
+	})
+}
+
+/*
+to run the integration test locally:
+
+    docker network create segmentio
+
+    docker run --rm \
+        --name zookeeper \
+        --network segmentio \
+        -p 2181:2181 \
+        -e ZOOKEEPER_CLIENT_PORT=2181 \
+        confluentinc/cp-zookeeper:5.0.0
+
+    docker run --rm \
+        --name kafka \
+        --network segmentio \
+        -p 9092:9092 \
+        -e KAFKA_ZOOKEEPER_CONNECT=zookeeper:2181 \
+        -e KAFKA_ADVERTISED_LISTENERS=PLAINTEXT://localhost:9092 \
+        -e KAFKA_LISTENERS=PLAINTEXT://0.0.0.0:9092 \
+        -e KAFKA_CREATE_TOPICS=gosegtest:1:1 \
+        -e KAFKA_OFFSETS_TOPIC_REPLICATION_FACTOR=1 \
+        confluentinc/cp-kafka:5.0.0
+*/
+
+func TestReadMessageFunctional(t *testing.T) {
+	if _, ok := os.LookupEnv("INTEGRATION"); !ok {
+		t.Skip("to enable integration test, set the INTEGRATION environment variable")
+	}
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	w := NewWriter(kafka.WriterConfig{
+		Brokers: []string{"localhost:9092"},
+		Topic:   testTopic,
+	}, WithAnalyticsRate(0.1))
+	msg1 := []kafka.Message{
+		{
+			Key:   []byte("key1"),
+			Value: []byte("value1"),
+		},
+	}
+	err := w.WriteMessages(context.Background(), msg1...)
+	require.NoError(t, err, "Expected to write message to topic")
+	w.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	r := NewReader(kafka.ReaderConfig{
+		Brokers: []string{"localhost:9092"},
+		GroupID: testGroupID,
+		Topic:   testTopic,
+	})
+	msg2, err := r.FetchMessage(ctx)
+	require.NoError(t, err, "Expected to consume message")
+	assert.Equal(t, msg1[0].Value, msg2.Value, "Values should be equal")
+	err = r.CommitMessages(ctx, msg2)
+	assert.NoError(t, err, "Expected to commit message")
+	r.Close()
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	// they should be linked via headers
+	assert.Equal(t, spans[0].TraceID(), spans[1].TraceID())
+
+	s0 := spans[0] // produce
+	assert.Equal(t, "kafka.produce", s0.OperationName())
+	assert.Equal(t, "kafka", s0.Tag(ext.ServiceName))
+	assert.Equal(t, "Produce Topic "+testTopic, s0.Tag(ext.ResourceName))
+	assert.Equal(t, 0.1, s0.Tag(ext.EventSampleRate))
+	assert.Equal(t, "queue", s0.Tag(ext.SpanType))
+	assert.Equal(t, 0, s0.Tag("partition"))
+
+	s1 := spans[1] // consume
+	assert.Equal(t, "kafka.consume", s1.OperationName())
+	assert.Equal(t, "kafka", s1.Tag(ext.ServiceName))
+	assert.Equal(t, "Consume Topic "+testTopic, s1.Tag(ext.ResourceName))
+	assert.Equal(t, nil, s1.Tag(ext.EventSampleRate))
+	assert.Equal(t, "queue", s1.Tag(ext.SpanType))
+	assert.Equal(t, 0, s1.Tag("partition"))
+}
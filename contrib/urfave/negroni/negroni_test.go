@@ -13,12 +13,15 @@ import (
 	"strconv"
 	"testing"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/contrib/internal/appsectest"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/globalconfig"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/urfave/negroni"
 )
 
@@ -358,3 +361,57 @@ func TestServiceName(t *testing.T) {
 		assertServiceName(t, mt, router, "my-service")
 	})
 }
+
+func TestAppSec(t *testing.T) {
+	appsec.Start()
+	defer appsec.Stop()
+	if !appsec.Enabled() {
+		t.Skip("appsec disabled")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(appsectest.ResponseBody))
+	})
+	router := negroni.New()
+	router.Use(Middleware())
+	router.UseHandler(mux)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	// Negroni has no routing, hence no path parameters
+	appsectest.Run(t, srv.URL, appsectest.Config{})
+
+	t.Run("blocking", func(t *testing.T) {
+		// Replace the rules with a rule blocking the Arachni security scanner
+		require.NoError(t, appsec.UpdateRules([]byte(`{
+			"version": "2.1",
+			"rules": [{
+				"id": "ua0-600-12x",
+				"name": "Arachni",
+				"tags": {"type": "security_scanner", "category": "attack_attempt"},
+				"conditions": [{
+					"operator": "match_regex",
+					"parameters": {"inputs": [{"address": "server.request.headers.no_cookies", "key_path": ["user-agent"]}], "regex": "^Arachni"}
+				}],
+				"transformers": [],
+				"on_match": ["block"]
+			}]
+		}`)))
+		mt := mocktracer.Start()
+		defer mt.Stop()
+
+		req, err := http.NewRequest("GET", srv.URL+"/", nil)
+		require.NoError(t, err)
+		req.Header.Set("User-Agent", "Arachni/v1")
+		res, err := srv.Client().Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+
+		spans := mt.FinishedSpans()
+		require.Len(t, spans, 1)
+		require.Equal(t, true, spans[0].Tag("appsec.blocked"))
+		require.Equal(t, "403", spans[0].Tag(ext.HTTPCode))
+	})
+}
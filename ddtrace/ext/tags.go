@@ -86,3 +86,20 @@ const (
 	// RuntimeID is a tag that contains a unique id for this process.
 	RuntimeID = "runtime-id"
 )
+
+const (
+	// UserID is the tag holding the ID of the authenticated user of the trace.
+	UserID = "usr.id"
+
+	// UserEmail is the tag holding the email of the authenticated user.
+	UserEmail = "usr.email"
+
+	// UserName is the tag holding the name of the authenticated user.
+	UserName = "usr.name"
+
+	// UserRole is the tag holding the role of the authenticated user.
+	UserRole = "usr.role"
+
+	// UserSessionID is the tag holding the session ID of the authenticated user.
+	UserSessionID = "usr.session_id"
+)
@@ -57,6 +57,10 @@ func StartSpanFromContext(ctx context.Context, operationName string, opts ...Sta
 		// includes them. Otherwise a child of this span wouldn't be able to
 		// correctly restore the labels of its parent when it finishes.
 		ctx = span.pprofCtxActive
+	} else if ok && span.taskCtx != nil {
+		// Likewise, use the derived ctx including the execution tracer task
+		// of this span, so that its children get child tasks.
+		ctx = span.taskCtx
 	}
 	return s, ContextWithSpan(ctx, s)
 }
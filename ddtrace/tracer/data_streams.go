@@ -0,0 +1,41 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"context"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/datastreams"
+)
+
+// SetDataStreamsCheckpoint sets a produce or consume checkpoint on the Data
+// Streams pathway found in ctx, or starts a new pathway when ctx holds none.
+// Edge tags describe the checkpoint, e.g. "direction:out", "topic:orders",
+// "type:kafka". The returned context holds the resulting pathway and should be
+// used to propagate it to the next checkpoint, for instance using
+// InjectDataStreamsPathway. It returns false and ctx unchanged when the tracer
+// is not started or Data Streams Monitoring is disabled, which is the default;
+// set DD_DATA_STREAMS_ENABLED=true to enable it.
+func SetDataStreamsCheckpoint(ctx context.Context, edgeTags ...string) (outCtx context.Context, ok bool) {
+	if t, ok := internal.GetGlobalTracer().(*tracer); ok && t.dataStreams != nil {
+		return t.dataStreams.SetCheckpoint(ctx, edgeTags...), true
+	}
+	return ctx, false
+}
+
+// InjectDataStreamsPathway propagates the Data Streams pathway found in ctx,
+// if any, into carrier, usually the headers or attributes of a message.
+func InjectDataStreamsPathway(ctx context.Context, carrier TextMapWriter) {
+	datastreams.InjectToCarrier(ctx, carrier)
+}
+
+// ExtractDataStreamsPathway returns a copy of ctx holding the Data Streams
+// pathway propagated in carrier, if any. The returned context can be passed to
+// SetDataStreamsCheckpoint to continue the pathway.
+func ExtractDataStreamsPathway(ctx context.Context, carrier TextMapReader) context.Context {
+	return datastreams.ExtractFromCarrier(ctx, carrier)
+}
@@ -0,0 +1,56 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package tracer
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/datastreams"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataStreamsCheckpoint(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		_, _, _, stop := startTestTracer(t)
+		defer stop()
+
+		ctx, ok := SetDataStreamsCheckpoint(context.Background(), "direction:out", "type:kafka")
+		assert.False(t, ok)
+		_, ok = datastreams.PathwayFromContext(ctx)
+		assert.False(t, ok)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		defer func(old string) { os.Setenv("DD_DATA_STREAMS_ENABLED", old) }(os.Getenv("DD_DATA_STREAMS_ENABLED"))
+		os.Setenv("DD_DATA_STREAMS_ENABLED", "true")
+		trc, _, _, stop := startTestTracer(t)
+		defer stop()
+		assert.NotNil(t, trc.dataStreams)
+
+		ctx, ok := SetDataStreamsCheckpoint(context.Background(), "direction:out", "type:kafka")
+		assert.True(t, ok)
+		produced, ok := datastreams.PathwayFromContext(ctx)
+		assert.True(t, ok)
+
+		// propagate the pathway through a carrier
+		carrier := TextMapCarrier{}
+		InjectDataStreamsPathway(ctx, carrier)
+		ctx = ExtractDataStreamsPathway(context.Background(), carrier)
+		extracted, ok := datastreams.PathwayFromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, produced.Hash(), extracted.Hash())
+
+		ctx, ok = SetDataStreamsCheckpoint(ctx, "direction:in", "type:kafka")
+		assert.True(t, ok)
+		consumed, ok := datastreams.PathwayFromContext(ctx)
+		assert.True(t, ok)
+		assert.NotEqual(t, produced.Hash(), consumed.Hash())
+		assert.Equal(t, extracted.PathwayStart(), consumed.PathwayStart())
+	})
+}
@@ -49,6 +49,7 @@ type startupInfo struct {
 	GlobalService               string            `json:"global_service"`                 // Global service string. If not-nil should be same as Service. (#614)
 	LambdaMode                  string            `json:"lambda_mode"`                    // Whether or not the client has enabled lambda mode
 	AppSec                      bool              `json:"appsec"`                         // AppSec status: true when started, false otherwise.
+	DataStreamsEnabled          bool              `json:"data_streams_enabled"`           // Whether or not Data Streams Monitoring is enabled
 	AgentFeatures               agentFeatures     `json:"agent_features"`                 // Lists the capabilities of the agent.
 }
 
@@ -103,6 +104,7 @@ func logStartup(t *tracer) {
 		LambdaMode:                  fmt.Sprintf("%t", t.config.logToStdout),
 		AgentFeatures:               t.config.agent,
 		AppSec:                      appsec.Enabled(),
+		DataStreamsEnabled:          t.dataStreams != nil,
 	}
 	if _, err := samplingRulesFromEnv(); err != nil {
 		info.SamplingRulesError = fmt.Sprintf("%s", err)
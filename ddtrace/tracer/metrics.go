@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/runtimemetrics"
 )
 
 // defaultMetricsReportInterval specifies the interval at which runtime metrics will
@@ -29,13 +30,18 @@ type statsdClient interface {
 // reportRuntimeMetrics periodically reports go runtime metrics at
 // the given interval.
 func (t *tracer) reportRuntimeMetrics(interval time.Duration) {
-	var ms runtime.MemStats
 	gc := debug.GCStats{
 		// When len(stats.PauseQuantiles) is 5, it will be filled with the
 		// minimum, 25%, 50%, 75%, and maximum pause times. See the documentation
 		// for (runtime/debug).ReadGCStats.
 		PauseQuantiles: make([]time.Duration, 5),
 	}
+	// The runtime.go.mem_stats gauges are derived from the runtime metrics,
+	// which only stop the world to be read before Go 1.16.
+	var prev runtimemetrics.Stats
+	if runtimemetrics.Supported {
+		prev = runtimemetrics.Read()
+	}
 
 	tick := time.NewTicker(interval)
 	defer tick.Stop()
@@ -43,8 +49,12 @@ func (t *tracer) reportRuntimeMetrics(interval time.Duration) {
 		select {
 		case <-tick.C:
 			log.Debug("Reporting runtime metrics...")
-			runtime.ReadMemStats(&ms)
+			rm := runtimemetrics.Read()
 			debug.ReadGCStats(&gc)
+			var lastGC int64
+			if !rm.LastGC.IsZero() {
+				lastGC = rm.LastGC.UnixNano()
+			}
 
 			statsd := t.config.statsd
 			// CPU statistics
@@ -52,40 +62,55 @@ func (t *tracer) reportRuntimeMetrics(interval time.Duration) {
 			statsd.Gauge("runtime.go.num_goroutine", float64(runtime.NumGoroutine()), nil, 1)
 			statsd.Gauge("runtime.go.num_cgo_call", float64(runtime.NumCgoCall()), nil, 1)
 			// General statistics
-			statsd.Gauge("runtime.go.mem_stats.alloc", float64(ms.Alloc), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.total_alloc", float64(ms.TotalAlloc), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.sys", float64(ms.Sys), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.lookups", float64(ms.Lookups), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.mallocs", float64(ms.Mallocs), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.frees", float64(ms.Frees), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.alloc", float64(rm.HeapObjectsBytes), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.total_alloc", float64(rm.HeapAllocBytes), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.sys", float64(rm.TotalBytes), nil, 1)
+			// The runtime doesn't count the pointer lookups anymore.
+			statsd.Gauge("runtime.go.mem_stats.lookups", 0, nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.mallocs", float64(rm.HeapAllocObjects), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.frees", float64(rm.HeapFreeObjects), nil, 1)
 			// Heap memory statistics
-			statsd.Gauge("runtime.go.mem_stats.heap_alloc", float64(ms.HeapAlloc), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.heap_sys", float64(ms.HeapSys), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.heap_idle", float64(ms.HeapIdle), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.heap_inuse", float64(ms.HeapInuse), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.heap_released", float64(ms.HeapReleased), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.heap_objects", float64(ms.HeapObjects), nil, 1)
+			heapInuse := rm.HeapObjectsBytes + rm.HeapUnusedBytes
+			heapIdle := rm.HeapFreeBytes + rm.HeapReleasedBytes
+			statsd.Gauge("runtime.go.mem_stats.heap_alloc", float64(rm.HeapObjectsBytes), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.heap_sys", float64(heapInuse+heapIdle), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.heap_idle", float64(heapIdle), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.heap_inuse", float64(heapInuse), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.heap_released", float64(rm.HeapReleasedBytes), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.heap_objects", float64(rm.HeapObjects), nil, 1)
 			// Stack memory statistics
-			statsd.Gauge("runtime.go.mem_stats.stack_inuse", float64(ms.StackInuse), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.stack_sys", float64(ms.StackSys), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.stack_inuse", float64(rm.StackBytes), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.stack_sys", float64(rm.StackBytes+rm.OSStackBytes), nil, 1)
 			// Off-heap memory statistics
-			statsd.Gauge("runtime.go.mem_stats.m_span_inuse", float64(ms.MSpanInuse), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.m_span_sys", float64(ms.MSpanSys), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.m_cache_inuse", float64(ms.MCacheInuse), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.m_cache_sys", float64(ms.MCacheSys), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.buck_hash_sys", float64(ms.BuckHashSys), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.gc_sys", float64(ms.GCSys), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.other_sys", float64(ms.OtherSys), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.m_span_inuse", float64(rm.MSpanInuseBytes), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.m_span_sys", float64(rm.MSpanInuseBytes+rm.MSpanFreeBytes), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.m_cache_inuse", float64(rm.MCacheInuseBytes), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.m_cache_sys", float64(rm.MCacheInuseBytes+rm.MCacheFreeBytes), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.buck_hash_sys", float64(rm.ProfilingBucketsBytes), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.gc_sys", float64(rm.GCMetadataBytes), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.other_sys", float64(rm.OtherBytes), nil, 1)
 			// Garbage collector statistics
-			statsd.Gauge("runtime.go.mem_stats.next_gc", float64(ms.NextGC), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.last_gc", float64(ms.LastGC), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.pause_total_ns", float64(ms.PauseTotalNs), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.num_gc", float64(ms.NumGC), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.num_forced_gc", float64(ms.NumForcedGC), nil, 1)
-			statsd.Gauge("runtime.go.mem_stats.gc_cpu_fraction", ms.GCCPUFraction, nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.next_gc", float64(rm.HeapGoalBytes), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.last_gc", float64(lastGC), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.pause_total_ns", float64(rm.GCPauseTotal), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.num_gc", float64(rm.GCCycles), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.num_forced_gc", float64(rm.GCForcedCycles), nil, 1)
+			statsd.Gauge("runtime.go.mem_stats.gc_cpu_fraction", rm.GCCPUFraction, nil, 1)
 			for i, p := range []string{"min", "25p", "50p", "75p", "max"} {
 				statsd.Gauge("runtime.go.gc_stats.pause_quantiles."+p, float64(gc.PauseQuantiles[i]), nil, 1)
 			}
+			if runtimemetrics.Supported {
+				// Histograms of the interval
+				delta := rm.Sub(prev)
+				prev = rm
+				statsd.Gauge("runtime.go.heap_goal", float64(rm.HeapGoalBytes), nil, 1)
+				statsd.Gauge("runtime.go.heap_live", float64(rm.HeapLiveBytes), nil, 1)
+				// Runtime latency statistics of the interval, in nanoseconds,
+				// approximated from the runtime histograms
+				reportSummary(statsd, "runtime.go.gc_pauses", delta.GCPauses.Summary())
+				reportSummary(statsd, "runtime.go.sched_latencies", delta.SchedLatencies.Summary())
+				statsd.Gauge("runtime.go.mutex_wait_total", float64(rm.MutexWait), nil, 1)
+			}
 
 		case <-t.stop:
 			return
@@ -93,6 +118,14 @@ func (t *tracer) reportRuntimeMetrics(interval time.Duration) {
 	}
 }
 
+// reportSummary reports the quantiles of the given summary of seconds as
+// gauges in nanoseconds.
+func reportSummary(statsd statsdClient, name string, s runtimemetrics.Summary) {
+	statsd.Gauge(name+".50p", s.P50*float64(time.Second), nil, 1)
+	statsd.Gauge(name+".95p", s.P95*float64(time.Second), nil, 1)
+	statsd.Gauge(name+".99p", s.P99*float64(time.Second), nil, 1)
+}
+
 func (t *tracer) reportHealthMetrics(interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
@@ -8,6 +8,7 @@ package tracer
 import (
 	"errors"
 	"fmt"
+	"runtime"
 	"sync"
 	"testing"
 	"time"
@@ -261,6 +262,49 @@ func TestReportRuntimeMetrics(t *testing.T) {
 	assert.Contains(calls, "runtime.go.num_cpu")
 	assert.Contains(calls, "runtime.go.mem_stats.alloc")
 	assert.Contains(calls, "runtime.go.gc_stats.pause_quantiles.75p")
+	assert.Contains(calls, "runtime.go.heap_goal")
+	assert.Contains(calls, "runtime.go.sched_latencies.99p")
+	assert.Contains(calls, "runtime.go.gc_pauses.95p")
+	assert.Contains(calls, "runtime.go.mutex_wait_total")
+}
+
+func TestReportRuntimeMemStats(t *testing.T) {
+	var tg testStatsdClient
+	trc := newUnstartedTracer(withStatsdClient(&tg))
+	runtime.GC()
+
+	trc.wg.Add(1)
+	go func() {
+		defer trc.wg.Done()
+		trc.reportRuntimeMetrics(time.Millisecond)
+	}()
+	err := tg.Wait(35, 1*time.Second)
+	close(trc.stop)
+	trc.wg.Wait()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	assert := assert.New(t)
+	assert.NoError(err)
+	gauges := make(map[string]float64)
+	for _, c := range tg.GaugeCalls() {
+		if _, ok := gauges[c.name]; !ok {
+			gauges[c.name] = c.floatVal
+		}
+	}
+	// The mem_stats gauges keep the meaning of their runtime.MemStats field
+	assert.Equal(gauges["runtime.go.mem_stats.heap_sys"], gauges["runtime.go.mem_stats.heap_inuse"]+gauges["runtime.go.mem_stats.heap_idle"])
+	assert.Equal(gauges["runtime.go.mem_stats.alloc"], gauges["runtime.go.mem_stats.heap_alloc"])
+	assert.NotZero(gauges["runtime.go.mem_stats.sys"])
+	assert.LessOrEqual(gauges["runtime.go.mem_stats.sys"], float64(ms.Sys))
+	assert.NotZero(gauges["runtime.go.mem_stats.num_gc"])
+	assert.LessOrEqual(gauges["runtime.go.mem_stats.num_gc"], float64(ms.NumGC))
+	assert.NotZero(gauges["runtime.go.mem_stats.pause_total_ns"])
+	assert.LessOrEqual(gauges["runtime.go.mem_stats.pause_total_ns"], float64(ms.PauseTotalNs))
+	assert.NotZero(gauges["runtime.go.mem_stats.last_gc"])
+	assert.LessOrEqual(gauges["runtime.go.mem_stats.last_gc"], float64(ms.LastGC))
+	assert.LessOrEqual(gauges["runtime.go.mem_stats.total_alloc"], float64(ms.TotalAlloc))
+	assert.LessOrEqual(gauges["runtime.go.mem_stats.mallocs"], float64(ms.Mallocs))
 }
 
 func TestReportHealthMetrics(t *testing.T) {
@@ -129,6 +129,9 @@ type config struct {
 	// profilerEndpoints specifies whether profiler endpoint filtering is enabled.
 	profilerEndpoints bool
 
+	// dataStreamsMonitoring specifies whether Data Streams Monitoring is enabled.
+	dataStreamsMonitoring bool
+
 	// enabled reports whether tracing is enabled.
 	enabled bool
 }
@@ -223,6 +226,7 @@ func newConfig(opts ...StartOption) *config {
 	// TODO(fg): set these to true before going GA with this.
 	c.profilerEndpoints = internal.BoolEnv(traceprof.EndpointEnvVar, false)
 	c.profilerHotspots = internal.BoolEnv(traceprof.CodeHotspotsEnvVar, false)
+	c.dataStreamsMonitoring = internal.BoolEnv("DD_DATA_STREAMS_ENABLED", false)
 
 	for _, fn := range opts {
 		fn(c)
@@ -820,3 +824,44 @@ func StackFrames(n, skip uint) FinishOption {
 		cfg.SkipStackFrames = skip
 	}
 }
+
+// UserMonitoringConfig is the user information associated to a trace by
+// SetUser.
+type UserMonitoringConfig struct {
+	Email     string
+	Name      string
+	Role      string
+	SessionID string
+}
+
+// UserMonitoringOption represents a function that can be provided as a
+// parameter to SetUser.
+type UserMonitoringOption func(*UserMonitoringConfig)
+
+// WithUserEmail sets the email of the authenticated user.
+func WithUserEmail(email string) UserMonitoringOption {
+	return func(cfg *UserMonitoringConfig) {
+		cfg.Email = email
+	}
+}
+
+// WithUserName sets the name of the authenticated user.
+func WithUserName(name string) UserMonitoringOption {
+	return func(cfg *UserMonitoringConfig) {
+		cfg.Name = name
+	}
+}
+
+// WithUserRole sets the role of the authenticated user.
+func WithUserRole(role string) UserMonitoringOption {
+	return func(cfg *UserMonitoringConfig) {
+		cfg.Role = role
+	}
+}
+
+// WithUserSessionID sets the session ID of the authenticated user.
+func WithUserSessionID(sessionID string) UserMonitoringOption {
+	return func(cfg *UserMonitoringConfig) {
+		cfg.SessionID = sessionID
+	}
+}
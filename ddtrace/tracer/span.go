@@ -78,7 +78,8 @@ type span struct {
 	pprofCtxActive  context.Context `msg:"-"` // contains pprof.WithLabel labels to tell the profiler more about this span
 	pprofCtxRestore context.Context `msg:"-"` // contains pprof.WithLabel labels of the parent span (if any) that need to be restored when this span finishes
 
-	taskEnd func() // ends execution tracer (runtime/trace) task, if started
+	taskCtx context.Context `msg:"-"` // contains the execution tracer (runtime/trace) task of this span, if started
+	taskEnd func()          // ends execution tracer (runtime/trace) task, if started
 }
 
 // Context yields the SpanContext for this Span. Note that the return
@@ -86,6 +87,20 @@ type span struct {
 // called the span context and it is different from Go's context.
 func (s *span) Context() ddtrace.SpanContext { return s.context }
 
+// Root returns the local root span of the trace the span belongs to, which is
+// the span itself when it is the local root.
+func (s *span) Root() ddtrace.Span {
+	if s.context == nil || s.context.trace == nil {
+		return s
+	}
+	s.context.trace.mu.RLock()
+	defer s.context.trace.mu.RUnlock()
+	if root := s.context.trace.root; root != nil {
+		return root
+	}
+	return s
+}
+
 // SetBaggageItem sets a key/value pair as baggage on the span. Baggage items
 // are propagated down to descendant spans and injected cross-process. Use with
 // care as it adds extra load onto your tracing layer.
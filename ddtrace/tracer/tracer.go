@@ -17,6 +17,7 @@ import (
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/internal"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/datastreams"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/traceprof"
 
@@ -81,6 +82,10 @@ type tracer struct {
 	// obfuscator holds the obfuscator used to obfuscate resources in aggregated stats.
 	// obfuscator may be nil if disabled.
 	obfuscator *obfuscate.Obfuscator
+
+	// dataStreams processes Data Streams Monitoring checkpoints. It is nil
+	// when Data Streams Monitoring is disabled.
+	dataStreams *datastreams.Processor
 }
 
 const (
@@ -128,6 +133,33 @@ func Stop() {
 	log.Flush()
 }
 
+// SetUser associates the given authenticated user ID, along with the user
+// information set by the options, to the trace the given span belongs to. The
+// user tags are set on the local root span of the trace.
+func SetUser(s Span, id string, opts ...UserMonitoringOption) {
+	if s == nil {
+		return
+	}
+	if r, ok := s.(interface{ Root() ddtrace.Span }); ok {
+		s = r.Root()
+	}
+	var cfg UserMonitoringConfig
+	for _, fn := range opts {
+		fn(&cfg)
+	}
+	s.SetTag(ext.UserID, id)
+	for tag, v := range map[string]string{
+		ext.UserEmail:     cfg.Email,
+		ext.UserName:      cfg.Name,
+		ext.UserRole:      cfg.Role,
+		ext.UserSessionID: cfg.SessionID,
+	} {
+		if v != "" {
+			s.SetTag(tag, v)
+		}
+	}
+}
+
 // Span is an alias for ddtrace.Span. It is here to allow godoc to group methods returning
 // ddtrace.Span. It is recommended and is considered more correct to refer to this type as
 // ddtrace.Span instead.
@@ -192,6 +224,10 @@ func newUnstartedTracer(opts ...StartOption) *tracer {
 			},
 		}),
 	}
+	if c.dataStreamsMonitoring && !c.logToStdout {
+		// there is no agent to send pipeline stats to in lambda mode
+		t.dataStreams = datastreams.NewProcessor(c.statsd, c.env, c.serviceName, c.agentAddr, c.httpClient)
+	}
 	return t
 }
 
@@ -224,7 +260,10 @@ func newTracer(opts ...StartOption) *tracer {
 		t.reportHealthMetrics(statsInterval)
 	}()
 	t.stats.Start()
-	appsec.Start()
+	if t.dataStreams != nil {
+		t.dataStreams.Start()
+	}
+	appsec.Start(appsec.WithStatsd(c.statsd))
 	return t
 }
 
@@ -325,6 +364,10 @@ func (t *tracer) StartSpan(operationName string, options ...ddtrace.StartSpanOpt
 				// using ChildOf() rather than StartSpanFromContext(), see
 				// applyPPROFLabels() below.
 				pprofContext = ctx.span.pprofCtxActive
+				if pprofContext == nil {
+					// Inherit the task context when no labels were applied
+					pprofContext = ctx.span.taskCtx
+				}
 			}
 		}
 	}
@@ -350,7 +393,6 @@ func (t *tracer) StartSpan(operationName string, options ...ddtrace.StartSpanOpt
 		SpanID:       id,
 		TraceID:      id,
 		Start:        startTime,
-		taskEnd:      startExecutionTracerTask(operationName),
 		noDebugStack: t.config.noDebugStack,
 	}
 	if t.config.hostname != "" {
@@ -377,6 +419,12 @@ func (t *tracer) StartSpan(operationName string, options ...ddtrace.StartSpanOpt
 		}
 	}
 	span.context = newSpanContext(span, context)
+	// The task context is used as the pprof context, and kept on the span
+	// regardless of the pprof labels, so that the children of the span get
+	// child tasks.
+	if taskCtx, end := startExecutionTracerTask(pprofContext, span); end != nil {
+		pprofContext, span.taskCtx, span.taskEnd = taskCtx, taskCtx, end
+	}
 	if context == nil || context.span == nil {
 		// this is either a root span or it has a remote parent, we should add the PID.
 		span.setMeta(ext.Pid, t.pid)
@@ -460,10 +508,13 @@ func (t *tracer) Stop() {
 		t.config.statsd.Incr("datadog.tracer.stopped", nil, 1)
 	})
 	t.stats.Stop()
+	if t.dataStreams != nil {
+		t.dataStreams.Stop()
+	}
 	t.wg.Wait()
 	t.traceWriter.stop()
-	t.config.statsd.Close()
 	appsec.Stop()
+	t.config.statsd.Close()
 }
 
 // Inject uses the configured or default TextMap Propagator.
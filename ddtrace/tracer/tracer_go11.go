@@ -10,12 +10,24 @@ package tracer
 import (
 	"context"
 	t "runtime/trace"
+	"strconv"
 )
 
-func startExecutionTracerTask(name string) func() {
+// newTask starts a runtime/trace task. It is replaced in tests.
+var newTask = t.NewTask
+
+// startExecutionTracerTask starts a runtime/trace task for the given span
+// when the execution tracer is enabled, such as by the profiler. The task is a
+// child of the task found in ctx, if any, and logs the span and trace IDs so
+// that the execution trace can be correlated with the span. It returns the
+// task context and the function ending the task, or a nil function when no
+// task was started.
+func startExecutionTracerTask(ctx context.Context, span *span) (context.Context, func()) {
 	if !t.IsEnabled() {
-		return func() {}
+		return ctx, nil
 	}
-	_, task := t.NewTask(context.TODO(), name)
-	return task.End
+	ctx, task := newTask(ctx, span.Name)
+	t.Log(ctx, "datadog.uint64_span_id", strconv.FormatUint(span.SpanID, 10))
+	t.Log(ctx, "datadog.uint64_trace_id", strconv.FormatUint(span.TraceID, 10))
+	return ctx, task.End
 }
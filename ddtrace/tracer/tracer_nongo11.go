@@ -7,6 +7,8 @@
 
 package tracer
 
-func startExecutionTracerTask(name string) func() {
-	return func() {}
+import "context"
+
+func startExecutionTracerTask(ctx context.Context, _ *span) (context.Context, func()) {
+	return ctx, nil
 }
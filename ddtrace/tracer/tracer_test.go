@@ -6,6 +6,7 @@
 package tracer
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io"
@@ -13,6 +14,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	rt "runtime/trace"
 	"strconv"
 	"strings"
 	"sync"
@@ -276,6 +278,50 @@ func TestTracerStartSpan(t *testing.T) {
 	})
 }
 
+func TestExecutionTracerTask(t *testing.T) {
+	// Record the parent task of every task, by span name
+	type taskName struct{}
+	parents := make(map[string]interface{})
+	defer func(old func(context.Context, string) (context.Context, *rt.Task)) { newTask = old }(newTask)
+	newTask = func(ctx context.Context, name string) (context.Context, *rt.Task) {
+		parents[name] = ctx.Value(taskName{})
+		ctx, task := rt.NewTask(ctx, name)
+		return context.WithValue(ctx, taskName{}, name), task
+	}
+
+	var buf bytes.Buffer
+	if err := rt.Start(&buf); err != nil {
+		t.Skipf("execution tracer unavailable: %v", err)
+	}
+	tracer, _, _, stop := startTestTracer(t)
+	defer stop()
+	// The tasks don't depend on the pprof labels
+	tracer.config.profilerHotspots = false
+	tracer.config.profilerEndpoints = false
+	root, ctx := StartSpanFromContext(context.Background(), "web.request")
+	child, _ := StartSpanFromContext(ctx, "db.query")
+	sibling := StartSpan("cache.get", ChildOf(root.Context()))
+	sibling.Finish()
+	child.Finish()
+	root.Finish()
+	rt.Stop()
+
+	assert := assert.New(t)
+	assert.NotNil(root.(*span).taskEnd)
+	// The tasks of the children are nested under the task of their parent,
+	// whether started from the context or with ChildOf.
+	assert.Equal(map[string]interface{}{
+		"web.request": nil,
+		"db.query":    "web.request",
+		"cache.get":   "web.request",
+	}, parents)
+	// The span and trace IDs are logged in the tasks of the spans.
+	assert.Contains(buf.String(), "datadog.uint64_span_id")
+	assert.Contains(buf.String(), strconv.FormatUint(root.(*span).SpanID, 10))
+	assert.Contains(buf.String(), strconv.FormatUint(child.(*span).SpanID, 10))
+	assert.Contains(buf.String(), strconv.FormatUint(root.(*span).TraceID, 10))
+}
+
 func TestSamplingDecision(t *testing.T) {
 	t.Run("sampled", func(t *testing.T) {
 		tracer, _, _, stop := startTestTracer(t)
@@ -435,6 +481,24 @@ func TestTracerStartChildSpan(t *testing.T) {
 	})
 }
 
+func TestSetUser(t *testing.T) {
+	assert := assert.New(t)
+	tracer := newTracer(withTransport(newDefaultTransport()))
+	defer tracer.Stop()
+	root := tracer.StartSpan("web.request").(*span)
+	child := tracer.StartSpan("db.query", ChildOf(root.Context())).(*span)
+	assert.Equal(root, child.Root())
+	assert.Equal(root, root.Root())
+
+	SetUser(child, "user-id", WithUserEmail("email"), WithUserRole("admin"))
+	assert.Equal("user-id", root.Meta[ext.UserID])
+	assert.Equal("email", root.Meta[ext.UserEmail])
+	assert.Equal("admin", root.Meta[ext.UserRole])
+	assert.NotContains(root.Meta, ext.UserName)
+	assert.NotContains(root.Meta, ext.UserSessionID)
+	assert.NotContains(child.Meta, ext.UserID)
+}
+
 func TestTracerBaggagePropagation(t *testing.T) {
 	assert := assert.New(t)
 	tracer := newTracer()
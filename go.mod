@@ -9,6 +9,7 @@ require (
 	github.com/DataDog/sketches-go v1.0.0
 	github.com/google/pprof v0.0.0-20210423192551-a2663126120b
 	github.com/google/uuid v1.3.0
+	github.com/klauspost/compress v1.13.6
 	github.com/philhofer/fwd v1.1.1 // indirect
 	github.com/stretchr/testify v1.7.0
 	github.com/tinylib/msgp v1.1.2
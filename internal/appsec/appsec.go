@@ -9,9 +9,14 @@
 package appsec
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
 	"sync"
+	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/httpsec"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 )
 
@@ -25,7 +30,7 @@ func Enabled() bool {
 
 // Start AppSec when enabled is enabled by both using the appsec build tag and
 // setting the environment variable DD_APPSEC_ENABLED to true.
-func Start() {
+func Start(opts ...StartOption) {
 	enabled, err := isEnabled()
 	if err != nil {
 		logUnexpectedStartError(err)
@@ -41,6 +46,9 @@ func Start() {
 		logUnexpectedStartError(err)
 		return
 	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
 	appsec := newAppSec(cfg)
 	if err := appsec.start(); err != nil {
 		logUnexpectedStartError(err)
@@ -73,9 +81,49 @@ func setActiveAppSec(a *appsec) {
 	activeAppSec = a
 }
 
+// UpdateRulesData replaces the current rules data of the running AppSec with
+// the given one. An error is returned when AppSec is not running or when the
+// rules data cannot be parsed.
+func UpdateRulesData(data []byte) error {
+	mu.RLock()
+	defer mu.RUnlock()
+	if activeAppSec == nil {
+		return errors.New("appsec is not running")
+	}
+	return activeAppSec.rulesData.update(data)
+}
+
+// UpdateRules replaces the security rules of the running AppSec with the given
+// ones. The in-flight requests keep on using the previous rules. An error is
+// returned when AppSec is not running or when the rules are invalid, in which
+// case the current rules are kept.
+func UpdateRules(rules []byte) error {
+	mu.RLock()
+	defer mu.RUnlock()
+	if activeAppSec == nil {
+		return errors.New("appsec is not running")
+	}
+	return activeAppSec.waf.updateRules(rules)
+}
+
+// DisableRules replaces the set of disabled security rules of the running
+// AppSec with the given rule IDs. An empty list enables every rule back.
+func DisableRules(ids []string) error {
+	mu.RLock()
+	defer mu.RUnlock()
+	if activeAppSec == nil {
+		return errors.New("appsec is not running")
+	}
+	return activeAppSec.waf.disableRules(ids)
+}
+
 type appsec struct {
-	cfg           *config
-	unregisterWAF dyngo.UnregisterFunc
+	cfg                 *config
+	waf                 *wafManager
+	unregisterDenylists dyngo.UnregisterFunc
+	rulesData           rulesDataStore
+	stopWatch           chan struct{}
+	wg                  sync.WaitGroup
 }
 
 func newAppSec(cfg *config) *appsec {
@@ -87,15 +135,86 @@ func newAppSec(cfg *config) *appsec {
 // Start AppSec by registering its security protections according to the configured the security rules.
 func (a *appsec) start() error {
 	// Register the WAF operation event listener
-	unregisterWAF, err := registerWAF(a.cfg.rules, a.cfg.wafTimeout)
+	blockingHandler := httpsec.NewBlockingHandler(a.cfg.blockedStatus, a.cfg.blockedTemplateJSON, a.cfg.blockedTemplateHTML)
+	waf, err := registerWAF(a.cfg.rules, a.cfg.disabledRules, a.cfg.wafTimeout, blockingHandler, a.cfg.statsd)
 	if err != nil {
 		return err
 	}
-	a.unregisterWAF = unregisterWAF
+	a.waf = waf
+	httpsec.SetTraceRateLimit(a.cfg.traceRateLimit)
+	httpsec.SetResponseBodySampling(a.cfg.responseBody)
+
+	// Register the denylists of the rules data
+	a.unregisterDenylists = registerDenylists(&a.rulesData, blockingHandler)
+
+	// Watch the rules and rules data files, when configured, to reload them
+	// when they change.
+	a.stopWatch = make(chan struct{})
+	if path := a.cfg.rulesFile; path != "" {
+		a.watchFile(path, false, a.waf.updateRules)
+	}
+	if path := a.cfg.rulesDataFile; path != "" {
+		log.Info("appsec: loading the rules data from file %s", path)
+		a.watchFile(path, true, a.rulesData.update)
+	}
 	return nil
 }
 
 // Stop AppSec by unregistering the security protections.
 func (a *appsec) stop() {
-	a.unregisterWAF()
+	close(a.stopWatch)
+	a.wg.Wait()
+	a.unregisterDenylists()
+	a.waf.close()
+}
+
+// Interval at which the watched files are checked for changes.
+var filePollInterval = 10 * time.Second
+
+// watchFile starts watching the given file until AppSec stops, calling update
+// with the file content every time its modification time changes. The file is
+// also loaded right away when load is true.
+func (a *appsec) watchFile(path string, load bool, update func([]byte) error) {
+	var modTime time.Time
+	if !load {
+		if info, err := os.Stat(path); err == nil {
+			modTime = info.ModTime()
+		}
+	}
+	reload := func() {
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Error("appsec: could not read the file %s: %v", path, err)
+			return
+		}
+		if info.ModTime().Equal(modTime) {
+			return
+		}
+		modTime = info.ModTime()
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Error("appsec: could not read the file %s: %v", path, err)
+			return
+		}
+		if err := update(data); err != nil {
+			log.Error("appsec: could not load the file %s: %v", path, err)
+		}
+	}
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		if load {
+			reload()
+		}
+		tick := time.NewTicker(filePollInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				reload()
+			case <-a.stopWatch:
+				return
+			}
+		}
+	}()
 }
@@ -8,7 +8,11 @@
 
 package appsec
 
-import "gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+import (
+	"errors"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+)
 
 // Enabled returns true when AppSec is up and running. Meaning that the appsec build tag is enabled, the env var
 // DD_APPSEC_ENABLED is set to true, and the tracer is started.
@@ -18,7 +22,7 @@ func Enabled() bool {
 
 // Start AppSec when enabled is enabled by both using the appsec build tag and
 // setting the environment variable DD_APPSEC_ENABLED to true.
-func Start() {
+func Start(...StartOption) {
 	if enabled, err := isEnabled(); err != nil {
 		// Something went wrong while checking the DD_APPSEC_ENABLED configuration
 		log.Error("appsec: error while checking if appsec is enabled: %v", err)
@@ -34,5 +38,26 @@ func Start() {
 // Stop AppSec.
 func Stop() {}
 
+// UpdateRulesData replaces the current rules data of the running AppSec with
+// the given one. An error is returned when AppSec is not running or when the
+// rules data cannot be parsed.
+func UpdateRulesData([]byte) error {
+	return errors.New("appsec is not running")
+}
+
 // Static rule stubs when disabled.
 const staticRecommendedRule = ""
+
+// UpdateRules replaces the security rules of the running AppSec with the given
+// ones. The in-flight requests keep on using the previous rules. An error is
+// returned when AppSec is not running or when the rules are invalid, in which
+// case the current rules are kept.
+func UpdateRules([]byte) error {
+	return errors.New("appsec is not running")
+}
+
+// DisableRules replaces the set of disabled security rules of the running
+// AppSec with the given rule IDs. An empty list enables every rule back.
+func DisableRules([]string) error {
+	return errors.New("appsec is not running")
+}
@@ -10,25 +10,79 @@ import (
 	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/httpsec"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 )
 
 const (
-	enabledEnvVar    = "DD_APPSEC_ENABLED"
-	rulesEnvVar      = "DD_APPSEC_RULES"
-	wafTimeoutEnvVar = "DD_APPSEC_WAF_TIMEOUT"
+	enabledEnvVar             = "DD_APPSEC_ENABLED"
+	rulesEnvVar               = "DD_APPSEC_RULES"
+	wafTimeoutEnvVar          = "DD_APPSEC_WAF_TIMEOUT"
+	blockedStatusEnvVar       = "DD_APPSEC_HTTP_BLOCKED_STATUS_CODE"
+	blockedTemplateJSONEnvVar = "DD_APPSEC_HTTP_BLOCKED_TEMPLATE_JSON"
+	blockedTemplateHTMLEnvVar = "DD_APPSEC_HTTP_BLOCKED_TEMPLATE_HTML"
+	rulesDataEnvVar           = "DD_APPSEC_RULES_DATA"
+	disabledRulesEnvVar       = "DD_APPSEC_RULES_DISABLED"
+	traceRateLimitEnvVar      = "DD_APPSEC_TRACE_RATE_LIMIT"
+	responseBodyEnvVar        = "DD_APPSEC_RESPONSE_BODY_ENABLED"
 )
 
-const defaultWAFTimeout = 4 * time.Millisecond
+const (
+	defaultWAFTimeout    = 4 * time.Millisecond
+	defaultBlockedStatus = 403
+)
 
 // config is the AppSec configuration.
 type config struct {
 	// rules loaded via the env var DD_APPSEC_RULES. When not set, the builtin rules will be used.
 	rules []byte
+	// Path of the rules file set via the env var DD_APPSEC_RULES. The rules
+	// are reloaded when the file changes.
+	rulesFile string
+	// IDs of the rules to disable, set via the env var DD_APPSEC_RULES_DISABLED
+	// as a comma-separated list.
+	disabledRules []string
 	// Maximum WAF execution time
 	wafTimeout time.Duration
+	// HTTP status code of the responses of blocked requests.
+	blockedStatus int
+	// JSON and HTML bodies of the responses of blocked requests, loaded via the
+	// env vars DD_APPSEC_HTTP_BLOCKED_TEMPLATE_JSON and DD_APPSEC_HTTP_BLOCKED_TEMPLATE_HTML.
+	// When not set, the default templates will be used.
+	blockedTemplateJSON []byte
+	blockedTemplateHTML []byte
+	// Path of the rules data file defining the IP and user denylists, set via
+	// the env var DD_APPSEC_RULES_DATA. The file is reloaded when it changes.
+	rulesDataFile string
+	// Maximum number of traces per second kept because of their security
+	// events, set via the env var DD_APPSEC_TRACE_RATE_LIMIT.
+	traceRateLimit uint
+	// Whether the beginning of the response bodies is sampled for the WAF,
+	// set via the env var DD_APPSEC_RESPONSE_BODY_ENABLED. Disabled by default.
+	responseBody bool
+	// statsd is used to report the WAF metrics. Set via the WithStatsd start
+	// option.
+	statsd StatsdClient
+}
+
+// StatsdClient is the subset of the tracer's statsd client used by AppSec to
+// report its metrics.
+type StatsdClient interface {
+	Count(name string, value int64, tags []string, rate float64) error
+	Timing(name string, value time.Duration, tags []string, rate float64) error
+}
+
+// StartOption configures AppSec at start.
+type StartOption func(*config)
+
+// WithStatsd sets the statsd client to use for reporting the AppSec metrics.
+func WithStatsd(client StatsdClient) StartOption {
+	return func(cfg *config) {
+		cfg.statsd = client
+	}
 }
 
 // isEnabled returns true when appsec is enabled when the environment variable
@@ -58,6 +112,7 @@ func newConfig() (*config, error) {
 			return nil, err
 		}
 		cfg.rules = rules
+		cfg.rulesFile = filepath
 		log.Info("appsec: starting with the security rules from file %s", filepath)
 	} else {
 		log.Info("appsec: starting with the default recommended security rules")
@@ -77,5 +132,54 @@ func newConfig() (*config, error) {
 		}
 	}
 
+	cfg.traceRateLimit = httpsec.DefaultTraceRateLimit
+	if limit := os.Getenv(traceRateLimitEnvVar); limit != "" {
+		if n, err := strconv.ParseUint(limit, 10, 0); err != nil || n == 0 {
+			log.Error("appsec: unexpected configuration value of %s=%s: expecting a strictly positive integer. Using default value %d.", traceRateLimitEnvVar, limit, cfg.traceRateLimit)
+		} else {
+			cfg.traceRateLimit = uint(n)
+		}
+	}
+
+	if enabled := os.Getenv(responseBodyEnvVar); enabled != "" {
+		if b, err := strconv.ParseBool(enabled); err != nil {
+			log.Error("appsec: could not parse the value of %s %s as a boolean value: %v. Using default value %t.", responseBodyEnvVar, enabled, err, cfg.responseBody)
+		} else {
+			cfg.responseBody = b
+		}
+	}
+
+	cfg.blockedStatus = defaultBlockedStatus
+	if status := os.Getenv(blockedStatusEnvVar); status != "" {
+		if code, err := strconv.Atoi(status); err != nil || code < 100 || code > 599 {
+			log.Error("appsec: unexpected configuration value of %s=%s: expecting an HTTP status code. Using default value %d.", blockedStatusEnvVar, status, cfg.blockedStatus)
+		} else {
+			cfg.blockedStatus = code
+		}
+	}
+	cfg.blockedTemplateJSON = readBlockedTemplate(blockedTemplateJSONEnvVar, httpsec.DefaultBlockedTemplateJSON)
+	cfg.blockedTemplateHTML = readBlockedTemplate(blockedTemplateHTMLEnvVar, httpsec.DefaultBlockedTemplateHTML)
+	cfg.rulesDataFile = os.Getenv(rulesDataEnvVar)
+	for _, id := range strings.Split(os.Getenv(disabledRulesEnvVar), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			cfg.disabledRules = append(cfg.disabledRules, id)
+		}
+	}
+
 	return cfg, nil
 }
+
+// readBlockedTemplate returns the content of the file whose path is set in the
+// given env var, or the default template when not set or not readable.
+func readBlockedTemplate(envVar, defaultTemplate string) []byte {
+	filepath := os.Getenv(envVar)
+	if filepath == "" {
+		return []byte(defaultTemplate)
+	}
+	template, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		log.Error("appsec: could not read the blocked response template file %s=%s: %v. Using the default template.", envVar, filepath, err)
+		return []byte(defaultTemplate)
+	}
+	return template
+}
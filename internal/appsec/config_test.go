@@ -14,13 +14,19 @@ import (
 	"testing"
 	"time"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/httpsec"
+
 	"github.com/stretchr/testify/require"
 )
 
 func TestConfig(t *testing.T) {
 	expectedDefaultConfig := &config{
-		rules:      []byte(staticRecommendedRule),
-		wafTimeout: defaultWAFTimeout,
+		rules:               []byte(staticRecommendedRule),
+		wafTimeout:          defaultWAFTimeout,
+		traceRateLimit:      httpsec.DefaultTraceRateLimit,
+		blockedStatus:       defaultBlockedStatus,
+		blockedTemplateJSON: []byte(httpsec.DefaultBlockedTemplateJSON),
+		blockedTemplateHTML: []byte(httpsec.DefaultBlockedTemplateHTML),
 	}
 
 	t.Run("default", func(t *testing.T) {
@@ -41,8 +47,12 @@ func TestConfig(t *testing.T) {
 			require.Equal(
 				t,
 				&config{
-					rules:      []byte(staticRecommendedRule),
-					wafTimeout: 5 * time.Second,
+					rules:               []byte(staticRecommendedRule),
+					wafTimeout:          5 * time.Second,
+					traceRateLimit:      httpsec.DefaultTraceRateLimit,
+					blockedStatus:       defaultBlockedStatus,
+					blockedTemplateJSON: []byte(httpsec.DefaultBlockedTemplateJSON),
+					blockedTemplateHTML: []byte(httpsec.DefaultBlockedTemplateHTML),
 				},
 				cfg,
 			)
@@ -111,25 +121,152 @@ func TestConfig(t *testing.T) {
 			cfg, err := newConfig()
 			require.NoError(t, err)
 			require.Equal(t, &config{
-				rules:      []byte(expectedRules),
-				wafTimeout: defaultWAFTimeout,
+				rules:               []byte(expectedRules),
+				rulesFile:           file.Name(),
+				wafTimeout:          defaultWAFTimeout,
+				traceRateLimit:      httpsec.DefaultTraceRateLimit,
+				blockedStatus:       defaultBlockedStatus,
+				blockedTemplateJSON: []byte(httpsec.DefaultBlockedTemplateJSON),
+				blockedTemplateHTML: []byte(httpsec.DefaultBlockedTemplateHTML),
 			}, cfg)
 		})
 	})
+
+	t.Run("blocked-status", func(t *testing.T) {
+		t.Run("parsable", func(t *testing.T) {
+			restoreEnv := cleanEnv()
+			defer restoreEnv()
+			require.NoError(t, os.Setenv(blockedStatusEnvVar, "418"))
+			cfg, err := newConfig()
+			require.NoError(t, err)
+			require.Equal(t, 418, cfg.blockedStatus)
+		})
+
+		for _, value := range []string{"not a status code", "42", "600"} {
+			t.Run(value, func(t *testing.T) {
+				restoreEnv := cleanEnv()
+				defer restoreEnv()
+				require.NoError(t, os.Setenv(blockedStatusEnvVar, value))
+				cfg, err := newConfig()
+				require.NoError(t, err)
+				require.Equal(t, expectedDefaultConfig, cfg)
+			})
+		}
+	})
+
+	t.Run("blocked-templates", func(t *testing.T) {
+		t.Run("file-not-found", func(t *testing.T) {
+			restoreEnv := cleanEnv()
+			defer restoreEnv()
+			os.Setenv(blockedTemplateJSONEnvVar, "i do not exist")
+			os.Setenv(blockedTemplateHTMLEnvVar, "i do not exist")
+			cfg, err := newConfig()
+			require.NoError(t, err)
+			require.Equal(t, expectedDefaultConfig, cfg)
+		})
+
+		t.Run("local-files", func(t *testing.T) {
+			restoreEnv := cleanEnv()
+			defer restoreEnv()
+			dir, err := ioutil.TempDir("", "templates-*")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			jsonFile, htmlFile := dir+"/blocked.json", dir+"/blocked.html"
+			require.NoError(t, ioutil.WriteFile(jsonFile, []byte(`{"custom":true}`), 0600))
+			require.NoError(t, ioutil.WriteFile(htmlFile, []byte(`<p>custom</p>`), 0600))
+			os.Setenv(blockedTemplateJSONEnvVar, jsonFile)
+			os.Setenv(blockedTemplateHTMLEnvVar, htmlFile)
+			cfg, err := newConfig()
+			require.NoError(t, err)
+			require.Equal(t, []byte(`{"custom":true}`), cfg.blockedTemplateJSON)
+			require.Equal(t, []byte(`<p>custom</p>`), cfg.blockedTemplateHTML)
+		})
+	})
+
+	t.Run("rules-data", func(t *testing.T) {
+		restoreEnv := cleanEnv()
+		defer restoreEnv()
+		os.Setenv(rulesDataEnvVar, "/path/to/rules_data.json")
+		cfg, err := newConfig()
+		require.NoError(t, err)
+		require.Equal(t, "/path/to/rules_data.json", cfg.rulesDataFile)
+	})
+
+	t.Run("trace-rate-limit", func(t *testing.T) {
+		t.Run("parsable", func(t *testing.T) {
+			restoreEnv := cleanEnv()
+			defer restoreEnv()
+			require.NoError(t, os.Setenv(traceRateLimitEnvVar, "10"))
+			cfg, err := newConfig()
+			require.NoError(t, err)
+			require.Equal(t, uint(10), cfg.traceRateLimit)
+		})
+
+		for _, value := range []string{"not a number", "0", "-1"} {
+			t.Run(value, func(t *testing.T) {
+				restoreEnv := cleanEnv()
+				defer restoreEnv()
+				require.NoError(t, os.Setenv(traceRateLimitEnvVar, value))
+				cfg, err := newConfig()
+				require.NoError(t, err)
+				require.Equal(t, expectedDefaultConfig, cfg)
+			})
+		}
+	})
+
+	t.Run("response-body", func(t *testing.T) {
+		t.Run("parsable", func(t *testing.T) {
+			restoreEnv := cleanEnv()
+			defer restoreEnv()
+			require.NoError(t, os.Setenv(responseBodyEnvVar, "true"))
+			cfg, err := newConfig()
+			require.NoError(t, err)
+			require.True(t, cfg.responseBody)
+		})
+
+		t.Run("not-parsable", func(t *testing.T) {
+			restoreEnv := cleanEnv()
+			defer restoreEnv()
+			require.NoError(t, os.Setenv(responseBodyEnvVar, "not a boolean"))
+			cfg, err := newConfig()
+			require.NoError(t, err)
+			require.Equal(t, expectedDefaultConfig, cfg)
+		})
+	})
+
+	t.Run("disabled-rules", func(t *testing.T) {
+		restoreEnv := cleanEnv()
+		defer restoreEnv()
+		os.Setenv(disabledRulesEnvVar, " crs-942-100, ,ua0-600-12x")
+		cfg, err := newConfig()
+		require.NoError(t, err)
+		require.Equal(t, []string{"crs-942-100", "ua0-600-12x"}, cfg.disabledRules)
+	})
 }
 
 func cleanEnv() func() {
-	wafTimeout := os.Getenv(wafTimeoutEnvVar)
-	if err := os.Unsetenv(wafTimeoutEnvVar); err != nil {
-		panic(err)
+	envVars := []string{
+		wafTimeoutEnvVar,
+		rulesEnvVar,
+		traceRateLimitEnvVar,
+		blockedStatusEnvVar,
+		blockedTemplateJSONEnvVar,
+		blockedTemplateHTMLEnvVar,
+		rulesDataEnvVar,
+		disabledRulesEnvVar,
+		responseBodyEnvVar,
 	}
-	rules := os.Getenv(rulesEnvVar)
-	if err := os.Unsetenv(rulesEnvVar); err != nil {
-		panic(err)
+	values := make([]string, len(envVars))
+	for i, env := range envVars {
+		values[i] = os.Getenv(env)
+		if err := os.Unsetenv(env); err != nil {
+			panic(err)
+		}
 	}
 	return func() {
-		restoreEnv(wafTimeoutEnvVar, wafTimeout)
-		restoreEnv(rulesEnvVar, rules)
+		for i, env := range envVars {
+			restoreEnv(env, values[i])
+		}
 	}
 }
 
@@ -11,6 +11,7 @@ package grpcsec
 
 import (
 	"encoding/json"
+	"net"
 	"reflect"
 	"sync"
 
@@ -35,14 +36,22 @@ type (
 	// Finish() method.
 	// Security events observed during the operation lifetime should be added
 	// to the operation using its AddSecurityEvent() method.
+	// The operation can be blocked using its Block() method, in which case the
+	// RPC must be aborted as soon as possible.
 	HandlerOperation struct {
 		dyngo.Operation
 
-		events []json.RawMessage
-		mu     sync.Mutex
+		events  []json.RawMessage
+		tags    map[string]interface{}
+		blocked bool
+		mu      sync.Mutex
+	}
+	// HandlerOperationArgs is the grpc handler arguments.
+	HandlerOperationArgs struct {
+		// ClientIP corresponds to the address `http.client_ip`, resolved out
+		// of the request metadata and peer address.
+		ClientIP net.IP
 	}
-	// HandlerOperationArgs is the grpc handler arguments. Empty as of today.
-	HandlerOperationArgs struct{}
 	// HandlerOperationRes is the grpc handler results. Empty as of today.
 	HandlerOperationRes struct{}
 
@@ -90,6 +99,39 @@ func (op *HandlerOperation) AddSecurityEvent(event json.RawMessage) {
 	op.events = append(op.events, event)
 }
 
+// AddTag adds the span tag to set into the service entry span once the
+// operation is finished.
+func (op *HandlerOperation) AddTag(key string, value interface{}) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.tags == nil {
+		op.tags = make(map[string]interface{})
+	}
+	op.tags[key] = value
+}
+
+// Tags returns the span tags added during the operation lifetime.
+func (op *HandlerOperation) Tags() map[string]interface{} {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.tags
+}
+
+// Block the gRPC handler operation so that the RPC gets aborted with a
+// PermissionDenied status.
+func (op *HandlerOperation) Block() {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.blocked = true
+}
+
+// Blocked returns true when the operation was blocked.
+func (op *HandlerOperation) Blocked() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.blocked
+}
+
 // gRPC handler operation's start and finish event callback function types.
 type (
 	// OnHandlerOperationStart function type, called when an gRPC handler
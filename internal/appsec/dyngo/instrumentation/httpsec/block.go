@@ -0,0 +1,47 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package httpsec
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Default blocking response bodies, used when no custom template is configured.
+const (
+	// DefaultBlockedTemplateJSON is the default JSON blocking response body.
+	DefaultBlockedTemplateJSON = `{"errors":[{"title":"You've been blocked","detail":"Sorry, you cannot access this page. Please contact the customer service team. Security provided by Datadog."}]}`
+	// DefaultBlockedTemplateHTML is the default HTML blocking response body.
+	DefaultBlockedTemplateHTML = `<!DOCTYPE html><html lang="en"><head><meta charset="UTF-8"><meta name="viewport" content="width=device-width,initial-scale=1"><title>You've been blocked</title></head><body><h1>Sorry, you cannot access this page. Please contact the customer service team.</h1><p>Security provided by Datadog.</p></body></html>`
+)
+
+// NewBlockingHandler returns the HTTP handler writing the blocking response
+// with the given status code. The HTML template is used when the request
+// prefers HTML over JSON according to its Accept header, and the JSON one
+// otherwise.
+func NewBlockingHandler(status int, jsonTemplate, htmlTemplate []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, contentType := jsonTemplate, "application/json"
+		if prefersHTML(r.Header.Get("Accept")) {
+			body, contentType = htmlTemplate, "text/html"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		w.Write(body)
+	})
+}
+
+// prefersHTML returns true when text/html appears in the given Accept header
+// value before application/json, or without it. The quality values are not
+// taken into account.
+func prefersHTML(accept string) bool {
+	html := strings.Index(accept, "text/html")
+	if html == -1 {
+		return false
+	}
+	json := strings.Index(accept, "application/json")
+	return json == -1 || html < json
+}
@@ -0,0 +1,40 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package httpsec
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockingHandler(t *testing.T) {
+	h := NewBlockingHandler(http.StatusTeapot, []byte(`{"blocked":true}`), []byte(`<p>blocked</p>`))
+	for _, tc := range []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{accept: "", contentType: "application/json", body: `{"blocked":true}`},
+		{accept: "*/*", contentType: "application/json", body: `{"blocked":true}`},
+		{accept: "application/json", contentType: "application/json", body: `{"blocked":true}`},
+		{accept: "text/html,application/xhtml+xml,*/*;q=0.8", contentType: "text/html", body: `<p>blocked</p>`},
+		{accept: "application/json, text/html", contentType: "application/json", body: `{"blocked":true}`},
+		{accept: "text/html, application/json", contentType: "text/html", body: `<p>blocked</p>`},
+	} {
+		t.Run(tc.accept, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept", tc.accept)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			require.Equal(t, http.StatusTeapot, rec.Code)
+			require.Equal(t, tc.contentType, rec.Header().Get("Content-Type"))
+			require.Equal(t, tc.body, rec.Body.String())
+		})
+	}
+}
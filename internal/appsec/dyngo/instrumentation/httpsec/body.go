@@ -0,0 +1,101 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package httpsec
+
+import (
+	"context"
+	"reflect"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/sharedsec"
+)
+
+// Abstract HTTP request body operation definition, allowing to monitor the
+// request body once parsed by the application or the framework.
+type (
+	// SDKBodyOperation type representing the monitoring of a parsed HTTP
+	// request body. It must be created with StartSDKBodyOperation() and
+	// finished with its Finish().
+	SDKBodyOperation struct {
+		dyngo.Operation
+	}
+	// SDKBodyOperationArgs is the SDK body operation arguments.
+	SDKBodyOperationArgs struct {
+		// Body corresponds to the address `server.request.body`. It can be
+		// any Go value, which gets encoded within the WAF depth and length
+		// limits.
+		Body interface{}
+	}
+	// SDKBodyOperationRes is the SDK body operation results. Empty as of
+	// today.
+	SDKBodyOperationRes struct{}
+)
+
+// MonitorParsedBody monitors the given parsed request body of the HTTP handler
+// operation stored in the given context. sharedsec.ErrBlocked is returned when
+// the request got blocked. Nothing is monitored and nil is returned when the
+// context has no HTTP handler operation, such as when AppSec is disabled.
+func MonitorParsedBody(ctx context.Context, body interface{}) error {
+	parent, ok := sharedsec.OperationFromContext(ctx).(*Operation)
+	if !ok {
+		return nil
+	}
+	StartSDKBodyOperation(SDKBodyOperationArgs{Body: body}, parent).Finish(SDKBodyOperationRes{})
+	if parent.BlockingHandler() != nil {
+		return sharedsec.ErrBlocked
+	}
+	return nil
+}
+
+// StartSDKBodyOperation starts the SDK body operation, along with the given
+// arguments and parent operation, and emits a start event up in the operation
+// stack.
+func StartSDKBodyOperation(args SDKBodyOperationArgs, parent *Operation) SDKBodyOperation {
+	op := SDKBodyOperation{Operation: dyngo.NewOperation(parent)}
+	dyngo.StartOperation(op, args)
+	return op
+}
+
+// Finish the SDK body operation, along with the given results, and emits a
+// finish event up in the operation stack.
+func (op SDKBodyOperation) Finish(res SDKBodyOperationRes) {
+	dyngo.FinishOperation(op, res)
+}
+
+// SDK body operation's start and finish event callback function types.
+type (
+	// OnSDKBodyOperationStart function type, called when an SDK body
+	// operation starts.
+	OnSDKBodyOperationStart func(SDKBodyOperation, SDKBodyOperationArgs)
+	// OnSDKBodyOperationFinish function type, called when an SDK body
+	// operation finishes.
+	OnSDKBodyOperationFinish func(SDKBodyOperation, SDKBodyOperationRes)
+)
+
+var (
+	sdkBodyOperationArgsType = reflect.TypeOf((*SDKBodyOperationArgs)(nil)).Elem()
+	sdkBodyOperationResType  = reflect.TypeOf((*SDKBodyOperationRes)(nil)).Elem()
+)
+
+// ListenedType returns the type a OnSDKBodyOperationStart event listener
+// listens to, which is the SDKBodyOperationArgs type.
+func (OnSDKBodyOperationStart) ListenedType() reflect.Type { return sdkBodyOperationArgsType }
+
+// Call the underlying event listener function by performing the type-assertion
+// on v whose type is the one returned by ListenedType().
+func (f OnSDKBodyOperationStart) Call(op dyngo.Operation, v interface{}) {
+	f(op.(SDKBodyOperation), v.(SDKBodyOperationArgs))
+}
+
+// ListenedType returns the type a OnSDKBodyOperationFinish event listener
+// listens to, which is the SDKBodyOperationRes type.
+func (OnSDKBodyOperationFinish) ListenedType() reflect.Type { return sdkBodyOperationResType }
+
+// Call the underlying event listener function by performing the type-assertion
+// on v whose type is the one returned by ListenedType().
+func (f OnSDKBodyOperationFinish) Call(op dyngo.Operation, v interface{}) {
+	f(op.(SDKBodyOperation), v.(SDKBodyOperationRes))
+}
@@ -16,9 +16,11 @@ import (
 	"net/http"
 	"reflect"
 	"strings"
+	"sync"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/sharedsec"
 )
 
 // Abstract HTTP handler operation definition.
@@ -35,17 +37,30 @@ type (
 		Query map[string][]string
 		// PathParams corresponds to the address `server.request.path_params`
 		PathParams map[string]string
+		// ClientIP corresponds to the address `http.client_ip`
+		ClientIP net.IP
 	}
 
 	// HandlerOperationRes is the HTTP handler operation results.
 	HandlerOperationRes struct {
 		// Status corresponds to the address `server.response.status`.
 		Status int
+		// Headers corresponds to the address `server.response.headers.no_cookies`.
+		Headers map[string][]string
+		// Body corresponds to the address `server.response.body`. It is a
+		// bounded sample of the response body, when available.
+		Body []byte
+		// PathParams corresponds to the address `server.request.path_params`
+		// when the route path parameters are only known once the handler
+		// returned, in which case HandlerOperationArgs.PathParams is nil.
+		PathParams map[string]string
 	}
 )
 
 // WrapHandler wraps the given HTTP handler with the abstract HTTP operation defined by HandlerOperationArgs and
-// HandlerOperationRes.
+// HandlerOperationRes. When the operation gets blocked at start, the handler is not called and the blocking
+// response is written instead. When it gets blocked while the handler is running, the blocking response is written
+// after the handler returned if it didn't write any response yet.
 func WrapHandler(handler http.Handler, span ddtrace.Span, pathParams map[string]string) http.Handler {
 	SetAppSecTags(span)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -54,12 +69,25 @@ func WrapHandler(handler http.Handler, span ddtrace.Span, pathParams map[string]
 			args,
 			nil,
 		)
+		r = r.WithContext(sharedsec.ContextWithOperation(r.Context(), op))
+		h := handler
+		blockingHandler := op.BlockingHandler()
+		if blockingHandler != nil {
+			SetBlockedTags(span)
+			h = blockingHandler
+		}
 		defer func() {
-			var status int
-			if mw, ok := w.(interface{ Status() int }); ok {
-				status = mw.Status()
+			if blockingHandler == nil {
+				if h := op.BlockingHandler(); h != nil {
+					// The operation got blocked while the handler was running
+					SetBlockedTags(span)
+					if mw, ok := w.(interface{ Status() int }); ok && mw.Status() == 0 {
+						h.ServeHTTP(w, r)
+					}
+				}
 			}
-			events := op.Finish(HandlerOperationRes{Status: status})
+			events := op.Finish(MakeHandlerOperationRes(w))
+			SetTags(span, op.Tags())
 			if len(events) == 0 {
 				return
 			}
@@ -70,7 +98,7 @@ func WrapHandler(handler http.Handler, span ddtrace.Span, pathParams map[string]
 			}
 			SetSecurityEventTags(span, events, remoteIP, args.Headers, w.Header())
 		}()
-		handler.ServeHTTP(w, r)
+		h.ServeHTTP(w, r)
 	})
 }
 
@@ -98,6 +126,7 @@ func MakeHandlerOperationArgs(r *http.Request, pathParams map[string]string) Han
 		//   the dynamic instrumentation of the Query() method.
 		Query:      r.URL.Query(),
 		PathParams: pathParams,
+		ClientIP:   ClientIP(headers, r.RemoteAddr),
 	}
 }
 
@@ -107,7 +136,11 @@ func MakeHandlerOperationArgs(r *http.Request, pathParams map[string]string) Han
 // StartOperation() and finished with its Finish().
 type Operation struct {
 	dyngo.Operation
-	events json.RawMessage
+
+	events          []json.RawMessage
+	tags            map[string]interface{}
+	blockingHandler http.Handler
+	mu              sync.Mutex
 }
 
 // StartOperation starts an HTTP handler operation, along with the given
@@ -122,18 +155,55 @@ func StartOperation(args HandlerOperationArgs, parent dyngo.Operation) *Operatio
 
 // Finish the HTTP handler operation, along with the given results, and emits a
 // finish event up in the operation stack.
-func (op *Operation) Finish(res HandlerOperationRes) json.RawMessage {
+func (op *Operation) Finish(res HandlerOperationRes) []json.RawMessage {
 	dyngo.FinishOperation(op, res)
+	op.mu.Lock()
+	defer op.mu.Unlock()
 	return op.events
 }
 
 // AddSecurityEvent adds the security event to the list of events observed
 // during the operation lifetime.
 func (op *Operation) AddSecurityEvent(event json.RawMessage) {
-	// TODO(Julio-Guerra): the current situation involves only one event per
-	//   operation. In the future, multiple events per operation will become
-	//   possible and the append operation should be made thread-safe.
-	op.events = event
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.events = append(op.events, event)
+}
+
+// AddTag adds the span tag to set into the service entry span once the
+// operation is finished.
+func (op *Operation) AddTag(key string, value interface{}) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.tags == nil {
+		op.tags = make(map[string]interface{})
+	}
+	op.tags[key] = value
+}
+
+// Tags returns the span tags added during the operation lifetime.
+func (op *Operation) Tags() map[string]interface{} {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.tags
+}
+
+// Block the HTTP handler operation: the HTTP handler must not be called and
+// the given blocking handler must be used instead to write the response.
+// When blocked while the HTTP handler is running, the blocking handler is
+// only used when the HTTP handler didn't write any response.
+func (op *Operation) Block(h http.Handler) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.blockingHandler = h
+}
+
+// BlockingHandler returns the handler to use instead of the HTTP handler when
+// the operation was blocked, nil otherwise.
+func (op *Operation) BlockingHandler() http.Handler {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.blockingHandler
 }
 
 // HTTP handler operation's start and finish event callback function types.
@@ -0,0 +1,86 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package httpsec
+
+import (
+	"net"
+	"strings"
+)
+
+// List of the headers possibly set by proxies to forward the client IP
+// address, in the order they are looked up.
+var ipHeaders = []string{
+	"x-forwarded-for",
+	"x-real-ip",
+	"true-client-ip",
+	"x-client-ip",
+	"x-forwarded",
+	"forwarded-for",
+	"x-cluster-client-ip",
+	"fastly-client-ip",
+	"cf-connecting-ip",
+	"cf-connecting-ipv6",
+}
+
+// ClientIP resolves the IP address of the client out of the given lowercased
+// request headers and connection remote address. The first global IP address
+// found in the proxy headers is returned, otherwise the remote address is
+// used. It returns nil when no IP address can be found.
+func ClientIP(headers map[string][]string, remoteAddr string) net.IP {
+	for _, name := range ipHeaders {
+		for _, value := range headers[name] {
+			for _, s := range strings.Split(value, ",") {
+				if ip := parseIP(s); ip != nil && isGlobal(ip) {
+					return ip
+				}
+			}
+		}
+	}
+	return parseIP(remoteAddr)
+}
+
+// parseIP parses the given IP address which can possibly include a port.
+func parseIP(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	return net.ParseIP(s)
+}
+
+// privateNets are the private IP address ranges of RFC 1918 for IPv4 and
+// RFC 4193 for IPv6.
+var privateNets = []*net.IPNet{
+	mustParseCIDR("10.0.0.0/8"),
+	mustParseCIDR("172.16.0.0/12"),
+	mustParseCIDR("192.168.0.0/16"),
+	mustParseCIDR("fc00::/7"),
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
+
+// isGlobal returns true when the IP address is neither private, loopback nor
+// link-local.
+func isGlobal(ip net.IP) bool {
+	return !isPrivate(ip) && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsUnspecified()
+}
+
+// isPrivate returns true when the IP address is in a private range, as
+// net.IP.IsPrivate which is only available since Go 1.17.
+func isPrivate(ip net.IP) bool {
+	for _, ipNet := range privateNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package httpsec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIP(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		headers    map[string][]string
+		remoteAddr string
+		expected   string
+	}{
+		{name: "remote-addr", remoteAddr: "1.2.3.4:1234", expected: "1.2.3.4"},
+		{name: "remote-addr-no-port", remoteAddr: "1.2.3.4", expected: "1.2.3.4"},
+		{name: "remote-addr-ipv6", remoteAddr: "[2001:db8::1]:1234", expected: "2001:db8::1"},
+		{name: "invalid", remoteAddr: "invalid", expected: "<nil>"},
+		{
+			name:       "x-forwarded-for",
+			headers:    map[string][]string{"x-forwarded-for": {"10.0.0.1, 8.8.8.8, 1.1.1.1"}},
+			remoteAddr: "127.0.0.1:1234",
+			expected:   "8.8.8.8",
+		},
+		{
+			name:       "private-only",
+			headers:    map[string][]string{"x-forwarded-for": {"10.0.0.1, 192.168.1.1"}},
+			remoteAddr: "127.0.0.1:1234",
+			expected:   "127.0.0.1",
+		},
+		{
+			name:       "private-ranges",
+			headers:    map[string][]string{"x-forwarded-for": {"172.16.0.1, 172.31.255.255, fd00::1, fe80::1, ::1, 172.32.0.1"}},
+			remoteAddr: "127.0.0.1:1234",
+			expected:   "172.32.0.1",
+		},
+		{
+			name:       "header-order",
+			headers:    map[string][]string{"x-real-ip": {"2.2.2.2"}, "x-forwarded-for": {"3.3.3.3"}},
+			remoteAddr: "127.0.0.1:1234",
+			expected:   "3.3.3.3",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, ClientIP(tc.headers, tc.remoteAddr).String())
+		})
+	}
+}
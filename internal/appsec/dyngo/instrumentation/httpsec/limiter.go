@@ -0,0 +1,63 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package httpsec
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// DefaultTraceRateLimit is the default maximum number of traces per second
+// kept because of their security events.
+const DefaultTraceRateLimit = 100
+
+// traceLimiter is the token bucket limiting the number of traces per second
+// kept because of their security events, along with the number of traces
+// with security events which were not kept since the last kept one.
+type traceLimiter struct {
+	limiter *rate.Limiter
+	// Number of traces dropped since the last kept one, accessed atomically.
+	dropped uint64
+}
+
+// newTraceLimiter returns a trace limiter allowing the given number of traces
+// per second, with bursts of the same size.
+func newTraceLimiter(limit uint) *traceLimiter {
+	return &traceLimiter{limiter: rate.NewLimiter(rate.Limit(limit), int(math.Max(1, float64(limit))))}
+}
+
+// allow returns true when the trace of a security event can be kept, along
+// with the number of traces that were not kept since the last kept one.
+func (l *traceLimiter) allow(now time.Time) (keep bool, dropped uint64) {
+	if !l.limiter.AllowN(now, 1) {
+		atomic.AddUint64(&l.dropped, 1)
+		return false, 0
+	}
+	return true, atomic.SwapUint64(&l.dropped, 0)
+}
+
+// The process-wide security event trace limiter, shared by the HTTP and gRPC
+// instrumentations.
+var activeTraceLimiter atomic.Value // *traceLimiter
+
+func init() {
+	activeTraceLimiter.Store(newTraceLimiter(DefaultTraceRateLimit))
+}
+
+// SetTraceRateLimit sets the maximum number of traces per second kept because
+// of their security events. The traces exceeding it still get the security
+// event tags but are left to the regular trace sampling.
+func SetTraceRateLimit(limit uint) {
+	activeTraceLimiter.Store(newTraceLimiter(limit))
+}
+
+// allowTrace returns the decision of the process-wide trace limiter.
+func allowTrace() (keep bool, dropped uint64) {
+	return activeTraceLimiter.Load().(*traceLimiter).allow(time.Now())
+}
@@ -0,0 +1,71 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package httpsec
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceLimiter(t *testing.T) {
+	l := newTraceLimiter(2)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		keep, dropped := l.allow(now)
+		require.True(t, keep)
+		require.Equal(t, uint64(0), dropped)
+	}
+	for i := 0; i < 3; i++ {
+		keep, _ := l.allow(now)
+		require.False(t, keep)
+	}
+
+	// The bucket gets refilled over time and the dropped traces are reported
+	// by the next kept one.
+	keep, dropped := l.allow(now.Add(time.Second))
+	require.True(t, keep)
+	require.Equal(t, uint64(3), dropped)
+	keep, dropped = l.allow(now.Add(time.Second))
+	require.True(t, keep)
+	require.Equal(t, uint64(0), dropped)
+}
+
+// testSpan is a span only recording its tags, as the mocktracer cannot be
+// imported by this package.
+type testSpan struct {
+	ddtrace.Span
+	tags map[string]interface{}
+}
+
+func (s *testSpan) SetTag(key string, value interface{}) { s.tags[key] = value }
+
+func TestSetEventSpanTagsRateLimit(t *testing.T) {
+	SetTraceRateLimit(1)
+	defer SetTraceRateLimit(DefaultTraceRateLimit)
+
+	events := []json.RawMessage{json.RawMessage(`[{"rule":{"id":"ua0-600-12x"}}]`)}
+	spans := make([]*testSpan, 3)
+	for i := range spans {
+		spans[i] = &testSpan{tags: map[string]interface{}{}}
+		require.NoError(t, SetEventSpanTags(spans[i], events))
+	}
+
+	// The first trace is kept, the others are left to the regular sampling
+	require.Equal(t, true, spans[0].tags[ext.ManualKeep])
+	for _, span := range spans[1:] {
+		require.NotContains(t, span.tags, ext.ManualKeep)
+		// The security event tags are still set
+		require.Equal(t, true, span.tags["appsec.event"])
+		require.Contains(t, span.tags, "_dd.appsec.json")
+	}
+}
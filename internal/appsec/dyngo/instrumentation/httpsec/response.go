@@ -0,0 +1,90 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package httpsec
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// ResponseBodySampleSize is the maximum number of bytes of the response body
+// sampled by the response writer wrappers for the WAF.
+const ResponseBodySampleSize = 4 << 10
+
+// responseBodySampling is 1 when the response bodies are sampled. It is
+// disabled by default as it copies the beginning of every response body.
+var responseBodySampling int32
+
+// SetResponseBodySampling enables or disables the sampling of the response
+// bodies monitored by the WAF.
+func SetResponseBodySampling(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&responseBodySampling, v)
+}
+
+// ResponseBodySample is a bounded sample of the beginning of a response body.
+// Response writer wrappers write the response body into it and expose it with
+// a `ResponseBodySample() []byte` method so that it can be monitored. The
+// bytes written beyond ResponseBodySampleSize are ignored, and so are all of
+// them when the response body sampling is disabled.
+type ResponseBodySample struct {
+	buf []byte
+}
+
+// Write implements the io.Writer interface by appending the given bytes to the
+// sample, up to ResponseBodySampleSize bytes. It never fails.
+func (s *ResponseBodySample) Write(b []byte) (int, error) {
+	if atomic.LoadInt32(&responseBodySampling) == 0 {
+		return len(b), nil
+	}
+	if n := ResponseBodySampleSize - len(s.buf); n > 0 {
+		if len(b) < n {
+			n = len(b)
+		}
+		s.buf = append(s.buf, b[:n]...)
+	}
+	return len(b), nil
+}
+
+// Bytes returns the sampled bytes.
+func (s *ResponseBodySample) Bytes() []byte {
+	return s.buf
+}
+
+// MakeHandlerOperationRes creates the HandlerOperationRes out of the given
+// response writer. The status code and body sample are only available when the
+// response writer respectively implements the `Status() int` and
+// `ResponseBodySample() []byte` methods.
+func MakeHandlerOperationRes(w http.ResponseWriter) HandlerOperationRes {
+	var res HandlerOperationRes
+	if mw, ok := w.(interface{ Status() int }); ok {
+		res.Status = mw.Status()
+	}
+	if bw, ok := w.(interface{ ResponseBodySample() []byte }); ok {
+		res.Body = bw.ResponseBodySample()
+	}
+	res.Headers = MakeResponseHeaders(w.Header())
+	return res
+}
+
+// MakeResponseHeaders returns the given response headers with lowercased names
+// and without the cookies.
+func MakeResponseHeaders(h http.Header) map[string][]string {
+	headers := make(map[string][]string, len(h))
+	for k, v := range h {
+		k := strings.ToLower(k)
+		if k == "set-cookie" {
+			// Do not include cookies in the response headers
+			continue
+		}
+		headers[k] = v
+	}
+	return headers
+}
@@ -0,0 +1,79 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package httpsec
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseBodySample(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		var s ResponseBodySample
+		n, err := s.Write([]byte("hello"))
+		require.NoError(t, err)
+		require.Equal(t, 5, n)
+		require.Empty(t, s.Bytes())
+	})
+
+	SetResponseBodySampling(true)
+	defer SetResponseBodySampling(false)
+	var s ResponseBodySample
+	n, err := s.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+	require.Equal(t, []byte("hello"), s.Bytes())
+
+	big := bytes.Repeat([]byte("a"), ResponseBodySampleSize)
+	n, err = s.Write(big)
+	require.NoError(t, err)
+	require.Equal(t, len(big), n)
+	require.Len(t, s.Bytes(), ResponseBodySampleSize)
+	require.Equal(t, []byte("helloaaa"), s.Bytes()[:8])
+
+	n, err = s.Write([]byte("ignored"))
+	require.NoError(t, err)
+	require.Equal(t, 7, n)
+	require.Len(t, s.Bytes(), ResponseBodySampleSize)
+}
+
+type sampledResponseWriter struct {
+	*httptest.ResponseRecorder
+	sample ResponseBodySample
+}
+
+func (w *sampledResponseWriter) Status() int                { return w.Code }
+func (w *sampledResponseWriter) ResponseBodySample() []byte { return w.sample.Bytes() }
+
+func TestMakeHandlerOperationRes(t *testing.T) {
+	t.Run("sampled", func(t *testing.T) {
+		SetResponseBodySampling(true)
+		defer SetResponseBodySampling(false)
+		w := &sampledResponseWriter{ResponseRecorder: httptest.NewRecorder()}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Add("Set-Cookie", "session=secret")
+		w.WriteHeader(http.StatusTeapot)
+		w.sample.Write([]byte("body"))
+
+		res := MakeHandlerOperationRes(w)
+		require.Equal(t, http.StatusTeapot, res.Status)
+		require.Equal(t, map[string][]string{"content-type": {"text/plain"}}, res.Headers)
+		require.Equal(t, []byte("body"), res.Body)
+	})
+
+	t.Run("not-sampled", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		w.Write([]byte("body"))
+		res := MakeHandlerOperationRes(w)
+		require.Equal(t, 0, res.Status)
+		require.Nil(t, res.Body)
+		require.NotNil(t, res.Headers)
+	})
+}
@@ -7,6 +7,7 @@ package httpsec
 
 import (
 	"encoding/json"
+	"fmt"
 	"sort"
 	"strings"
 
@@ -22,30 +23,93 @@ func SetAppSecTags(span ddtrace.Span) {
 	span.SetTag("_dd.runtime_family", "go")
 }
 
-// setEventSpanTags sets the security event span tags into the service entry span.
-func setEventSpanTags(span ddtrace.Span, events json.RawMessage) {
-	// Set the appsec event span tag
-	// eventTag is the structure to use in the `_dd.appsec.json` span tag.
-	type eventTag struct {
-		Triggers json.RawMessage `json:"triggers"`
+// SetTags sets the given span tags into the service entry span.
+func SetTags(span ddtrace.Span, tags map[string]interface{}) {
+	for k, v := range tags {
+		span.SetTag(k, v)
 	}
-	// TODO(Julio-Guerra): avoid serializing the json in the request hot path
-	event, err := json.Marshal(eventTag{Triggers: events})
+}
+
+// SetBlockedTags sets the AppSec-specific span tags when the request was
+// blocked into the service entry span.
+func SetBlockedTags(span ddtrace.Span) {
+	span.SetTag("appsec.blocked", true)
+}
+
+// SetEventSpanTags sets the security event span tags into the service entry
+// span. The trace is kept with the UserKeep sampling priority when allowed by
+// the security event trace rate limit, and otherwise left to the regular trace
+// sampling.
+func SetEventSpanTags(span ddtrace.Span, events []json.RawMessage) error {
+	// Set the appsec event span tag
+	val, err := makeEventTagValue(events)
 	if err != nil {
-		log.Error("appsec: unexpected error while serializing the appsec event span tag: %v", err)
-		return
+		return err
+	}
+	span.SetTag("_dd.appsec.json", string(val))
+	// Keep this span due to the security event, within the rate limit
+	if keep, dropped := allowTrace(); keep {
+		span.SetTag(ext.ManualKeep, true)
+		if dropped > 0 {
+			// Report the number of traces not kept since the last kept one
+			span.SetTag("_dd.appsec.events.dropped", float64(dropped))
+		}
+	} else {
+		log.Debug("appsec: security event trace rate limit reached: leaving the trace to the regular sampling")
 	}
-	span.SetTag("_dd.appsec.json", string(event))
-	// Keep this span due to the security event
-	span.SetTag(ext.ManualKeep, true)
 	span.SetTag("_dd.origin", "appsec")
 	// Set the appsec.event tag needed by the appsec backend
 	span.SetTag("appsec.event", true)
+	return nil
+}
+
+// Create the value of the security event tag.
+// TODO(Julio-Guerra): a future libddwaf version should return something
+// avoiding us the following events concatenation logic which currently
+// involves unserializing the top-level JSON arrays to concatenate them
+// together.
+// TODO(Julio-Guerra): avoid serializing the json in the request hot path
+func makeEventTagValue(events []json.RawMessage) (json.RawMessage, error) {
+	var v interface{}
+	if l := len(events); l == 1 {
+		// eventTag is the structure to use in the `_dd.appsec.json` span tag.
+		// In this case of 1 event, it already is an array as expected.
+		type eventTag struct {
+			Triggers json.RawMessage `json:"triggers"`
+		}
+		v = eventTag{Triggers: events[0]}
+	} else {
+		// eventTag is the structure to use in the `_dd.appsec.json` span tag.
+		// With more than one event, we need to concatenate the arrays together
+		// (ie. convert [][]json.RawMessage into []json.RawMessage).
+		type eventTag struct {
+			Triggers []json.RawMessage `json:"triggers"`
+		}
+		concatenated := make([]json.RawMessage, 0, l) // at least len(events)
+		for _, event := range events {
+			// Unmarshal the top level array
+			var tmp []json.RawMessage
+			if err := json.Unmarshal(event, &tmp); err != nil {
+				return nil, fmt.Errorf("unexpected error while unserializing the appsec event `%s`: %v", string(event), err)
+			}
+			concatenated = append(concatenated, tmp...)
+		}
+		v = eventTag{Triggers: concatenated}
+	}
+
+	tag, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected error while serializing the appsec event span tag: %v", err)
+	}
+	return tag, nil
 }
 
 // SetSecurityEventTags sets the AppSec-specific span tags when a security event occurred into the service entry span.
-func SetSecurityEventTags(span ddtrace.Span, events json.RawMessage, remoteIP string, headers, respHeaders map[string][]string) {
-	setEventSpanTags(span, events)
+func SetSecurityEventTags(span ddtrace.Span, events []json.RawMessage, remoteIP string, headers, respHeaders map[string][]string) {
+	if err := SetEventSpanTags(span, events); err != nil {
+		log.Error("appsec: %v", err)
+		return
+	}
 	span.SetTag("network.client.ip", remoteIP)
 	for h, v := range NormalizeHTTPHeaders(headers) {
 		span.SetTag("http.request.headers."+h, v)
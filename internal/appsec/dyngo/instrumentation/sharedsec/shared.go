@@ -0,0 +1,143 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+// Package sharedsec is the instrumentation API and contract for AppSec
+// operations shared by the HTTP and gRPC instrumentations, such as the
+// monitoring of the authenticated user of a request. Its operations are
+// children of the HTTP or gRPC handler operation found in the request context.
+package sharedsec
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo"
+)
+
+// ErrBlocked is the error returned by the monitoring functions of this package
+// when the request got blocked. The caller must stop processing the request
+// and return as soon as possible.
+var ErrBlocked = errors.New("request blocked by the security policy")
+
+type operationContextKey struct{}
+
+// ContextWithOperation returns a copy of the given context holding the given
+// handler operation, so that the operations of this package can be started as
+// its children.
+func ContextWithOperation(ctx context.Context, op dyngo.Operation) context.Context {
+	return context.WithValue(ctx, operationContextKey{}, op)
+}
+
+// OperationFromContext returns the handler operation stored in the given
+// context, or nil when there is none.
+func OperationFromContext(ctx context.Context) dyngo.Operation {
+	op, _ := ctx.Value(operationContextKey{}).(dyngo.Operation)
+	return op
+}
+
+type (
+	// UserIDOperation represents the monitoring of the authenticated user
+	// of the request. It must be created with StartUserIDOperation() and
+	// finished with its Finish() method. The operation can be blocked by its
+	// start event listeners using its Block() method.
+	UserIDOperation struct {
+		dyngo.Operation
+
+		blocked bool
+		mu      sync.Mutex
+	}
+	// UserIDOperationArgs is the user ID operation arguments.
+	UserIDOperationArgs struct {
+		// UserID corresponds to the address `usr.id`.
+		UserID string
+	}
+	// UserIDOperationRes is the user ID operation results. Empty as of today.
+	UserIDOperationRes struct{}
+)
+
+// MonitorUser monitors the given authenticated user ID of the request whose
+// handler operation is stored in the given context. ErrBlocked is returned
+// when the user got blocked. Nothing is monitored and nil is returned when
+// the context has no handler operation, such as when AppSec is disabled.
+func MonitorUser(ctx context.Context, userID string) error {
+	parent := OperationFromContext(ctx)
+	if parent == nil {
+		return nil
+	}
+	op := StartUserIDOperation(UserIDOperationArgs{UserID: userID}, parent)
+	op.Finish(UserIDOperationRes{})
+	if op.Blocked() {
+		return ErrBlocked
+	}
+	return nil
+}
+
+// StartUserIDOperation starts a user ID operation, along with the given
+// arguments and parent operation, and emits a start event up in the operation
+// stack. When parent is nil, the operation is linked to the global root
+// operation.
+func StartUserIDOperation(args UserIDOperationArgs, parent dyngo.Operation) *UserIDOperation {
+	op := &UserIDOperation{Operation: dyngo.NewOperation(parent)}
+	dyngo.StartOperation(op, args)
+	return op
+}
+
+// Finish the user ID operation, along with the given results, and emits a
+// finish event up in the operation stack.
+func (op *UserIDOperation) Finish(res UserIDOperationRes) {
+	dyngo.FinishOperation(op, res)
+}
+
+// Block the user ID operation. The parent handler operation is expected to be
+// blocked too by the event listener.
+func (op *UserIDOperation) Block() {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.blocked = true
+}
+
+// Blocked returns true when the operation was blocked.
+func (op *UserIDOperation) Blocked() bool {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.blocked
+}
+
+// User ID operation's start and finish event callback function types.
+type (
+	// OnUserIDOperationStart function type, called when a user ID operation
+	// starts.
+	OnUserIDOperationStart func(*UserIDOperation, UserIDOperationArgs)
+	// OnUserIDOperationFinish function type, called when a user ID operation
+	// finishes.
+	OnUserIDOperationFinish func(*UserIDOperation, UserIDOperationRes)
+)
+
+var (
+	userIDOperationArgsType = reflect.TypeOf((*UserIDOperationArgs)(nil)).Elem()
+	userIDOperationResType  = reflect.TypeOf((*UserIDOperationRes)(nil)).Elem()
+)
+
+// ListenedType returns the type a OnUserIDOperationStart event listener
+// listens to, which is the UserIDOperationArgs type.
+func (OnUserIDOperationStart) ListenedType() reflect.Type { return userIDOperationArgsType }
+
+// Call the underlying event listener function by performing the type-assertion
+// on v whose type is the one returned by ListenedType().
+func (f OnUserIDOperationStart) Call(op dyngo.Operation, v interface{}) {
+	f(op.(*UserIDOperation), v.(UserIDOperationArgs))
+}
+
+// ListenedType returns the type a OnUserIDOperationFinish event listener
+// listens to, which is the UserIDOperationRes type.
+func (OnUserIDOperationFinish) ListenedType() reflect.Type { return userIDOperationResType }
+
+// Call the underlying event listener function by performing the type-assertion
+// on v whose type is the one returned by ListenedType().
+func (f OnUserIDOperationFinish) Call(op dyngo.Operation, v interface{}) {
+	f(op.(*UserIDOperation), v.(UserIDOperationRes))
+}
@@ -0,0 +1,304 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build appsec
+// +build appsec
+
+package appsec
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/grpcsec"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/httpsec"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/sharedsec"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+)
+
+// Rules data types.
+const (
+	// List of IP addresses or CIDR ranges, matched against the client IP.
+	ipWithExpirationType = "ip_with_expiration"
+	// List of values, matched against the authenticated user ID.
+	dataWithExpirationType = "data_with_expiration"
+)
+
+// Rules data address of the client IP.
+const httpClientIPAddr = "http.client_ip"
+
+// rulesData is the parsed representation of the rules data, which is a list of
+// IP and user denylists whose entries can expire.
+type rulesData struct {
+	ips   []ipDenylist
+	users []userDenylist
+}
+
+type (
+	ipDenylist struct {
+		id      string
+		block   bool
+		entries []ipDenylistEntry
+	}
+	ipDenylistEntry struct {
+		network    *net.IPNet
+		expiration time.Time
+	}
+	userDenylist struct {
+		id    string
+		block bool
+		// Map of user IDs to their expiration time, which is zero when they
+		// never expire.
+		entries map[string]time.Time
+	}
+)
+
+// denylistMatch is the result of a successful denylist lookup.
+type denylistMatch struct {
+	id    string
+	block bool
+}
+
+// parseRulesData parses the given JSON rules data of the form:
+//
+//	{"rules_data":[{"id":"blocked_ips","type":"ip_with_expiration","on_match":["block"],"data":[{"value":"1.2.3.0/24","expiration":1700000000}]}]}
+//
+// An expiration value of 0 means the entry never expires.
+func parseRulesData(data []byte) (*rulesData, error) {
+	var parsed struct {
+		RulesData []struct {
+			ID      string   `json:"id"`
+			Type    string   `json:"type"`
+			OnMatch []string `json:"on_match"`
+			Data    []struct {
+				Value      string `json:"value"`
+				Expiration int64  `json:"expiration"`
+			} `json:"data"`
+		} `json:"rules_data"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("could not parse the rules data: %v", err)
+	}
+	var rd rulesData
+	for _, entry := range parsed.RulesData {
+		var block bool
+		for _, action := range entry.OnMatch {
+			if action == blockAction {
+				block = true
+			}
+		}
+		switch entry.Type {
+		case ipWithExpirationType:
+			list := ipDenylist{id: entry.ID, block: block}
+			for _, d := range entry.Data {
+				network, err := parseIPNetwork(d.Value)
+				if err != nil {
+					return nil, fmt.Errorf("could not parse the rules data %s: %v", entry.ID, err)
+				}
+				list.entries = append(list.entries, ipDenylistEntry{network: network, expiration: expirationTime(d.Expiration)})
+			}
+			rd.ips = append(rd.ips, list)
+		case dataWithExpirationType:
+			list := userDenylist{id: entry.ID, block: block, entries: make(map[string]time.Time, len(entry.Data))}
+			for _, d := range entry.Data {
+				list.entries[d.Value] = expirationTime(d.Expiration)
+			}
+			rd.users = append(rd.users, list)
+		default:
+			log.Debug("appsec: ignoring the rules data %s of unsupported type %s", entry.ID, entry.Type)
+		}
+	}
+	return &rd, nil
+}
+
+// parseIPNetwork parses the given IP address or CIDR range.
+func parseIPNetwork(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		return network, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid ip address `%s`", s)
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+func expirationTime(expiration int64) time.Time {
+	if expiration == 0 {
+		return time.Time{}
+	}
+	return time.Unix(expiration, 0)
+}
+
+func expired(expiration, now time.Time) bool {
+	return !expiration.IsZero() && !now.Before(expiration)
+}
+
+// matchIP returns the IP denylist containing the given IP address.
+func (rd *rulesData) matchIP(ip net.IP, now time.Time) (denylistMatch, bool) {
+	for _, list := range rd.ips {
+		for _, entry := range list.entries {
+			if !expired(entry.expiration, now) && entry.network.Contains(ip) {
+				return denylistMatch{id: list.id, block: list.block}, true
+			}
+		}
+	}
+	return denylistMatch{}, false
+}
+
+// matchUser returns the user denylist containing the given user ID.
+func (rd *rulesData) matchUser(userID string, now time.Time) (denylistMatch, bool) {
+	for _, list := range rd.users {
+		if expiration, ok := list.entries[userID]; ok && !expired(expiration, now) {
+			return denylistMatch{id: list.id, block: list.block}, true
+		}
+	}
+	return denylistMatch{}, false
+}
+
+// makeDenylistEvent returns the security event of the given denylist match,
+// using the same JSON format as the WAF matches.
+func makeDenylistEvent(m denylistMatch, address, value string) json.RawMessage {
+	type (
+		parameter struct {
+			Address   string   `json:"address"`
+			KeyPath   []string `json:"key_path"`
+			Value     string   `json:"value"`
+			Highlight []string `json:"highlight"`
+		}
+		ruleMatch struct {
+			Operator      string      `json:"operator"`
+			OperatorValue string      `json:"operator_value"`
+			Parameters    []parameter `json:"parameters"`
+		}
+		rule struct {
+			ID   string            `json:"id"`
+			Name string            `json:"name"`
+			Tags map[string]string `json:"tags"`
+		}
+		event struct {
+			Rule        rule        `json:"rule"`
+			RuleMatches []ruleMatch `json:"rule_matches"`
+		}
+	)
+	operator := "exact_match"
+	if address == httpClientIPAddr {
+		operator = "ip_match"
+	}
+	ev, _ := json.Marshal([]event{{
+		Rule: rule{
+			ID:   m.id,
+			Name: "Denylisted " + address,
+			Tags: map[string]string{"type": "denylist", "category": "security_response"},
+		},
+		RuleMatches: []ruleMatch{{
+			Operator: operator,
+			Parameters: []parameter{{
+				Address:   address,
+				KeyPath:   []string{},
+				Value:     value,
+				Highlight: []string{value},
+			}},
+		}},
+	}})
+	return ev
+}
+
+// rulesDataStore holds the current rules data which can be atomically replaced
+// at run time.
+type rulesDataStore struct {
+	v atomic.Value
+}
+
+func (s *rulesDataStore) load() *rulesData {
+	rd, _ := s.v.Load().(*rulesData)
+	return rd
+}
+
+// update parses and atomically replaces the current rules data.
+func (s *rulesDataStore) update(data []byte) error {
+	rd, err := parseRulesData(data)
+	if err != nil {
+		return err
+	}
+	s.v.Store(rd)
+	log.Debug("appsec: rules data updated with %d ip and %d user denylist(s)", len(rd.ips), len(rd.users))
+	return nil
+}
+
+// registerDenylists registers the event listeners matching the client IP of
+// the HTTP and gRPC handler operations, and the authenticated user IDs,
+// against the denylists of the rules data.
+func registerDenylists(store *rulesDataStore, blockingHandler http.Handler) dyngo.UnregisterFunc {
+	return dyngo.Register(
+		httpsec.OnHandlerOperationStart(func(op *httpsec.Operation, args httpsec.HandlerOperationArgs) {
+			if m, ok := matchClientIP(store, args.ClientIP); ok {
+				op.AddSecurityEvent(makeDenylistEvent(m, httpClientIPAddr, args.ClientIP.String()))
+				if m.block {
+					log.Debug("appsec: blocking the request of the denylisted ip address")
+					op.Block(blockingHandler)
+				}
+			}
+		}),
+		grpcsec.OnHandlerOperationStart(func(op *grpcsec.HandlerOperation, args grpcsec.HandlerOperationArgs) {
+			if m, ok := matchClientIP(store, args.ClientIP); ok {
+				op.AddSecurityEvent(makeDenylistEvent(m, httpClientIPAddr, args.ClientIP.String()))
+				if m.block {
+					log.Debug("appsec: blocking the rpc of the denylisted ip address")
+					op.Block()
+				}
+			}
+		}),
+		sharedsec.OnUserIDOperationStart(func(op *sharedsec.UserIDOperation, args sharedsec.UserIDOperationArgs) {
+			rd := store.load()
+			if rd == nil {
+				return
+			}
+			m, ok := rd.matchUser(args.UserID, time.Now())
+			if !ok {
+				return
+			}
+			event := makeDenylistEvent(m, userIDAddr, args.UserID)
+			switch parent := op.Parent().(type) {
+			case *httpsec.Operation:
+				parent.AddSecurityEvent(event)
+				if m.block {
+					log.Debug("appsec: blocking the request of the denylisted user")
+					parent.Block(blockingHandler)
+					op.Block()
+				}
+			case *grpcsec.HandlerOperation:
+				parent.AddSecurityEvent(event)
+				if m.block {
+					log.Debug("appsec: blocking the rpc of the denylisted user")
+					parent.Block()
+					op.Block()
+				}
+			}
+		}),
+	)
+}
+
+func matchClientIP(store *rulesDataStore, ip net.IP) (denylistMatch, bool) {
+	if ip == nil {
+		return denylistMatch{}, false
+	}
+	rd := store.load()
+	if rd == nil {
+		return denylistMatch{}, false
+	}
+	return rd.matchIP(ip, time.Now())
+}
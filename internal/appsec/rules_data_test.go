@@ -0,0 +1,94 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build appsec
+// +build appsec
+
+package appsec
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRulesData(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		rd, err := parseRulesData([]byte(`{"rules_data":[
+			{"id":"blocked_ips","type":"ip_with_expiration","on_match":["block"],"data":[{"value":"1.2.3.4","expiration":0},{"value":"10.0.0.0/8","expiration":1000},{"value":"2001:db8::/32"}]},
+			{"id":"flagged_users","type":"data_with_expiration","data":[{"value":"alice","expiration":0},{"value":"bob","expiration":1000}]},
+			{"id":"unknown","type":"unknown","data":[{"value":"x"}]}
+		]}`))
+		require.NoError(t, err)
+		require.Len(t, rd.ips, 1)
+		require.Len(t, rd.users, 1)
+
+		before, after := time.Unix(999, 0), time.Unix(1000, 0)
+		for _, tc := range []struct {
+			ip      string
+			now     time.Time
+			matched bool
+		}{
+			{ip: "1.2.3.4", now: after, matched: true},
+			{ip: "1.2.3.5", now: before, matched: false},
+			{ip: "10.1.2.3", now: before, matched: true},
+			{ip: "10.1.2.3", now: after, matched: false},
+			{ip: "2001:db8::1", now: after, matched: true},
+			{ip: "2001:db9::1", now: after, matched: false},
+		} {
+			m, ok := rd.matchIP(net.ParseIP(tc.ip), tc.now)
+			require.Equal(t, tc.matched, ok, tc.ip)
+			if ok {
+				require.Equal(t, denylistMatch{id: "blocked_ips", block: true}, m)
+			}
+		}
+
+		m, ok := rd.matchUser("alice", after)
+		require.True(t, ok)
+		require.Equal(t, denylistMatch{id: "flagged_users"}, m)
+		_, ok = rd.matchUser("bob", before)
+		require.True(t, ok)
+		_, ok = rd.matchUser("bob", after)
+		require.False(t, ok)
+		_, ok = rd.matchUser("eve", before)
+		require.False(t, ok)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, data := range []string{
+			`not json`,
+			`{"rules_data":[{"id":"ips","type":"ip_with_expiration","data":[{"value":"not an ip"}]}]}`,
+			`{"rules_data":[{"id":"ips","type":"ip_with_expiration","data":[{"value":"1.2.3.4/64"}]}]}`,
+		} {
+			_, err := parseRulesData([]byte(data))
+			require.Error(t, err, data)
+		}
+	})
+}
+
+func TestDenylistEvent(t *testing.T) {
+	ev := makeDenylistEvent(denylistMatch{id: "blocked_ips"}, httpClientIPAddr, "1.2.3.4")
+	var parsed []struct {
+		Rule struct {
+			ID string `json:"id"`
+		} `json:"rule"`
+		RuleMatches []struct {
+			Operator   string `json:"operator"`
+			Parameters []struct {
+				Address string `json:"address"`
+				Value   string `json:"value"`
+			} `json:"parameters"`
+		} `json:"rule_matches"`
+	}
+	require.NoError(t, json.Unmarshal(ev, &parsed))
+	require.Len(t, parsed, 1)
+	require.Equal(t, "blocked_ips", parsed[0].Rule.ID)
+	require.Equal(t, "ip_match", parsed[0].RuleMatches[0].Operator)
+	require.Equal(t, httpClientIPAddr, parsed[0].RuleMatches[0].Parameters[0].Address)
+	require.Equal(t, "1.2.3.4", parsed[0].RuleMatches[0].Parameters[0].Value)
+}
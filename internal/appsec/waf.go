@@ -9,8 +9,10 @@
 package appsec
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -19,31 +21,59 @@ import (
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/grpcsec"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/httpsec"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/dyngo/instrumentation/sharedsec"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/appsec/waf"
 	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
 )
 
-// Register the WAF event listener.
-func registerWAF(rules []byte, timeout time.Duration) (unreg dyngo.UnregisterFunc, err error) {
-	// Check the WAF is healthy
-	if _, err := waf.Health(); err != nil {
+// wafState is the WAF instance along with the state derived from its security
+// rules. It is atomically replaced when the rules get updated.
+type wafState struct {
+	handle        *waf.Handle
+	httpAddresses []string
+	grpcAddresses []string
+	blockingRules map[string]struct{}
+	exclusions    []exclusion
+	rulesInfo     rulesInfo
+	wafVersion    string
+	// Tags of the WAF metrics.
+	metricTags []string
+	// Set to 1 once the rules info got reported in a span, accessed atomically.
+	rulesInfoReported uint32
+}
+
+// newWAFState instantiates the WAF with the given security rules, without the
+// given disabled rules.
+func newWAFState(rules []byte, disabledRules map[string]struct{}, wafVersion string) (s *wafState, err error) {
+	prepared, err := prepareRules(rules, disabledRules)
+	if err != nil {
 		return nil, err
 	}
+	rules = prepared.rules
 
 	// Instantiate the WAF
-	waf, err := waf.NewHandle(rules)
+	handle, err := waf.NewHandle(rules)
 	if err != nil {
 		return nil, err
 	}
 	// Close the WAF in case of an error in what's following
 	defer func() {
 		if err != nil {
-			waf.Close()
+			handle.Close()
 		}
 	}()
+	// Add the rules the WAF couldn't load to the rule load errors
+	for msg, ids := range handle.RuleErrors() {
+		log.Warn("appsec: %d security rule(s) not loaded by the waf: %s: %v", len(ids), msg, ids)
+		if prepared.info.errors == nil {
+			prepared.info.errors = make(map[string][]string)
+		}
+		prepared.info.errors[msg] = append(prepared.info.errors[msg], ids...)
+		prepared.info.loaded -= len(ids)
+	}
 
 	// Check if there are addresses in the rule
-	ruleAddresses := waf.Addresses()
+	ruleAddresses := handle.Addresses()
 	if len(ruleAddresses) == 0 {
 		return nil, errors.New("no addresses found in the rule")
 	}
@@ -54,86 +84,301 @@ func registerWAF(rules []byte, timeout time.Duration) (unreg dyngo.UnregisterFun
 	} else if len(notSupported) > 0 {
 		log.Debug("appsec: the addresses present in the rule are partially supported: not supported=%v", notSupported)
 	}
+	log.Debug("appsec: http waf listening to addresses %v", httpAddresses)
+	log.Debug("appsec: grpc waf listening to addresses %v", grpcAddresses)
 
-	// Register the WAF event listener
-	var unregisterHTTP, unregisterGRPC dyngo.UnregisterFunc
-	if len(httpAddresses) > 0 {
-		log.Debug("appsec: registering http waf listening to addresses %v", httpAddresses)
-		unregisterHTTP = dyngo.Register(newHTTPWAFEventListener(waf, httpAddresses, timeout))
+	// Find the rules blocking the requests they match
+	blockingRules, err := blockingRuleIDs(rules)
+	if err != nil {
+		return nil, err
 	}
-	if len(grpcAddresses) > 0 {
-		log.Debug("appsec: registering grpc waf listening to addresses %v", grpcAddresses)
-		unregisterGRPC = dyngo.Register(newGRPCWAFEventListener(waf, grpcAddresses, timeout))
+	if len(blockingRules) > 0 {
+		log.Debug("appsec: blocking mode enabled by %d rule(s)", len(blockingRules))
 	}
 
-	// Return an unregistration function that will also release the WAF instance.
-	return func() {
-		defer waf.Close()
-		if unregisterHTTP != nil {
-			unregisterHTTP()
-		}
-		if unregisterGRPC != nil {
-			unregisterGRPC()
-		}
+	return &wafState{
+		handle:        handle,
+		httpAddresses: httpAddresses,
+		grpcAddresses: grpcAddresses,
+		blockingRules: blockingRules,
+		exclusions:    prepared.exclusions,
+		rulesInfo:     prepared.info,
+		wafVersion:    wafVersion,
+		metricTags:    makeWAFMetricTags(wafVersion, prepared.info.version),
 	}, nil
 }
 
+// run the WAF with the given values and returns the matches which are not
+// excluded for the given request path. The run metrics are added to the given
+// request metrics.
+func (s *wafState) run(wafCtx *waf.Context, values map[string]interface{}, timeout time.Duration, path string, metrics *wafRunMetrics) []byte {
+	return filterMatches(runWAF(wafCtx, values, timeout, metrics), s.exclusions, path)
+}
+
+// wafManager owns the WAF event listeners and the WAF state they use, which
+// can be replaced at run time without unregistering the listeners.
+type wafManager struct {
+	state atomic.Value // *wafState
+	// mu serializes the updates of the WAF state.
+	mu            sync.Mutex
+	rules         []byte
+	disabledRules map[string]struct{}
+	wafVersion    string
+	statsd        StatsdClient
+	unregister    dyngo.UnregisterFunc
+}
+
+// Register the WAF event listeners.
+func registerWAF(rules []byte, disabledRules []string, timeout time.Duration, blockingHandler http.Handler, statsd StatsdClient) (*wafManager, error) {
+	// Check the WAF is healthy
+	version, err := waf.Health()
+	if err != nil {
+		return nil, err
+	}
+	if reason, degraded := waf.Degraded(); degraded {
+		log.Warn("appsec: running in degraded mode because %s: the security rules are evaluated by a reduced pure-Go rule engine only supporting the match_regex, phrase_match and ip_match operators", reason)
+	}
+
+	m := &wafManager{
+		rules:         rules,
+		disabledRules: makeStringSet(disabledRules),
+		wafVersion:    version.String(),
+		statsd:        statsd,
+	}
+	s, err := newWAFState(rules, m.disabledRules, m.wafVersion)
+	if err != nil {
+		return nil, err
+	}
+	m.state.Store(s)
+	m.unregister = dyngo.Register(
+		newHTTPWAFEventListener(m, timeout, blockingHandler),
+		newGRPCWAFEventListener(m, timeout),
+	)
+	return m, nil
+}
+
+// load returns the current WAF state.
+func (m *wafManager) load() *wafState {
+	return m.state.Load().(*wafState)
+}
+
+// updateRules replaces the security rules with the given ones.
+func (m *wafManager) updateRules(rules []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.swap(rules, m.disabledRules)
+}
+
+// disableRules replaces the set of disabled rule IDs with the given one.
+func (m *wafManager) disableRules(ids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.swap(m.rules, makeStringSet(ids))
+}
+
+// swap instantiates a new WAF state and atomically replaces the current one,
+// whose WAF handle is released once the in-flight WAF contexts using it are
+// closed. The current state is kept in case of an error.
+func (m *wafManager) swap(rules []byte, disabledRules map[string]struct{}) error {
+	s, err := newWAFState(rules, disabledRules, m.wafVersion)
+	if err != nil {
+		return err
+	}
+	old := m.load()
+	m.state.Store(s)
+	m.rules, m.disabledRules = rules, disabledRules
+	go old.handle.Close()
+	log.Info("appsec: security rules updated")
+	return nil
+}
+
+// close unregisters the WAF event listeners and releases the WAF.
+func (m *wafManager) close() {
+	m.unregister()
+	m.load().handle.Close()
+}
+
+func makeStringSet(values []string) map[string]struct{} {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return set
+}
+
 // newWAFEventListener returns the WAF event listener to register in order to enable it.
-func newHTTPWAFEventListener(handle *waf.Handle, addresses []string, timeout time.Duration) dyngo.EventListener {
+func newHTTPWAFEventListener(m *wafManager, timeout time.Duration, blockingHandler http.Handler) dyngo.EventListener {
 	return httpsec.OnHandlerOperationStart(func(op *httpsec.Operation, args httpsec.HandlerOperationArgs) {
-		// At the moment, AppSec doesn't block the requests, and so we can use the fact we are in monitoring-only mode
-		// to call the WAF only once at the end of the handler operation.
-		op.On(httpsec.OnHandlerOperationFinish(func(op *httpsec.Operation, res httpsec.HandlerOperationRes) {
-			wafCtx := waf.NewContext(handle)
-			if wafCtx == nil {
-				// The WAF event listener got concurrently released
-				return
-			}
-			defer wafCtx.Close()
+		s := m.load()
+		addresses := s.httpAddresses
+		if len(addresses) == 0 {
+			return
+		}
+		var monitorStatus, monitorResponseHeaders, monitorResponseBody, monitorUser, monitorBody, monitorPathParams bool
+		path := requestPath(args.RequestURI)
+		metrics := m.newRunMetrics(s)
+		wafCtx := waf.NewContext(s.handle)
+		if wafCtx == nil {
+			// The WAF event listener got concurrently released
+			return
+		}
 
-			// Run the WAF on the rule addresses available in the request args
-			values := make(map[string]interface{}, len(addresses))
-			for _, addr := range addresses {
-				switch addr {
-				case serverRequestRawURIAddr:
-					values[serverRequestRawURIAddr] = args.RequestURI
-				case serverRequestHeadersNoCookiesAddr:
-					if headers := args.Headers; headers != nil {
-						values[serverRequestHeadersNoCookiesAddr] = headers
-					}
-				case serverRequestCookiesAddr:
-					if cookies := args.Cookies; cookies != nil {
-						values[serverRequestCookiesAddr] = cookies
-					}
-				case serverRequestQueryAddr:
-					if query := args.Query; query != nil {
-						values[serverRequestQueryAddr] = query
-					}
-				case serverRequestPathParams:
-					if pathParams := args.PathParams; pathParams != nil {
-						values[serverRequestPathParams] = pathParams
-					}
-				case serverResponseStatusAddr:
-					values[serverResponseStatusAddr] = res.Status
+		// Run the WAF on the request addresses as soon as the operation starts,
+		// so that the request can be blocked before the handler gets called.
+		values := make(map[string]interface{}, len(addresses))
+		for _, addr := range addresses {
+			switch addr {
+			case serverRequestRawURIAddr:
+				values[serverRequestRawURIAddr] = args.RequestURI
+			case serverRequestHeadersNoCookiesAddr:
+				if headers := args.Headers; headers != nil {
+					values[serverRequestHeadersNoCookiesAddr] = headers
+				}
+			case serverRequestCookiesAddr:
+				if cookies := args.Cookies; cookies != nil {
+					values[serverRequestCookiesAddr] = cookies
 				}
+			case serverRequestQueryAddr:
+				if query := args.Query; query != nil {
+					values[serverRequestQueryAddr] = query
+				}
+			case serverRequestPathParams:
+				if pathParams := args.PathParams; pathParams != nil {
+					values[serverRequestPathParams] = pathParams
+				} else {
+					// The path parameters may only be known once the
+					// handler returned
+					monitorPathParams = true
+				}
+			case serverResponseStatusAddr:
+				monitorStatus = true
+			case serverResponseHeadersNoCookiesAddr:
+				monitorResponseHeaders = true
+			case serverResponseBodyAddr:
+				monitorResponseBody = true
+			case userIDAddr:
+				monitorUser = true
+			case serverRequestBodyAddr:
+				monitorBody = true
+			}
+		}
+		if matches := s.run(wafCtx, values, timeout, path, metrics); len(matches) > 0 {
+			log.Debug("appsec: attack detected by the waf")
+			op.AddSecurityEvent(matches)
+			if isBlocking(matches, s.blockingRules) {
+				log.Debug("appsec: blocking the request")
+				op.Block(blockingHandler)
 			}
-			matches := runWAF(wafCtx, values, timeout)
+		}
+
+		if monitorUser {
+			op.On(sharedsec.OnUserIDOperationStart(func(userOp *sharedsec.UserIDOperation, args sharedsec.UserIDOperationArgs) {
+				matches := s.run(wafCtx, map[string]interface{}{userIDAddr: args.UserID}, timeout, path, metrics)
+				if len(matches) == 0 {
+					return
+				}
+				log.Debug("appsec: attack detected by the waf on the user id")
+				op.AddSecurityEvent(matches)
+				if isBlocking(matches, s.blockingRules) {
+					log.Debug("appsec: blocking the request of the user")
+					op.Block(blockingHandler)
+					userOp.Block()
+				}
+			}))
+		}
 
-			// Log the attacks if any
+		if monitorBody {
+			op.On(httpsec.OnSDKBodyOperationStart(func(_ httpsec.SDKBodyOperation, args httpsec.SDKBodyOperationArgs) {
+				matches := s.run(wafCtx, map[string]interface{}{serverRequestBodyAddr: args.Body}, timeout, path, metrics)
+				if len(matches) == 0 {
+					return
+				}
+				log.Debug("appsec: attack detected by the waf in the request body")
+				op.AddSecurityEvent(matches)
+				if isBlocking(matches, s.blockingRules) {
+					log.Debug("appsec: blocking the request")
+					op.Block(blockingHandler)
+				}
+			}))
+		}
+
+		op.On(httpsec.OnHandlerOperationFinish(func(op *httpsec.Operation, res httpsec.HandlerOperationRes) {
+			defer wafCtx.Close()
+			defer s.addMetricTags(op, metrics)
+			values := make(map[string]interface{}, 4)
+			if monitorPathParams && res.PathParams != nil {
+				values[serverRequestPathParams] = res.PathParams
+			}
+			if monitorStatus {
+				values[serverResponseStatusAddr] = res.Status
+			}
+			if monitorResponseHeaders && res.Headers != nil {
+				values[serverResponseHeadersNoCookiesAddr] = res.Headers
+			}
+			if monitorResponseBody && len(res.Body) > 0 {
+				values[serverResponseBodyAddr] = res.Body
+			}
+			if len(values) == 0 {
+				return
+			}
+			matches := s.run(wafCtx, values, timeout, path, metrics)
 			if len(matches) == 0 {
 				return
 			}
 			log.Debug("appsec: attack detected by the waf")
 			op.AddSecurityEvent(matches)
 		}))
-
 	})
 }
 
 // newGRPCWAFEventListener returns the WAF event listener to register in order
 // to enable it.
-func newGRPCWAFEventListener(handle *waf.Handle, _ []string, timeout time.Duration) dyngo.EventListener {
+func newGRPCWAFEventListener(m *wafManager, timeout time.Duration) dyngo.EventListener {
 	return grpcsec.OnHandlerOperationStart(func(op *grpcsec.HandlerOperation, _ grpcsec.HandlerOperationArgs) {
+		s := m.load()
+		metrics := m.newRunMetrics(s)
+		op.On(grpcsec.OnHandlerOperationFinish(func(op *grpcsec.HandlerOperation, _ grpcsec.HandlerOperationRes) {
+			s.addMetricTags(op, metrics)
+		}))
+		var monitorMessage, monitorUser bool
+		for _, addr := range s.grpcAddresses {
+			switch addr {
+			case grpcServerRequestMessage:
+				monitorMessage = true
+			case userIDAddr:
+				monitorUser = true
+			}
+		}
+		if monitorUser {
+			op.On(sharedsec.OnUserIDOperationStart(func(userOp *sharedsec.UserIDOperation, args sharedsec.UserIDOperationArgs) {
+				// The rules may have been updated since the RPC started, and the
+				// WAF handle of the previous state released.
+				s := m.load()
+				wafCtx := waf.NewContext(s.handle)
+				if wafCtx == nil {
+					// The WAF event listener got concurrently released
+					return
+				}
+				defer wafCtx.Close()
+				matches := s.run(wafCtx, map[string]interface{}{userIDAddr: args.UserID}, timeout, "", metrics)
+				if len(matches) == 0 {
+					return
+				}
+				log.Debug("appsec: attack detected by the grpc waf on the user id")
+				op.AddSecurityEvent(matches)
+				if isBlocking(matches, s.blockingRules) {
+					log.Debug("appsec: blocking the rpc of the user")
+					op.Block()
+					userOp.Block()
+				}
+			}))
+		}
+		if !monitorMessage {
+			return
+		}
 		// Limit the maximum number of security events, as a streaming RPC could
 		// receive unlimited number of messages where we could find security events
 		const maxWAFEventsPerRequest = 10
@@ -156,29 +401,86 @@ func newGRPCWAFEventListener(handle *waf.Handle, _ []string, timeout time.Durati
 			//      the RPC lifetime.
 			//   2. We avoid the limitation of 1 event per attack type.
 			// TODO(Julio-Guerra): a future libddwaf API should solve this out.
-			wafCtx := waf.NewContext(handle)
+			// The current state is loaded for every message, as the rules may
+			// have been updated since the RPC started, and the WAF handle of the
+			// previous state released.
+			s := m.load()
+			wafCtx := waf.NewContext(s.handle)
 			if wafCtx == nil {
 				// The WAF event listener got concurrently released
 				return
 			}
 			defer wafCtx.Close()
 			// Run the WAF on the rule addresses available in the args
-			// Note that we don't check if the address is present in the rules
-			// as we only support one at the moment, so this callback cannot be
-			// set when the address is not present.
-			events := runWAF(wafCtx, map[string]interface{}{grpcServerRequestMessage: res.Message}, timeout)
+			events := s.run(wafCtx, map[string]interface{}{grpcServerRequestMessage: res.Message}, timeout, "", metrics)
 			if len(events) == 0 {
 				return
 			}
 			log.Debug("appsec: attack detected by the grpc waf")
 			atomic.AddUint32(&nbEvents, 1)
 			op.AddSecurityEvent(events)
+			if isBlocking(events, s.blockingRules) {
+				log.Debug("appsec: blocking the rpc")
+				op.Block()
+			}
 		}))
 	})
 }
 
-func runWAF(wafCtx *waf.Context, values map[string]interface{}, timeout time.Duration) []byte {
+// blockingRuleIDs returns the set of IDs of the rules having the block action
+// in their list of on_match actions.
+func blockingRuleIDs(rules []byte) (map[string]struct{}, error) {
+	var parsed struct {
+		Rules []struct {
+			ID      string   `json:"id"`
+			OnMatch []string `json:"on_match"`
+		} `json:"rules"`
+	}
+	if err := json.Unmarshal(rules, &parsed); err != nil {
+		return nil, fmt.Errorf("could not parse the rules: %v", err)
+	}
+	var ids map[string]struct{}
+	for _, rule := range parsed.Rules {
+		for _, action := range rule.OnMatch {
+			if action != blockAction {
+				continue
+			}
+			if ids == nil {
+				ids = make(map[string]struct{})
+			}
+			ids[rule.ID] = struct{}{}
+		}
+	}
+	return ids, nil
+}
+
+// isBlocking returns true when one of the rules that matched, according to the
+// given WAF matches, is a blocking rule.
+func isBlocking(matches []byte, blockingRules map[string]struct{}) bool {
+	if len(blockingRules) == 0 {
+		return false
+	}
+	var events []struct {
+		Rule struct {
+			ID string `json:"id"`
+		} `json:"rule"`
+	}
+	if err := json.Unmarshal(matches, &events); err != nil {
+		log.Error("appsec: unexpected error while parsing the waf matches: %v", err)
+		return false
+	}
+	for _, event := range events {
+		if _, ok := blockingRules[event.Rule.ID]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func runWAF(wafCtx *waf.Context, values map[string]interface{}, timeout time.Duration, metrics *wafRunMetrics) []byte {
+	start := time.Now()
 	matches, err := wafCtx.Run(values, timeout)
+	metrics.record(time.Since(start), err == waf.ErrTimeout)
 	if err != nil {
 		if err == waf.ErrTimeout {
 			log.Debug("appsec: waf timeout value of %s reached", timeout)
@@ -190,14 +492,25 @@ func runWAF(wafCtx *waf.Context, values map[string]interface{}, timeout time.Dur
 	return matches
 }
 
+// Rule action blocking the request when the rule matches.
+const blockAction = "block"
+
 // HTTP rule addresses currently supported by the WAF
 const (
-	serverRequestRawURIAddr           = "server.request.uri.raw"
-	serverRequestHeadersNoCookiesAddr = "server.request.headers.no_cookies"
-	serverRequestCookiesAddr          = "server.request.cookies"
-	serverRequestQueryAddr            = "server.request.query"
-	serverRequestPathParams           = "server.request.path_params"
-	serverResponseStatusAddr          = "server.response.status"
+	serverRequestRawURIAddr            = "server.request.uri.raw"
+	serverRequestHeadersNoCookiesAddr  = "server.request.headers.no_cookies"
+	serverRequestCookiesAddr           = "server.request.cookies"
+	serverRequestQueryAddr             = "server.request.query"
+	serverRequestPathParams            = "server.request.path_params"
+	serverRequestBodyAddr              = "server.request.body"
+	serverResponseStatusAddr           = "server.response.status"
+	serverResponseHeadersNoCookiesAddr = "server.response.headers.no_cookies"
+	serverResponseBodyAddr             = "server.response.body"
+)
+
+// Rule addresses supported by the WAF for both HTTP and gRPC.
+const (
+	userIDAddr = "usr.id"
 )
 
 // List of HTTP rule addresses currently supported by the WAF
@@ -207,7 +520,11 @@ var httpAddresses = []string{
 	serverRequestCookiesAddr,
 	serverRequestQueryAddr,
 	serverRequestPathParams,
+	serverRequestBodyAddr,
 	serverResponseStatusAddr,
+	serverResponseHeadersNoCookiesAddr,
+	serverResponseBodyAddr,
+	userIDAddr,
 }
 
 // gRPC rule addresses currently supported by the WAF
@@ -218,6 +535,7 @@ const (
 // List of gRPC rule addresses currently supported by the WAF
 var grpcAddresses = []string{
 	grpcServerRequestMessage,
+	userIDAddr,
 }
 
 func init() {
@@ -231,13 +549,22 @@ func init() {
 func supportedAddresses(ruleAddresses []string) (supportedHTTP, supportedGRPC, notSupported []string) {
 	// Filter the supported addresses only
 	for _, addr := range ruleAddresses {
-		if i := sort.SearchStrings(httpAddresses, addr); i < len(httpAddresses) && httpAddresses[i] == addr {
+		http, grpc := contains(httpAddresses, addr), contains(grpcAddresses, addr)
+		if http {
 			supportedHTTP = append(supportedHTTP, addr)
-		} else if i := sort.SearchStrings(grpcAddresses, addr); i < len(grpcAddresses) && grpcAddresses[i] == addr {
+		}
+		if grpc {
 			supportedGRPC = append(supportedGRPC, addr)
-		} else {
+		}
+		if !http && !grpc {
 			notSupported = append(notSupported, addr)
 		}
 	}
 	return
 }
+
+// contains returns true when the given sorted list contains the given address.
+func contains(addresses []string, addr string) bool {
+	i := sort.SearchStrings(addresses, addr)
+	return i < len(addresses) && addresses[i] == addr
+}
@@ -62,6 +62,12 @@ func Health() (Version, error) {
 	return Version(v), nil
 }
 
+// Degraded returns true along with the reason when the WAF runs the reduced
+// pure-Go rule engine instead of libddwaf.
+func Degraded() (reason string, degraded bool) {
+	return "", false
+}
+
 // Handle represents an instance of the WAF for a given ruleset.
 type Handle struct {
 	handle C.ddwaf_handle
@@ -140,6 +146,12 @@ func (waf *Handle) Addresses() []string {
 	return waf.addresses
 }
 
+// RuleErrors returns the IDs of the rules the WAF could not load, by error
+// message. libddwaf v1.0.16 doesn't report them, so it always returns nil.
+func (waf *Handle) RuleErrors() map[string][]string {
+	return nil
+}
+
 // Close the WAF and release the underlying C memory as soon as there are
 // no more WAF contexts using the rule.
 func (waf *Handle) Close() {
@@ -3,9 +3,9 @@
 // This product includes software developed at Datadog (https://www.datadoghq.com/).
 // Copyright 2016 Datadog, Inc.
 
-// Build when CGO is disabled or the target OS or Arch are not supported
-//go:build !appsec || !cgo || windows || !amd64
-// +build !appsec !cgo windows !amd64
+// Build when the appsec build tag is missing
+//go:build !appsec
+// +build !appsec
 
 package waf
 
@@ -35,12 +35,20 @@ func Health() (*Version, error) {
 	return nil, errDisabledReason
 }
 
+// Degraded returns true along with the reason when the WAF runs the reduced
+// pure-Go rule engine instead of libddwaf.
+func Degraded() (reason string, degraded bool) { return "", false }
+
 // NewHandle creates a new instance of the WAF with the given JSON rule.
 func NewHandle([]byte) (*Handle, error) { return nil, errDisabledReason }
 
 // Addresses returns the list of addresses the WAF rule is expecting.
 func (*Handle) Addresses() []string { return nil }
 
+// RuleErrors returns the IDs of the rules the WAF could not load, by error
+// message.
+func (*Handle) RuleErrors() map[string][]string { return nil }
+
 // Close the WAF and release the underlying C memory as soon as there are
 // no more WAF contexts using the rule.
 func (*Handle) Close() {}
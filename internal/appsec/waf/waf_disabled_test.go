@@ -3,9 +3,9 @@
 // This product includes software developed at Datadog (https://www.datadoghq.com/).
 // Copyright 2016 Datadog, Inc.
 
-// Build when CGO is disabled or the target OS or Arch are not supported
-//go:build !appsec || !cgo || windows || !amd64
-// +build !appsec !cgo windows !amd64
+// Build when the appsec build tag is missing
+//go:build !appsec
+// +build !appsec
 
 package waf
 
@@ -0,0 +1,343 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+// Build the pure-Go rule engine when libddwaf cannot be used: when CGO is
+// disabled or the target OS or Arch are not supported.
+//go:build appsec && (!cgo || windows || !amd64 || (!linux && !darwin))
+// +build appsec
+// +build !cgo windows !amd64 !linux,!darwin
+
+package waf
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// Version of the pure-Go rule engine, reported as the WAF version.
+const goEngineVersion = "1.0.0-go"
+
+// Limits of the values the rule engine walks through, aligned with the
+// libddwaf ones.
+const (
+	maxValueDepth    = 20
+	maxStringLength  = 4096
+	maxContainerSize = 256
+)
+
+// Version of the WAF.
+type Version struct{}
+
+// String returns the string representation of the version.
+func (*Version) String() string { return goEngineVersion }
+
+// Health allows knowing if the WAF can be used. It returns the current WAF
+// version and a nil error when the WAF library is healthy. Otherwise, it
+// returns a nil version and an error describing the issue.
+func Health() (Version, error) {
+	return Version{}, nil
+}
+
+// Degraded returns true along with the reason when the WAF runs the reduced
+// pure-Go rule engine instead of libddwaf.
+func Degraded() (reason string, degraded bool) {
+	return degradedReason, true
+}
+
+// Handle represents an instance of the WAF for a given ruleset. The pure-Go
+// rule engine only supports a subset of the rule operators and transformers,
+// and the rules using other ones are not loaded and reported by RuleErrors().
+type Handle struct {
+	rules []*rule
+	// addresses the WAF rule is expecting.
+	addresses []string
+	// Rule IDs of the rules that couldn't be loaded, by error message.
+	ruleErrors map[string][]string
+	// Set to 1 once the handle is closed, accessed atomically.
+	closed uint32
+}
+
+// NewHandle creates a new instance of the WAF with the given JSON rule.
+func NewHandle(jsonRule []byte) (*Handle, error) {
+	var parsed struct {
+		Rules []ruleDefinition `json:"rules"`
+	}
+	if err := json.Unmarshal(jsonRule, &parsed); err != nil {
+		return nil, fmt.Errorf("could not parse the WAF rule: %v", err)
+	}
+
+	waf := &Handle{}
+	addresses := make(map[string]struct{})
+	for _, def := range parsed.Rules {
+		r, err := newRule(def)
+		if err != nil {
+			if waf.ruleErrors == nil {
+				waf.ruleErrors = make(map[string][]string)
+			}
+			waf.ruleErrors[err.Error()] = append(waf.ruleErrors[err.Error()], def.ID)
+			continue
+		}
+		waf.rules = append(waf.rules, r)
+		for _, c := range r.conditions {
+			for _, in := range c.inputs {
+				addresses[in.address] = struct{}{}
+			}
+		}
+	}
+	if len(addresses) == 0 {
+		return nil, ErrEmptyRuleAddresses
+	}
+	for addr := range addresses {
+		waf.addresses = append(waf.addresses, addr)
+	}
+	sort.Strings(waf.addresses)
+	return waf, nil
+}
+
+// Addresses returns the list of addresses the WAF rule is expecting.
+func (waf *Handle) Addresses() []string {
+	return waf.addresses
+}
+
+// RuleErrors returns the IDs of the rules the WAF could not load, by error
+// message.
+func (waf *Handle) RuleErrors() map[string][]string {
+	return waf.ruleErrors
+}
+
+// Close the WAF. The existing WAF contexts can still be used until they are
+// closed, while no new ones can be created.
+func (waf *Handle) Close() {
+	atomic.StoreUint32(&waf.closed, 1)
+}
+
+// Context is a WAF execution context. It allows to run the WAF incrementally
+// by calling it multiple times to run its rules every time new addresses
+// become available. Each request must have its own Context.
+type Context struct {
+	waf *Handle
+	// Values of the addresses given so far.
+	values map[string]interface{}
+	// Set of the rules which already matched, as rules match at most once per
+	// context.
+	matched map[*rule]struct{}
+	// Mutex protecting the concurrent use of the context.
+	mu sync.Mutex
+}
+
+// NewContext a new WAF context. A nil value is returned when the WAF handle
+// can no longer be used.
+func NewContext(waf *Handle) *Context {
+	if atomic.LoadUint32(&waf.closed) == 1 {
+		return nil
+	}
+	return &Context{
+		waf:     waf,
+		values:  make(map[string]interface{}),
+		matched: make(map[*rule]struct{}),
+	}
+}
+
+// Run the WAF with the given Go values and timeout. The rules listening to
+// at least one of the given addresses are evaluated against every address
+// value given so far to the context.
+func (c *Context) Run(values map[string]interface{}, timeout time.Duration) (matches []byte, err error) {
+	if len(values) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for addr, v := range values {
+		c.values[addr] = v
+	}
+	deadline := time.Now().Add(timeout)
+	var events []ruleEvent
+	for _, r := range c.waf.rules {
+		if time.Now().After(deadline) {
+			err = ErrTimeout
+			break
+		}
+		if _, ok := c.matched[r]; ok || !r.listensTo(values) {
+			continue
+		}
+		ruleMatches, ok := r.eval(c.values)
+		if !ok {
+			continue
+		}
+		c.matched[r] = struct{}{}
+		events = append(events, ruleEvent{
+			Rule:        eventRule{ID: r.id, Name: r.name, Tags: r.tags},
+			RuleMatches: ruleMatches,
+		})
+	}
+	if len(events) > 0 {
+		if matches, err = json.Marshal(events); err != nil {
+			return nil, err
+		}
+	}
+	return matches, err
+}
+
+// Close the WAF context.
+func (c *Context) Close() {}
+
+// JSON format of the WAF events, aligned with the libddwaf one.
+type (
+	ruleEvent struct {
+		Rule        eventRule   `json:"rule"`
+		RuleMatches []ruleMatch `json:"rule_matches"`
+	}
+	eventRule struct {
+		ID   string            `json:"id"`
+		Name string            `json:"name"`
+		Tags map[string]string `json:"tags"`
+	}
+	ruleMatch struct {
+		Operator      string           `json:"operator"`
+		OperatorValue string           `json:"operator_value"`
+		Parameters    []matchParameter `json:"parameters"`
+	}
+	matchParameter struct {
+		Address   string        `json:"address"`
+		KeyPath   []interface{} `json:"key_path"`
+		Value     string        `json:"value"`
+		Highlight []string      `json:"highlight"`
+	}
+)
+
+// walk calls fn with every string of the given Go value, along with its key
+// path, until fn returns true. Numbers and booleans are walked as strings, as
+// libddwaf does. It returns true when fn returned true.
+func walk(v reflect.Value, keyPath []interface{}, depth int, fn func(keyPath []interface{}, s string) bool) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		// The traversal of pointer and interfaces is not accounted in the depth
+		// as it has no impact on the value depth
+		if v.IsNil() {
+			return false
+		}
+		return walk(v.Elem(), keyPath, depth, fn)
+
+	case reflect.String:
+		return fn(keyPath, truncate(v.String()))
+
+	case reflect.Bool:
+		return fn(keyPath, strconv.FormatBool(v.Bool()))
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return fn(keyPath, strconv.FormatInt(v.Int(), 10))
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fn(keyPath, strconv.FormatUint(v.Uint(), 10))
+
+	case reflect.Float32, reflect.Float64:
+		return fn(keyPath, strconv.FormatInt(int64(math.Round(v.Float())), 10))
+
+	case reflect.Array, reflect.Slice:
+		if v.Type() == reflect.TypeOf([]byte(nil)) {
+			return fn(keyPath, truncate(string(v.Bytes())))
+		}
+		if depth <= 0 {
+			return false
+		}
+		for i := 0; i < v.Len() && i < maxContainerSize; i++ {
+			if walk(v.Index(i), append(keyPath, i), depth-1, fn) {
+				return true
+			}
+		}
+
+	case reflect.Map:
+		if depth <= 0 {
+			return false
+		}
+		n := 0
+		for iter := v.MapRange(); iter.Next() && n < maxContainerSize; n++ {
+			key, ok := mapKey(iter.Key())
+			if !ok {
+				continue
+			}
+			if walk(iter.Value(), append(keyPath, key), depth-1, fn) {
+				return true
+			}
+		}
+
+	case reflect.Struct:
+		if depth <= 0 {
+			return false
+		}
+		typ := v.Type()
+		for i := 0; i < typ.NumField() && i < maxContainerSize; i++ {
+			// Skip private fields
+			name := typ.Field(i).Name
+			if len(name) < 1 || unicode.IsLower(rune(name[0])) {
+				continue
+			}
+			if walk(v.Field(i), append(keyPath, name), depth-1, fn) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lookup returns the value of the given map key path into the given Go value.
+func lookup(v reflect.Value, keyPath []string) (reflect.Value, bool) {
+	for _, key := range keyPath {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return reflect.Value{}, false
+			}
+			v = v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+			if !v.IsValid() {
+				return reflect.Value{}, false
+			}
+		case reflect.Struct:
+			v = v.FieldByName(key)
+			if !v.IsValid() {
+				return reflect.Value{}, false
+			}
+		default:
+			return reflect.Value{}, false
+		}
+	}
+	return v, true
+}
+
+// mapKey returns the string value of the given map key, when it is a string.
+func mapKey(v reflect.Value) (string, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.String {
+		return "", false
+	}
+	return v.String(), true
+}
+
+// truncate the given string to the maximum string length.
+func truncate(s string) string {
+	if len(s) > maxStringLength {
+		return s[:maxStringLength]
+	}
+	return s
+}
@@ -9,4 +9,4 @@
 
 package waf
 
-var disabledReason = "cgo was disabled during the compilation and should be enabled in order to compile with the waf"
+var degradedReason = "cgo was disabled during the compilation and should be enabled in order to compile with libddwaf"
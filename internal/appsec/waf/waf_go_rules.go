@@ -0,0 +1,259 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build appsec && (!cgo || windows || !amd64 || (!linux && !darwin))
+// +build appsec
+// +build !cgo windows !amd64 !linux,!darwin
+
+package waf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// ruleDefinition is the JSON definition of a security rule.
+type ruleDefinition struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Tags       map[string]string `json:"tags"`
+	Conditions []struct {
+		Operator   string `json:"operator"`
+		Parameters struct {
+			Inputs []struct {
+				Address string   `json:"address"`
+				KeyPath []string `json:"key_path"`
+			} `json:"inputs"`
+			Regex   string   `json:"regex"`
+			List    []string `json:"list"`
+			Options struct {
+				CaseSensitive bool `json:"case_sensitive"`
+				MinLength     int  `json:"min_length"`
+			} `json:"options"`
+		} `json:"parameters"`
+	} `json:"conditions"`
+	Transformers []string `json:"transformers"`
+}
+
+// rule is a security rule matching when all its conditions match.
+type rule struct {
+	id, name     string
+	tags         map[string]string
+	conditions   []*condition
+	transformers []func(string) string
+}
+
+// condition matches when its operator matches one of the values of its inputs.
+type condition struct {
+	inputs        []ruleInput
+	operator      string
+	operatorValue string
+	// match returns the part of the given value matching the operator.
+	match     func(string) (highlight string, ok bool)
+	minLength int
+}
+
+// ruleInput is an address, along with the optional key path of the value to
+// select in it.
+type ruleInput struct {
+	address string
+	keyPath []string
+}
+
+// Rule operators supported by the pure-Go rule engine.
+const (
+	matchRegexOperator  = "match_regex"
+	phraseMatchOperator = "phrase_match"
+	ipMatchOperator     = "ip_match"
+)
+
+// Rule transformers supported by the pure-Go rule engine.
+var transformers = map[string]func(string) string{
+	"lowercase": strings.ToLower,
+	"removeNulls": func(s string) string {
+		return strings.ReplaceAll(s, "\x00", "")
+	},
+}
+
+// newRule returns the rule of the given definition, or an error when it uses a
+// rule operator or transformer not supported by the pure-Go rule engine.
+func newRule(def ruleDefinition) (*rule, error) {
+	r := &rule{id: def.ID, name: def.Name, tags: def.Tags}
+	for _, name := range def.Transformers {
+		transform, ok := transformers[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported transformer %s", name)
+		}
+		r.transformers = append(r.transformers, transform)
+	}
+	if len(def.Conditions) == 0 {
+		return nil, errors.New("missing conditions")
+	}
+	for _, def := range def.Conditions {
+		c := &condition{operator: def.Operator, minLength: def.Parameters.Options.MinLength}
+		for _, in := range def.Parameters.Inputs {
+			c.inputs = append(c.inputs, ruleInput{address: in.Address, keyPath: in.KeyPath})
+		}
+		switch def.Operator {
+		case matchRegexOperator:
+			expr := def.Parameters.Regex
+			if !def.Parameters.Options.CaseSensitive {
+				expr = "(?i)" + expr
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex: %v", err)
+			}
+			c.operatorValue = def.Parameters.Regex
+			c.match = func(s string) (string, bool) {
+				loc := re.FindStringIndex(s)
+				if loc == nil {
+					return "", false
+				}
+				return s[loc[0]:loc[1]], true
+			}
+		case phraseMatchOperator:
+			phrases := def.Parameters.List
+			c.match = func(s string) (string, bool) {
+				for _, p := range phrases {
+					if strings.Contains(s, p) {
+						return p, true
+					}
+				}
+				return "", false
+			}
+		case ipMatchOperator:
+			networks, err := parseNetworks(def.Parameters.List)
+			if err != nil {
+				return nil, err
+			}
+			c.match = func(s string) (string, bool) {
+				ip := net.ParseIP(strings.TrimSpace(s))
+				if ip == nil {
+					return "", false
+				}
+				for _, n := range networks {
+					if n.Contains(ip) {
+						return s, true
+					}
+				}
+				return "", false
+			}
+		default:
+			return nil, fmt.Errorf("unsupported operator %s", def.Operator)
+		}
+		r.conditions = append(r.conditions, c)
+	}
+	return r, nil
+}
+
+// parseNetworks parses the given list of IP addresses and CIDR networks.
+func parseNetworks(list []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip address %s", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ip network %s", s)
+		}
+		networks = append(networks, n)
+	}
+	return networks, nil
+}
+
+// listensTo returns true when one of the rule inputs is among the given
+// address values.
+func (r *rule) listensTo(values map[string]interface{}) bool {
+	for _, c := range r.conditions {
+		for _, in := range c.inputs {
+			if _, ok := values[in.address]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// eval evaluates the rule conditions against the given address values, and
+// returns their matches when they all match.
+func (r *rule) eval(values map[string]interface{}) ([]ruleMatch, bool) {
+	matches := make([]ruleMatch, 0, len(r.conditions))
+	for _, c := range r.conditions {
+		m, ok := c.eval(values, r.transform)
+		if !ok {
+			return nil, false
+		}
+		matches = append(matches, m)
+	}
+	return matches, true
+}
+
+// transform applies the rule transformers to the given value.
+func (r *rule) transform(s string) string {
+	for _, transform := range r.transformers {
+		s = transform(s)
+	}
+	return s
+}
+
+// eval evaluates the condition against the given address values, and returns
+// the match of the first value matching the operator.
+func (c *condition) eval(values map[string]interface{}, transform func(string) string) (m ruleMatch, ok bool) {
+	for _, in := range c.inputs {
+		v, exists := values[in.address]
+		if !exists {
+			continue
+		}
+		root, exists := lookup(reflect.ValueOf(v), in.keyPath)
+		if !exists {
+			continue
+		}
+		keyPath := make([]interface{}, 0, len(in.keyPath))
+		for _, key := range in.keyPath {
+			keyPath = append(keyPath, key)
+		}
+		var param matchParameter
+		ok = walk(root, keyPath, maxValueDepth, func(keyPath []interface{}, s string) bool {
+			transformed := transform(s)
+			if len(transformed) < c.minLength {
+				return false
+			}
+			highlight, ok := c.match(transformed)
+			if !ok {
+				return false
+			}
+			param = matchParameter{
+				Address:   in.address,
+				KeyPath:   append(make([]interface{}, 0, len(keyPath)), keyPath...),
+				Value:     s,
+				Highlight: []string{highlight},
+			}
+			return true
+		})
+		if ok {
+			return ruleMatch{
+				Operator:      c.operator,
+				OperatorValue: c.operatorValue,
+				Parameters:    []matchParameter{param},
+			}, true
+		}
+	}
+	return ruleMatch{}, false
+}
@@ -4,10 +4,10 @@
 // Copyright 2016 Datadog, Inc.
 
 // Build when CGO is enabled but the target OS or architecture are not supported
-//go:build appsec && cgo && (windows || !amd64)
+//go:build appsec && cgo && (windows || !amd64 || (!linux && !darwin))
 // +build appsec
 // +build cgo
-// +build windows !amd64
+// +build windows !amd64 !linux,!darwin
 
 package waf
 
@@ -16,4 +16,4 @@ import (
 	"runtime"
 )
 
-var disabledReason = fmt.Sprintf("the target operating-system %s or architecture %s are not supported", runtime.GOOS, runtime.GOARCH)
+var degradedReason = fmt.Sprintf("the target operating-system %s or architecture %s are not supported by libddwaf", runtime.GOOS, runtime.GOARCH)
@@ -0,0 +1,263 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build appsec && (!cgo || windows || !amd64 || (!linux && !darwin))
+// +build appsec
+// +build !cgo windows !amd64 !linux,!darwin
+
+package waf
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealth(t *testing.T) {
+	version, err := Health()
+	require.NoError(t, err)
+	require.Equal(t, goEngineVersion, version.String())
+	reason, degraded := Degraded()
+	require.True(t, degraded)
+	require.Equal(t, degradedReason, reason)
+}
+
+const testRules = `{
+  "version": "2.1",
+  "rules": [
+    {
+      "id": "ua0-600-12x",
+      "name": "Arachni",
+      "tags": {"type": "security_scanner", "category": "attack_attempt"},
+      "conditions": [
+        {
+          "operator": "match_regex",
+          "parameters": {
+            "inputs": [{"address": "server.request.headers.no_cookies", "key_path": ["user-agent"]}],
+            "regex": "^arachni\\/v"
+          }
+        }
+      ]
+    },
+    {
+      "id": "crs-913-120",
+      "name": "Scanner filename",
+      "tags": {"type": "security_scanner", "category": "attack_attempt"},
+      "conditions": [
+        {
+          "operator": "phrase_match",
+          "parameters": {
+            "inputs": [{"address": "server.request.query"}],
+            "list": ["appscan_fingerprint"]
+          }
+        }
+      ],
+      "transformers": ["lowercase"]
+    },
+    {
+      "id": "blk-001-001",
+      "name": "Denylisted IP",
+      "tags": {"type": "ip_addresses", "category": "blocking"},
+      "conditions": [
+        {
+          "operator": "ip_match",
+          "parameters": {
+            "inputs": [{"address": "http.client_ip"}],
+            "list": ["1.2.3.4", "10.0.0.0/8", "::1"]
+          }
+        }
+      ]
+    },
+    {
+      "id": "scanner-404",
+      "name": "Scanner path not found",
+      "tags": {"type": "security_scanner", "category": "attack_attempt"},
+      "conditions": [
+        {
+          "operator": "phrase_match",
+          "parameters": {"inputs": [{"address": "server.request.uri.raw"}], "list": ["/.git"]}
+        },
+        {
+          "operator": "match_regex",
+          "parameters": {"inputs": [{"address": "server.response.status"}], "regex": "^404$"}
+        }
+      ]
+    },
+    {
+      "id": "crs-941-100",
+      "name": "XSS",
+      "tags": {"type": "xss", "category": "attack_attempt"},
+      "conditions": [
+        {"operator": "is_xss", "parameters": {"inputs": [{"address": "server.request.query"}]}}
+      ]
+    },
+    {
+      "id": "crs-942-100",
+      "name": "SQLi",
+      "tags": {"type": "sql_injection", "category": "attack_attempt"},
+      "conditions": [
+        {"operator": "match_regex", "parameters": {"inputs": [{"address": "server.request.query"}], "regex": "union"}}
+      ],
+      "transformers": ["urlDecode"]
+    }
+  ]
+}`
+
+// event is the parsed JSON representation of a WAF event.
+type event struct {
+	Rule struct {
+		ID string `json:"id"`
+	} `json:"rule"`
+	RuleMatches []struct {
+		Operator   string `json:"operator"`
+		Parameters []struct {
+			Address   string        `json:"address"`
+			KeyPath   []interface{} `json:"key_path"`
+			Value     string        `json:"value"`
+			Highlight []string      `json:"highlight"`
+		} `json:"parameters"`
+	} `json:"rule_matches"`
+}
+
+func parseEvents(t *testing.T, matches []byte) []event {
+	var events []event
+	require.NoError(t, json.Unmarshal(matches, &events))
+	return events
+}
+
+func TestNewHandle(t *testing.T) {
+	t.Run("unsupported-rules", func(t *testing.T) {
+		waf, err := NewHandle([]byte(testRules))
+		require.NoError(t, err)
+		defer waf.Close()
+		require.Equal(t, []string{"http.client_ip", "server.request.headers.no_cookies", "server.request.query", "server.request.uri.raw", "server.response.status"}, waf.Addresses())
+		require.Equal(t, map[string][]string{
+			"unsupported operator is_xss":       {"crs-941-100"},
+			"unsupported transformer urlDecode": {"crs-942-100"},
+		}, waf.RuleErrors())
+	})
+
+	t.Run("invalid-json", func(t *testing.T) {
+		_, err := NewHandle([]byte(`{`))
+		require.Error(t, err)
+	})
+
+	t.Run("no-supported-rules", func(t *testing.T) {
+		_, err := NewHandle([]byte(`{"version":"2.1","rules":[{"id":"r","conditions":[{"operator":"is_sqli","parameters":{"inputs":[{"address":"server.request.query"}]}}]}]}`))
+		require.Equal(t, ErrEmptyRuleAddresses, err)
+	})
+
+	t.Run("invalid-ip", func(t *testing.T) {
+		waf, err := NewHandle([]byte(`{"version":"2.1","rules":[{"id":"r","conditions":[{"operator":"ip_match","parameters":{"inputs":[{"address":"http.client_ip"}],"list":["not an ip"]}}]}]}`))
+		require.Equal(t, ErrEmptyRuleAddresses, err)
+		require.Nil(t, waf)
+	})
+}
+
+func TestRun(t *testing.T) {
+	waf, err := NewHandle([]byte(testRules))
+	require.NoError(t, err)
+	defer waf.Close()
+
+	t.Run("match-regex", func(t *testing.T) {
+		wafCtx := NewContext(waf)
+		require.NotNil(t, wafCtx)
+		defer wafCtx.Close()
+		matches, err := wafCtx.Run(map[string]interface{}{
+			"server.request.headers.no_cookies": map[string][]string{"user-agent": {"Mozilla", "Arachni/v1"}},
+		}, time.Second)
+		require.NoError(t, err)
+		events := parseEvents(t, matches)
+		require.Len(t, events, 1)
+		require.Equal(t, "ua0-600-12x", events[0].Rule.ID)
+		param := events[0].RuleMatches[0].Parameters[0]
+		require.Equal(t, "match_regex", events[0].RuleMatches[0].Operator)
+		require.Equal(t, []interface{}{"user-agent", 1.}, param.KeyPath)
+		require.Equal(t, "Arachni/v1", param.Value)
+		require.Equal(t, []string{"Arachni/v"}, param.Highlight)
+
+		// A rule matches once per context
+		matches, err = wafCtx.Run(map[string]interface{}{
+			"server.request.headers.no_cookies": map[string][]string{"user-agent": {"Arachni/v2"}},
+		}, time.Second)
+		require.NoError(t, err)
+		require.Nil(t, matches)
+	})
+
+	t.Run("phrase-match", func(t *testing.T) {
+		wafCtx := NewContext(waf)
+		defer wafCtx.Close()
+		matches, err := wafCtx.Run(map[string]interface{}{
+			"server.request.query": map[string][]string{"q": {"/AppScan_Fingerprint/"}},
+		}, time.Second)
+		require.NoError(t, err)
+		events := parseEvents(t, matches)
+		require.Len(t, events, 1)
+		require.Equal(t, "crs-913-120", events[0].Rule.ID)
+		require.Equal(t, []string{"appscan_fingerprint"}, events[0].RuleMatches[0].Parameters[0].Highlight)
+	})
+
+	t.Run("ip-match", func(t *testing.T) {
+		for ip, match := range map[string]bool{"1.2.3.4": true, "10.1.2.3": true, "::1": true, "1.2.3.5": false, "not an ip": false} {
+			wafCtx := NewContext(waf)
+			matches, err := wafCtx.Run(map[string]interface{}{"http.client_ip": ip}, time.Second)
+			wafCtx.Close()
+			require.NoError(t, err)
+			if match {
+				require.Len(t, parseEvents(t, matches), 1, ip)
+			} else {
+				require.Nil(t, matches, ip)
+			}
+		}
+	})
+
+	t.Run("incremental-conditions", func(t *testing.T) {
+		wafCtx := NewContext(waf)
+		defer wafCtx.Close()
+		matches, err := wafCtx.Run(map[string]interface{}{"server.request.uri.raw": "/.git/config"}, time.Second)
+		require.NoError(t, err)
+		require.Nil(t, matches)
+		matches, err = wafCtx.Run(map[string]interface{}{"server.response.status": 404}, time.Second)
+		require.NoError(t, err)
+		events := parseEvents(t, matches)
+		require.Len(t, events, 1)
+		require.Equal(t, "scanner-404", events[0].Rule.ID)
+		require.Len(t, events[0].RuleMatches, 2)
+	})
+
+	t.Run("no-match", func(t *testing.T) {
+		wafCtx := NewContext(waf)
+		defer wafCtx.Close()
+		matches, err := wafCtx.Run(map[string]interface{}{
+			"server.request.headers.no_cookies": map[string][]string{"user-agent": {"Mozilla"}},
+			"server.request.query":              map[string][]string{"q": {"union"}},
+		}, time.Second)
+		require.NoError(t, err)
+		require.Nil(t, matches)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		wafCtx := NewContext(waf)
+		defer wafCtx.Close()
+		_, err := wafCtx.Run(map[string]interface{}{"server.request.uri.raw": "/"}, 0)
+		require.Equal(t, ErrTimeout, err)
+	})
+}
+
+func TestClose(t *testing.T) {
+	waf, err := NewHandle([]byte(testRules))
+	require.NoError(t, err)
+	wafCtx := NewContext(waf)
+	require.NotNil(t, wafCtx)
+	waf.Close()
+	require.Nil(t, NewContext(waf))
+	// The existing contexts can still be used
+	matches, err := wafCtx.Run(map[string]interface{}{"http.client_ip": "1.2.3.4"}, time.Second)
+	require.NoError(t, err)
+	require.NotNil(t, matches)
+	wafCtx.Close()
+}
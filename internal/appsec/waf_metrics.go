@@ -0,0 +1,118 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build appsec
+// +build appsec
+
+package appsec
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+)
+
+// Span tags of the WAF metrics, set into the service entry span of the
+// requests monitored by the WAF.
+const (
+	// Cumulative WAF run duration of the request, in microseconds.
+	wafDurationTag = "_dd.appsec.waf.duration"
+	// Number of WAF runs of the request which reached the WAF timeout.
+	wafTimeoutsTag = "_dd.appsec.waf.timeouts"
+	// Version of the WAF library.
+	wafVersionTag = "_dd.appsec.waf.version"
+	// Version of the security rules, when available.
+	wafRulesVersionTag = "_dd.appsec.waf.rules.version"
+	// Number of security rules loaded, set once per rules (re)load.
+	wafRulesLoadedTag = "_dd.appsec.waf.rules.loaded"
+	// Number of security rules which could not be loaded, set once per rules
+	// (re)load.
+	wafRulesErrorCountTag = "_dd.appsec.waf.rules.error_count"
+	// JSON object of the rule load errors along with the IDs of the
+	// corresponding rules, set once per rules (re)load when there are errors.
+	wafRulesErrorsTag = "_dd.appsec.waf.rules.errors"
+)
+
+// Dogstatsd metrics of the WAF runs.
+const (
+	// Distribution of the WAF run durations.
+	wafDurationMetric = "datadog.appsec.waf.duration"
+	// Number of WAF runs which reached the WAF timeout.
+	wafTimeoutsMetric = "datadog.appsec.waf.timeouts"
+)
+
+// makeWAFMetricTags returns the tags of the WAF dogstatsd metrics.
+func makeWAFMetricTags(wafVersion, rulesVersion string) []string {
+	tags := []string{"waf_version:" + wafVersion}
+	if rulesVersion != "" {
+		tags = append(tags, "event_rules_version:"+rulesVersion)
+	}
+	return tags
+}
+
+// wafRunMetrics accumulates the WAF run metrics of a request.
+type wafRunMetrics struct {
+	statsd StatsdClient
+	tags   []string
+	// Cumulative WAF run duration in nanoseconds, accessed atomically.
+	duration int64
+	// Number of WAF run timeouts, accessed atomically.
+	timeouts uint32
+}
+
+// newRunMetrics returns the WAF run metrics of a new request monitored with the
+// given WAF state.
+func (m *wafManager) newRunMetrics(s *wafState) *wafRunMetrics {
+	return &wafRunMetrics{statsd: m.statsd, tags: s.metricTags}
+}
+
+// record a WAF run of the given duration, which reached the WAF timeout or
+// not.
+func (m *wafRunMetrics) record(d time.Duration, timeout bool) {
+	atomic.AddInt64(&m.duration, int64(d))
+	if timeout {
+		atomic.AddUint32(&m.timeouts, 1)
+	}
+	if m.statsd == nil {
+		return
+	}
+	m.statsd.Timing(wafDurationMetric, d, m.tags, 1)
+	if timeout {
+		m.statsd.Count(wafTimeoutsMetric, 1, m.tags, 1)
+	}
+}
+
+// tagsHolder is implemented by the handler operations holding the span tags
+// to set into the service entry span.
+type tagsHolder interface {
+	AddTag(key string, value interface{})
+}
+
+// addMetricTags adds the span tags of the given WAF run metrics to the given
+// operation. The rules info is only added to the first operation monitored
+// with this WAF state.
+func (s *wafState) addMetricTags(op tagsHolder, m *wafRunMetrics) {
+	op.AddTag(wafDurationTag, float64(atomic.LoadInt64(&m.duration))/float64(time.Microsecond))
+	op.AddTag(wafTimeoutsTag, float64(atomic.LoadUint32(&m.timeouts)))
+	op.AddTag(wafVersionTag, s.wafVersion)
+	if v := s.rulesInfo.version; v != "" {
+		op.AddTag(wafRulesVersionTag, v)
+	}
+	if !atomic.CompareAndSwapUint32(&s.rulesInfoReported, 0, 1) {
+		return
+	}
+	op.AddTag(wafRulesLoadedTag, float64(s.rulesInfo.loaded))
+	op.AddTag(wafRulesErrorCountTag, float64(s.rulesInfo.errorCount()))
+	if len(s.rulesInfo.errors) > 0 {
+		errors, err := json.Marshal(s.rulesInfo.errors)
+		if err != nil {
+			log.Error("appsec: unexpected error while serializing the rule load errors: %v", err)
+			return
+		}
+		op.AddTag(wafRulesErrorsTag, string(errors))
+	}
+}
@@ -0,0 +1,83 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build appsec
+// +build appsec
+
+package appsec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testStatsdClient struct {
+	timings map[string][]time.Duration
+	counts  map[string]int64
+	tags    []string
+}
+
+func (c *testStatsdClient) Count(name string, value int64, tags []string, _ float64) error {
+	c.counts[name] += value
+	c.tags = tags
+	return nil
+}
+
+func (c *testStatsdClient) Timing(name string, value time.Duration, tags []string, _ float64) error {
+	c.timings[name] = append(c.timings[name], value)
+	c.tags = tags
+	return nil
+}
+
+type testTagsHolder map[string]interface{}
+
+func (h testTagsHolder) AddTag(key string, value interface{}) { h[key] = value }
+
+func TestWAFRunMetrics(t *testing.T) {
+	statsd := &testStatsdClient{timings: map[string][]time.Duration{}, counts: map[string]int64{}}
+	s := &wafState{
+		rulesInfo: rulesInfo{
+			version: "1.3.0",
+			loaded:  2,
+			errors:  map[string][]string{"missing id": {"#1"}},
+		},
+		wafVersion: "1.0.16",
+		metricTags: makeWAFMetricTags("1.0.16", "1.3.0"),
+	}
+	m := (&wafManager{statsd: statsd}).newRunMetrics(s)
+	m.record(3*time.Millisecond, false)
+	m.record(time.Millisecond, true)
+
+	require.Equal(t, []time.Duration{3 * time.Millisecond, time.Millisecond}, statsd.timings[wafDurationMetric])
+	require.Equal(t, int64(1), statsd.counts[wafTimeoutsMetric])
+	require.Equal(t, []string{"waf_version:1.0.16", "event_rules_version:1.3.0"}, statsd.tags)
+
+	tags := testTagsHolder{}
+	s.addMetricTags(tags, m)
+	require.Equal(t, testTagsHolder{
+		wafDurationTag:        4000.,
+		wafTimeoutsTag:        1.,
+		wafVersionTag:         "1.0.16",
+		wafRulesVersionTag:    "1.3.0",
+		wafRulesLoadedTag:     2.,
+		wafRulesErrorCountTag: 1.,
+		wafRulesErrorsTag:     `{"missing id":["#1"]}`,
+	}, tags)
+
+	// The rules info is only reported once
+	tags = testTagsHolder{}
+	s.addMetricTags(tags, m)
+	require.NotContains(t, tags, wafRulesLoadedTag)
+	require.NotContains(t, tags, wafRulesErrorsTag)
+	require.Equal(t, "1.3.0", tags[wafRulesVersionTag])
+
+	t.Run("no-statsd", func(t *testing.T) {
+		m := (&wafManager{}).newRunMetrics(s)
+		m.record(time.Millisecond, true)
+		require.Equal(t, uint32(1), m.timeouts)
+	})
+}
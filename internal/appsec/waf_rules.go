@@ -0,0 +1,277 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build appsec
+// +build appsec
+
+package appsec
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+)
+
+// exclusion silences the security events of known false positives. An event
+// is excluded when it matches all the non-empty criteria of the exclusion.
+type exclusion struct {
+	id string
+	// Set of rule IDs the exclusion applies to. All the rules when empty.
+	rules map[string]struct{}
+	// Regular expression of the HTTP request paths the exclusion applies to.
+	// All the paths when nil.
+	path *regexp.Regexp
+	// Set of parameter names the exclusion applies to, compared to the first
+	// key of the key path of the rule matches. All the parameters when empty.
+	parameters map[string]struct{}
+}
+
+// preparedRules are the security rules ready to be loaded into the WAF, along
+// with what was extracted from them.
+type preparedRules struct {
+	// WAF rules without the exclusions, the disabled rules and the invalid
+	// rules.
+	rules      []byte
+	exclusions []exclusion
+	info       rulesInfo
+}
+
+// rulesInfo describes the result of the loading of the security rules.
+type rulesInfo struct {
+	// Version of the rules, when available.
+	version string
+	// Number of rules loaded, without the disabled and invalid ones.
+	loaded int
+	// Errors of the invalid rules which were not loaded, by error message
+	// along with the IDs of the corresponding rules.
+	errors map[string][]string
+}
+
+// errorCount returns the number of invalid rules.
+func (i rulesInfo) errorCount() (n int) {
+	for _, ids := range i.errors {
+		n += len(ids)
+	}
+	return n
+}
+
+// prepareRules returns the given security rules without the disabled rules,
+// without the invalid rules and without the exclusions, which are returned
+// separately as they are not supported by the WAF. The exclusions are defined
+// in the rules under the top-level `exclusions` key, such as:
+//
+//	"exclusions": [{"id": "search", "rules": ["crs-942-100"], "path": "^/search$", "parameters": ["q"]}]
+func prepareRules(rules []byte, disabledRules map[string]struct{}) (*preparedRules, error) {
+	var parsed map[string]json.RawMessage
+	if err := json.Unmarshal(rules, &parsed); err != nil {
+		return nil, fmt.Errorf("could not parse the rules: %v", err)
+	}
+
+	var exclusions []exclusion
+	if raw, ok := parsed["exclusions"]; ok {
+		var err error
+		if exclusions, err = parseExclusions(raw); err != nil {
+			return nil, err
+		}
+		delete(parsed, "exclusions")
+	}
+
+	info := rulesInfo{version: rulesVersion(rules, parsed["metadata"])}
+	var ruleList []json.RawMessage
+	if err := json.Unmarshal(parsed["rules"], &ruleList); err != nil {
+		return nil, fmt.Errorf("could not parse the rules: %v", err)
+	}
+	addError := func(msg, id string) {
+		if info.errors == nil {
+			info.errors = make(map[string][]string)
+		}
+		info.errors[msg] = append(info.errors[msg], id)
+	}
+	enabled := ruleList[:0]
+	ids := make(map[string]struct{}, len(ruleList))
+	for i, rule := range ruleList {
+		var r struct {
+			ID         string            `json:"id"`
+			Conditions []json.RawMessage `json:"conditions"`
+		}
+		if err := json.Unmarshal(rule, &r); err != nil {
+			addError("invalid rule", fmt.Sprintf("#%d", i))
+			continue
+		}
+		if r.ID == "" {
+			addError("missing id", fmt.Sprintf("#%d", i))
+			continue
+		}
+		if _, disabled := disabledRules[r.ID]; disabled {
+			log.Debug("appsec: disabling rule %s", r.ID)
+			continue
+		}
+		if _, dup := ids[r.ID]; dup {
+			addError("duplicate id", r.ID)
+			continue
+		}
+		if len(r.Conditions) == 0 {
+			addError("missing conditions", r.ID)
+			continue
+		}
+		ids[r.ID] = struct{}{}
+		enabled = append(enabled, rule)
+	}
+	if len(info.errors) > 0 {
+		log.Error("appsec: %d security rule(s) could not be loaded: %v", info.errorCount(), info.errors)
+	}
+	info.loaded = len(enabled)
+	raw, err := json.Marshal(enabled)
+	if err != nil {
+		return nil, err
+	}
+	parsed["rules"] = raw
+
+	rules, err = json.Marshal(parsed)
+	if err != nil {
+		return nil, err
+	}
+	return &preparedRules{rules: rules, exclusions: exclusions, info: info}, nil
+}
+
+// Version of the static recommended rules of rule.go, which have no metadata.
+const staticRecommendedRuleVersion = "1.2.4"
+
+// rulesVersion returns the version of the given rules, found in their metadata
+// when available.
+func rulesVersion(rules []byte, metadata json.RawMessage) string {
+	var md struct {
+		RulesVersion string `json:"rules_version"`
+	}
+	if len(metadata) > 0 && json.Unmarshal(metadata, &md) == nil && md.RulesVersion != "" {
+		return md.RulesVersion
+	}
+	if string(rules) == staticRecommendedRule {
+		return staticRecommendedRuleVersion
+	}
+	return ""
+}
+
+func parseExclusions(raw json.RawMessage) ([]exclusion, error) {
+	var parsed []struct {
+		ID         string   `json:"id"`
+		Rules      []string `json:"rules"`
+		Path       string   `json:"path"`
+		Parameters []string `json:"parameters"`
+	}
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return nil, fmt.Errorf("could not parse the exclusions: %v", err)
+	}
+	exclusions := make([]exclusion, 0, len(parsed))
+	for _, e := range parsed {
+		excl := exclusion{
+			id:         e.ID,
+			rules:      makeStringSet(e.Rules),
+			parameters: makeStringSet(e.Parameters),
+		}
+		if e.Path != "" {
+			re, err := regexp.Compile(e.Path)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse the path of the exclusion %s: %v", e.ID, err)
+			}
+			excl.path = re
+		}
+		exclusions = append(exclusions, excl)
+	}
+	return exclusions, nil
+}
+
+// wafEvent is the subset of a WAF match event used by the exclusions.
+type wafEvent struct {
+	Rule struct {
+		ID string `json:"id"`
+	} `json:"rule"`
+	RuleMatches []struct {
+		Parameters []struct {
+			KeyPath []interface{} `json:"key_path"`
+		} `json:"parameters"`
+	} `json:"rule_matches"`
+}
+
+// excludes returns true when the exclusion applies to the given WAF event
+// observed on the given request path.
+func (e *exclusion) excludes(event *wafEvent, path string) bool {
+	if e.rules != nil {
+		if _, ok := e.rules[event.Rule.ID]; !ok {
+			return false
+		}
+	}
+	if e.path != nil && !e.path.MatchString(path) {
+		return false
+	}
+	if e.parameters == nil {
+		return true
+	}
+	for _, m := range event.RuleMatches {
+		for _, p := range m.Parameters {
+			if len(p.KeyPath) == 0 {
+				continue
+			}
+			if name, ok := p.KeyPath[0].(string); ok {
+				if _, ok := e.parameters[name]; ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// filterMatches returns the given WAF matches without the events excluded for
+// the given request path, or nil when they are all excluded.
+func filterMatches(matches []byte, exclusions []exclusion, path string) []byte {
+	if len(matches) == 0 || len(exclusions) == 0 {
+		return matches
+	}
+	var events []json.RawMessage
+	if err := json.Unmarshal(matches, &events); err != nil {
+		log.Error("appsec: unexpected error while parsing the waf matches: %v", err)
+		return matches
+	}
+	kept := make([]json.RawMessage, 0, len(events))
+	for _, raw := range events {
+		var event wafEvent
+		if err := json.Unmarshal(raw, &event); err != nil || !isExcluded(&event, exclusions, path) {
+			kept = append(kept, raw)
+		}
+	}
+	switch len(kept) {
+	case 0:
+		return nil
+	case len(events):
+		return matches
+	}
+	filtered, err := json.Marshal(kept)
+	if err != nil {
+		return matches
+	}
+	return filtered
+}
+
+func isExcluded(event *wafEvent, exclusions []exclusion, path string) bool {
+	for i := range exclusions {
+		if exclusions[i].excludes(event, path) {
+			log.Debug("appsec: security event of rule %s excluded by %s", event.Rule.ID, exclusions[i].id)
+			return true
+		}
+	}
+	return false
+}
+
+// requestPath returns the path of the given request URI.
+func requestPath(uri string) string {
+	if u, err := url.ParseRequestURI(uri); err == nil {
+		return u.Path
+	}
+	return uri
+}
@@ -0,0 +1,130 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build appsec
+// +build appsec
+
+package appsec
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareRules(t *testing.T) {
+	rules := []byte(`{
+		"version": "2.1",
+		"rules": [{"id": "rule-1", "conditions": [{}]}, {"id": "rule-2", "conditions": [{}]}],
+		"exclusions": [{"id": "excl", "rules": ["rule-1"], "path": "^/search$", "parameters": ["q"]}]
+	}`)
+
+	t.Run("exclusions", func(t *testing.T) {
+		prepared, err := prepareRules(rules, nil)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"version": "2.1", "rules": [{"id": "rule-1", "conditions": [{}]}, {"id": "rule-2", "conditions": [{}]}]}`, string(prepared.rules))
+		exclusions := prepared.exclusions
+		require.Len(t, exclusions, 1)
+		require.Equal(t, "excl", exclusions[0].id)
+		require.Equal(t, map[string]struct{}{"rule-1": {}}, exclusions[0].rules)
+		require.Equal(t, map[string]struct{}{"q": {}}, exclusions[0].parameters)
+		require.True(t, exclusions[0].path.MatchString("/search"))
+	})
+
+	t.Run("disabled-rules", func(t *testing.T) {
+		prepared, err := prepareRules(rules, makeStringSet([]string{"rule-1", "unknown"}))
+		require.NoError(t, err)
+		require.JSONEq(t, `{"version": "2.1", "rules": [{"id": "rule-2", "conditions": [{}]}]}`, string(prepared.rules))
+		require.Equal(t, 1, prepared.info.loaded)
+		require.Equal(t, 0, prepared.info.errorCount())
+	})
+
+	t.Run("invalid-rules", func(t *testing.T) {
+		prepared, err := prepareRules([]byte(`{
+			"version": "2.1",
+			"metadata": {"rules_version": "1.3.0"},
+			"rules": [{"id": "rule-1", "conditions": [{}]}, {"conditions": [{}]}, {"id": "rule-1", "conditions": [{}]}, {"id": "rule-3"}, 42]
+		}`), nil)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"version": "2.1", "metadata": {"rules_version": "1.3.0"}, "rules": [{"id": "rule-1", "conditions": [{}]}]}`, string(prepared.rules))
+		require.Equal(t, rulesInfo{
+			version: "1.3.0",
+			loaded:  1,
+			errors: map[string][]string{
+				"missing id":         {"#1"},
+				"duplicate id":       {"rule-1"},
+				"missing conditions": {"rule-3"},
+				"invalid rule":       {"#4"},
+			},
+		}, prepared.info)
+		require.Equal(t, 4, prepared.info.errorCount())
+	})
+
+	t.Run("static-rules-version", func(t *testing.T) {
+		prepared, err := prepareRules([]byte(staticRecommendedRule), nil)
+		require.NoError(t, err)
+		require.Equal(t, staticRecommendedRuleVersion, prepared.info.version)
+		require.Equal(t, 0, prepared.info.errorCount())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, rules := range []string{
+			`not json`,
+			`{"rules": [], "exclusions": {}}`,
+			`{"rules": [], "exclusions": [{"id": "excl", "path": "("}]}`,
+		} {
+			_, err := prepareRules([]byte(rules), nil)
+			require.Error(t, err, rules)
+		}
+	})
+}
+
+func TestFilterMatches(t *testing.T) {
+	const (
+		match1 = `{"rule":{"id":"rule-1"},"rule_matches":[{"parameters":[{"address":"server.request.query","key_path":["q"]}]}]}`
+		match2 = `{"rule":{"id":"rule-2"},"rule_matches":[{"parameters":[{"address":"server.request.query","key_path":["id",0]}]}]}`
+	)
+	matches := []byte("[" + match1 + "," + match2 + "]")
+
+	prepared, err := prepareRules([]byte(`{"rules": [], "exclusions": [
+		{"id": "by-rule-and-param", "rules": ["rule-1"], "parameters": ["q"]},
+		{"id": "by-path", "path": "^/internal/"}
+	]}`), nil)
+	require.NoError(t, err)
+	exclusions := prepared.exclusions
+
+	for _, tc := range []struct {
+		name     string
+		path     string
+		expected []string
+	}{
+		{name: "partially-excluded", path: "/search", expected: []string{match2}},
+		{name: "excluded", path: "/internal/search", expected: nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			filtered := filterMatches(matches, exclusions, tc.path)
+			if tc.expected == nil {
+				require.Nil(t, filtered)
+				return
+			}
+			var events []json.RawMessage
+			require.NoError(t, json.Unmarshal(filtered, &events))
+			require.Len(t, events, len(tc.expected))
+			for i, e := range tc.expected {
+				require.JSONEq(t, e, string(events[i]))
+			}
+		})
+	}
+
+	t.Run("no-exclusions", func(t *testing.T) {
+		require.Equal(t, matches, filterMatches(matches, nil, "/internal/search"))
+	})
+}
+
+func TestRequestPath(t *testing.T) {
+	require.Equal(t, "/search", requestPath("/search?q=1"))
+	require.Equal(t, "/a/b", requestPath("http://localhost/a/b?c"))
+}
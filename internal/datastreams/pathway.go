@@ -0,0 +1,72 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+// Package datastreams implements Data Streams Monitoring: it tracks how
+// payloads flow across services through queues by computing a pathway hash at
+// every produce and consume checkpoint, and aggregates the latencies measured
+// along each pathway before sending them to the agent.
+package datastreams
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+// Pathway is used to monitor how payloads are sent across different services.
+// A Pathway is immutable: setting a checkpoint results in a new Pathway.
+type Pathway struct {
+	// hash identifies the sequence of checkpoints leading to this pathway.
+	hash uint64
+	// pathwayStart holds the time at which the first checkpoint of the
+	// pathway was set.
+	pathwayStart time.Time
+	// edgeStart holds the time at which the latest checkpoint was set.
+	edgeStart time.Time
+}
+
+// Hash returns the hash identifying the pathway.
+func (p Pathway) Hash() uint64 {
+	return p.hash
+}
+
+// PathwayStart returns the time at which the first checkpoint of the pathway
+// was set.
+func (p Pathway) PathwayStart() time.Time {
+	return p.pathwayStart
+}
+
+// EdgeStart returns the time at which the latest checkpoint of the pathway was
+// set.
+func (p Pathway) EdgeStart() time.Time {
+	return p.edgeStart
+}
+
+// nodeHash returns the hash of a checkpoint set by the given service in the
+// given environment. The order of edgeTags doesn't matter.
+func nodeHash(service, env string, edgeTags []string) uint64 {
+	tags := make([]string, len(edgeTags))
+	copy(tags, edgeTags)
+	sort.Strings(tags)
+	h := fnv.New64()
+	h.Write([]byte(service))
+	h.Write([]byte(env))
+	for _, t := range tags {
+		h.Write([]byte(t))
+	}
+	return h.Sum64()
+}
+
+// pathwayHash combines the hash of a checkpoint with the hash of the pathway
+// leading to it.
+func pathwayHash(nodeHash, parentHash uint64) uint64 {
+	b := make([]byte, 16)
+	binary.LittleEndian.PutUint64(b, nodeHash)
+	binary.LittleEndian.PutUint64(b[8:], parentHash)
+	h := fnv.New64()
+	h.Write(b)
+	return h.Sum64()
+}
@@ -0,0 +1,55 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package datastreams
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathway(t *testing.T) {
+	t.Run("hash", func(t *testing.T) {
+		// the order of edge tags doesn't matter
+		assert.Equal(t,
+			nodeHash("service", "env", []string{"type:kafka", "topic:topic1", "direction:in"}),
+			nodeHash("service", "env", []string{"direction:in", "type:kafka", "topic:topic1"}),
+		)
+		assert.NotEqual(t,
+			nodeHash("service", "env", []string{"direction:in", "topic:topic1"}),
+			nodeHash("service", "env", []string{"direction:in", "topic:topic2"}),
+		)
+		n := nodeHash("service", "env", []string{"direction:in"})
+		assert.NotEqual(t, pathwayHash(n, 1), pathwayHash(n, 2))
+	})
+
+	t.Run("checkpoints", func(t *testing.T) {
+		p := newProcessor(nil, "env", "service", nil)
+		ctx := p.SetCheckpoint(context.Background(), "direction:out", "topic:topic1")
+		first, ok := PathwayFromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, pathwayHash(nodeHash("service", "env", []string{"direction:out", "topic:topic1"}), 0), first.Hash())
+		assert.Equal(t, first.PathwayStart(), first.EdgeStart())
+
+		time.Sleep(time.Millisecond)
+		ctx = p.SetCheckpoint(ctx, "direction:in", "topic:topic1")
+		second, ok := PathwayFromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, pathwayHash(nodeHash("service", "env", []string{"direction:in", "topic:topic1"}), first.Hash()), second.Hash())
+		assert.Equal(t, first.PathwayStart(), second.PathwayStart())
+		assert.True(t, second.EdgeStart().After(first.EdgeStart()))
+
+		assert.Len(t, p.in, 2)
+		<-p.in
+		s := <-p.in
+		assert.Equal(t, second.Hash(), s.hash)
+		assert.Equal(t, first.Hash(), s.parentHash)
+		assert.Equal(t, s.pathwayLatency, s.edgeLatency)
+		assert.True(t, s.edgeLatency >= time.Millisecond.Nanoseconds())
+	})
+}
@@ -0,0 +1,59 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:generate msgp -unexported -marshal=false -o=payload_msgp.go -tests=false
+
+package datastreams
+
+// statsPayload stores client computed stats on pathways and is encoded to be
+// sent to the agent.
+type statsPayload struct {
+	// Env specifies the env. of the application, as defined by the user.
+	Env string
+
+	// Service is the service of the application
+	Service string
+
+	// Stats holds all stats buckets computed within this payload.
+	Stats []statsBucket
+
+	// TracerVersion is the version of the tracer.
+	TracerVersion string
+
+	// Lang is the tracer language.
+	Lang string
+}
+
+// statsBucket specifies a set of stats computed over a duration.
+type statsBucket struct {
+	// Start specifies the beginning of this bucket in unix nanoseconds.
+	Start uint64
+
+	// Duration specifies the duration of this bucket in nanoseconds.
+	Duration uint64
+
+	// Stats contains a set of statistics computed for the duration of this bucket.
+	Stats []statsGroup
+}
+
+// statsGroup contains the latency statistics aggregated for a pathway.
+type statsGroup struct {
+	// EdgeTags holds the tags of the checkpoint which terminated the pathway.
+	EdgeTags []string
+
+	// Hash identifies the pathway.
+	Hash uint64
+
+	// ParentHash identifies the pathway leading to the latest checkpoint.
+	ParentHash uint64
+
+	// PathwayLatency holds the serialized sketch of the latencies, in seconds,
+	// measured since the start of the pathway.
+	PathwayLatency []byte
+
+	// EdgeLatency holds the serialized sketch of the latencies, in seconds,
+	// measured since the previous checkpoint.
+	EdgeLatency []byte
+}
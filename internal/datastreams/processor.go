@@ -0,0 +1,358 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package datastreams
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/version"
+
+	"github.com/DataDog/sketches-go/ddsketch"
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultBucketSize specifies the span of time covered by one stats bucket.
+var defaultBucketSize = (10 * time.Second).Nanoseconds()
+
+// statsdClient is the subset of the tracer's statsd client used by the
+// processor.
+type statsdClient interface {
+	Incr(name string, tags []string, rate float64) error
+	Count(name string, value int64, tags []string, rate float64) error
+}
+
+// statsPoint holds the information measured when a checkpoint is set.
+type statsPoint struct {
+	edgeTags       []string
+	hash           uint64
+	parentHash     uint64
+	timestamp      int64
+	pathwayLatency int64
+	edgeLatency    int64
+}
+
+// Processor aggregates the latencies measured at every checkpoint in time
+// buckets, and periodically flushes them to the agent.
+type Processor struct {
+	// in receives the points produced by SetCheckpoint. In order for in to have
+	// a consumer, the processor must be started using a call to Start.
+	in chan statsPoint
+
+	// mu guards below fields
+	mu sync.Mutex
+
+	// buckets maintains a set of buckets, where the map key represents
+	// the starting point in time of that bucket, in nanoseconds.
+	buckets map[int64]*bucket
+
+	// stopped reports whether the processor is stopped (when non-zero)
+	stopped uint64
+
+	// dropped counts the points dropped because the in channel was full.
+	dropped int64
+
+	wg         sync.WaitGroup // waits for any active goroutines
+	bucketSize int64          // the size of a bucket in nanoseconds
+	stop       chan struct{}  // closing this channel triggers shutdown
+	statsd     statsdClient   // the tracer's statsd client
+	transport  transport      // sends payloads to the agent
+	env        string         // the environment of the application
+	service    string         // the service of the application
+}
+
+// NewProcessor creates a new processor computing pathways for the given
+// service and env, and sending stats to the agent found at agentAddr using
+// client.
+func NewProcessor(statsd statsdClient, env, service, agentAddr string, client *http.Client) *Processor {
+	return newProcessor(statsd, env, service, newHTTPTransport(agentAddr, client))
+}
+
+func newProcessor(statsd statsdClient, env, service string, t transport) *Processor {
+	return &Processor{
+		in:         make(chan statsPoint, 10000),
+		buckets:    make(map[int64]*bucket),
+		stopped:    1,
+		bucketSize: defaultBucketSize,
+		statsd:     statsd,
+		transport:  t,
+		env:        env,
+		service:    service,
+	}
+}
+
+// alignTs returns the provided timestamp truncated to the bucket size.
+// It gives us the start time of the time bucket in which such timestamp falls.
+func alignTs(ts, bucketSize int64) int64 { return ts - ts%bucketSize }
+
+// Start starts the processor. A started processor needs to be stopped
+// in order to gracefully shut down, using Stop.
+func (p *Processor) Start() {
+	if atomic.SwapUint64(&p.stopped, 0) == 0 {
+		// already running
+		log.Warn("(*Processor).Start called more than once. This is likely a programming error.")
+		return
+	}
+	p.stop = make(chan struct{})
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		tick := time.NewTicker(time.Duration(p.bucketSize) * time.Nanosecond)
+		defer tick.Stop()
+		p.runFlusher(tick.C)
+	}()
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.runIngester()
+	}()
+}
+
+// Stop stops the processor, flushes all remaining stats and blocks until the
+// operation completes.
+func (p *Processor) Stop() {
+	if atomic.SwapUint64(&p.stopped, 1) > 0 {
+		return
+	}
+	close(p.stop)
+	p.wg.Wait()
+	// process what's left in the queue and send all buckets, including the
+	// current one, as the data would otherwise be lost.
+loop:
+	for {
+		select {
+		case s := <-p.in:
+			p.add(s)
+		default:
+			break loop
+		}
+	}
+	p.sendToAgent(p.flush(time.Now().Add(time.Duration(p.bucketSize))))
+}
+
+// runFlusher runs the flushing loop which sends stats to the agent.
+func (p *Processor) runFlusher(tick <-chan time.Time) {
+	for {
+		select {
+		case now := <-tick:
+			p.sendToAgent(p.flush(now))
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// runIngester runs the loop which accepts incoming points on the in channel.
+func (p *Processor) runIngester() {
+	for {
+		select {
+		case s := <-p.in:
+			p.statsd.Incr("datadog.datastreams.processor.payloads_in", nil, 1)
+			p.add(s)
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+func (p *Processor) sendToAgent(payload statsPayload) {
+	if dropped := atomic.SwapInt64(&p.dropped, 0); dropped > 0 {
+		p.statsd.Count("datadog.datastreams.processor.dropped_payloads", dropped, nil, 1)
+	}
+	if len(payload.Stats) == 0 {
+		// nothing to flush
+		return
+	}
+	p.statsd.Incr("datadog.datastreams.processor.flush_payloads", nil, 1)
+	p.statsd.Count("datadog.datastreams.processor.flush_buckets", int64(len(payload.Stats)), nil, 1)
+	if err := p.transport.sendPipelineStats(&payload); err != nil {
+		p.statsd.Incr("datadog.datastreams.processor.flush_errors", nil, 1)
+		log.Error("Error sending data streams stats payload: %v", err)
+	}
+}
+
+// add adds s into the processor's internal stats buckets.
+func (p *Processor) add(s statsPoint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	btime := alignTs(s.timestamp, p.bucketSize)
+	b, ok := p.buckets[btime]
+	if !ok {
+		b = newBucket(uint64(btime), uint64(p.bucketSize))
+		p.buckets[btime] = b
+	}
+	b.add(s)
+}
+
+// flush removes all buckets which ended before now and returns them as a
+// payload.
+func (p *Processor) flush(timenow time.Time) statsPayload {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := timenow.UnixNano()
+	sp := statsPayload{
+		Env:           p.env,
+		Service:       p.service,
+		TracerVersion: version.Tag,
+		Lang:          "go",
+		Stats:         make([]statsBucket, 0, len(p.buckets)),
+	}
+	for ts, b := range p.buckets {
+		if ts > now-p.bucketSize {
+			// do not flush the current bucket
+			continue
+		}
+		log.Debug("Flushing data streams bucket %d", ts)
+		sp.Stats = append(sp.Stats, b.export())
+		delete(p.buckets, ts)
+	}
+	return sp
+}
+
+// SetCheckpoint sets a checkpoint on the pathway found in ctx, or starts a
+// new pathway if ctx holds none. The returned context holds the resulting
+// pathway, which should be propagated to the next checkpoint.
+func (p *Processor) SetCheckpoint(ctx context.Context, edgeTags ...string) context.Context {
+	now := time.Now()
+	pathwayStart, edgeStart := now, now
+	var parentHash uint64
+	if parent, ok := PathwayFromContext(ctx); ok {
+		parentHash = parent.hash
+		pathwayStart = parent.pathwayStart
+		edgeStart = parent.edgeStart
+	}
+	child := Pathway{
+		hash:         pathwayHash(nodeHash(p.service, p.env, edgeTags), parentHash),
+		pathwayStart: pathwayStart,
+		edgeStart:    now,
+	}
+	select {
+	case p.in <- statsPoint{
+		edgeTags:       edgeTags,
+		hash:           child.hash,
+		parentHash:     parentHash,
+		timestamp:      now.UnixNano(),
+		pathwayLatency: now.Sub(pathwayStart).Nanoseconds(),
+		edgeLatency:    now.Sub(edgeStart).Nanoseconds(),
+	}:
+	default:
+		atomic.AddInt64(&p.dropped, 1)
+	}
+	return ContextWithPathway(ctx, child)
+}
+
+// bucket aggregates the points received during a period of time, grouped by
+// pathway hash.
+type bucket struct {
+	start, duration uint64
+	groups          map[uint64]*group
+}
+
+func newBucket(start, duration uint64) *bucket {
+	return &bucket{
+		start:    start,
+		duration: duration,
+		groups:   make(map[uint64]*group),
+	}
+}
+
+func (b *bucket) add(s statsPoint) {
+	g, ok := b.groups[s.hash]
+	if !ok {
+		g = newGroup(s)
+		b.groups[s.hash] = g
+	}
+	if err := g.pathwayLatency.Add(toSeconds(s.pathwayLatency)); err != nil {
+		log.Debug("Could not add pathway latency to sketch: %v", err)
+	}
+	if err := g.edgeLatency.Add(toSeconds(s.edgeLatency)); err != nil {
+		log.Debug("Could not add edge latency to sketch: %v", err)
+	}
+}
+
+// toSeconds converts a latency in nanoseconds to seconds. Negative latencies,
+// caused by clock skew between hosts, are reported as zero.
+func toSeconds(ns int64) float64 {
+	if ns < 0 {
+		return 0
+	}
+	return float64(ns) / float64(time.Second)
+}
+
+// export transforms a bucket into a statsBucket, ready to be sent to the agent.
+func (b *bucket) export() statsBucket {
+	sb := statsBucket{
+		Start:    b.start,
+		Duration: b.duration,
+		Stats:    make([]statsGroup, 0, len(b.groups)),
+	}
+	for _, g := range b.groups {
+		sg, err := g.export()
+		if err != nil {
+			log.Error("Could not export data streams stats group: %v.", err)
+			continue
+		}
+		sb.Stats = append(sb.Stats, sg)
+	}
+	return sb
+}
+
+// group holds the latency distributions measured for a single pathway.
+type group struct {
+	edgeTags       []string
+	hash           uint64
+	parentHash     uint64
+	pathwayLatency *ddsketch.DDSketch
+	edgeLatency    *ddsketch.DDSketch
+}
+
+func newGroup(s statsPoint) *group {
+	const (
+		// relativeAccuracy is the value accuracy we have on the percentiles.
+		relativeAccuracy = 0.01
+		// maxNumBins is the maximum number of bins of the ddSketch we use to store percentiles.
+		maxNumBins = 2048
+	)
+	pathwaySketch, err := ddsketch.LogCollapsingLowestDenseDDSketch(relativeAccuracy, maxNumBins)
+	if err != nil {
+		log.Error("Error when creating ddsketch: %v", err)
+	}
+	edgeSketch, err := ddsketch.LogCollapsingLowestDenseDDSketch(relativeAccuracy, maxNumBins)
+	if err != nil {
+		log.Error("Error when creating ddsketch: %v", err)
+	}
+	return &group{
+		edgeTags:       s.edgeTags,
+		hash:           s.hash,
+		parentHash:     s.parentHash,
+		pathwayLatency: pathwaySketch,
+		edgeLatency:    edgeSketch,
+	}
+}
+
+func (g *group) export() (statsGroup, error) {
+	pathwayLatency, err := proto.Marshal(g.pathwayLatency.ToProto())
+	if err != nil {
+		return statsGroup{}, err
+	}
+	edgeLatency, err := proto.Marshal(g.edgeLatency.ToProto())
+	if err != nil {
+		return statsGroup{}, err
+	}
+	return statsGroup{
+		EdgeTags:       g.edgeTags,
+		Hash:           g.hash,
+		ParentHash:     g.parentHash,
+		PathwayLatency: pathwayLatency,
+		EdgeLatency:    edgeLatency,
+	}, nil
+}
@@ -0,0 +1,140 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package datastreams
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/DataDog/sketches-go/ddsketch"
+	"github.com/DataDog/sketches-go/ddsketch/pb/sketchpb"
+	"github.com/stretchr/testify/assert"
+	"github.com/tinylib/msgp/msgp"
+	"google.golang.org/protobuf/proto"
+)
+
+type mockTransport struct {
+	mu       sync.Mutex
+	payloads []*statsPayload
+}
+
+func (t *mockTransport) sendPipelineStats(p *statsPayload) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.payloads = append(t.payloads, p)
+	return nil
+}
+
+func sketchCount(t *testing.T, data []byte) float64 {
+	var pb sketchpb.DDSketch
+	assert.NoError(t, proto.Unmarshal(data, &pb))
+	sketch, err := (&ddsketch.DDSketch{}).FromProto(&pb)
+	assert.NoError(t, err)
+	return sketch.GetCount()
+}
+
+func TestProcessor(t *testing.T) {
+	bucketSize := (10 * time.Second).Nanoseconds()
+	tp := time.Unix(0, alignTs(time.Now().UnixNano(), bucketSize))
+	point := func(hash, parentHash uint64, ts time.Time, latency time.Duration) statsPoint {
+		return statsPoint{
+			edgeTags:       []string{"type:kafka"},
+			hash:           hash,
+			parentHash:     parentHash,
+			timestamp:      ts.UnixNano(),
+			pathwayLatency: latency.Nanoseconds(),
+			edgeLatency:    latency.Nanoseconds(),
+		}
+	}
+	p := newProcessor(&statsd.NoOpClient{}, "env", "service", nil)
+	p.add(point(1, 0, tp.Add(time.Second), time.Second))
+	p.add(point(1, 0, tp.Add(2*time.Second), 2*time.Second))
+	p.add(point(2, 1, tp.Add(3*time.Second), time.Second))
+	p.add(point(1, 0, tp.Add(11*time.Second), time.Second))
+
+	// the current bucket isn't flushed
+	payload := p.flush(tp.Add(5 * time.Second))
+	assert.Len(t, payload.Stats, 0)
+
+	payload = p.flush(tp.Add(10 * time.Second))
+	assert.Equal(t, "env", payload.Env)
+	assert.Equal(t, "service", payload.Service)
+	assert.Equal(t, "go", payload.Lang)
+	assert.Len(t, payload.Stats, 1)
+	b := payload.Stats[0]
+	assert.Equal(t, uint64(tp.UnixNano()), b.Start)
+	assert.Equal(t, uint64(bucketSize), b.Duration)
+	assert.Len(t, b.Stats, 2)
+	for _, g := range b.Stats {
+		switch g.Hash {
+		case 1:
+			assert.Equal(t, uint64(0), g.ParentHash)
+			assert.Equal(t, 2.0, sketchCount(t, g.PathwayLatency))
+			assert.Equal(t, 2.0, sketchCount(t, g.EdgeLatency))
+		case 2:
+			assert.Equal(t, uint64(1), g.ParentHash)
+			assert.Equal(t, 1.0, sketchCount(t, g.PathwayLatency))
+		default:
+			t.Fatalf("unexpected hash %d", g.Hash)
+		}
+	}
+
+	payload = p.flush(tp.Add(20 * time.Second))
+	assert.Len(t, payload.Stats, 1)
+	assert.Len(t, p.buckets, 0)
+}
+
+func TestProcessorStop(t *testing.T) {
+	transport := &mockTransport{}
+	p := newProcessor(&statsd.NoOpClient{}, "env", "service", transport)
+	p.Start()
+	p.SetCheckpoint(context.Background(), "direction:out", "topic:topic1")
+	p.Stop()
+	// the current bucket is flushed on stop
+	assert.Len(t, transport.payloads, 1)
+	assert.Len(t, transport.payloads[0].Stats, 1)
+	assert.Len(t, transport.payloads[0].Stats[0].Stats, 1)
+}
+
+func TestHTTPTransport(t *testing.T) {
+	var (
+		payload statsPayload
+		headers http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v0.1/pipeline_stats", r.URL.Path)
+		headers = r.Header
+		gr, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, msgp.Decode(gr, &payload))
+	}))
+	defer srv.Close()
+
+	tr := newHTTPTransport(strings.TrimPrefix(srv.URL, "http://"), http.DefaultClient)
+	err := tr.sendPipelineStats(&statsPayload{
+		Env:     "env",
+		Service: "service",
+		Stats: []statsBucket{{
+			Start: 1,
+			Stats: []statsGroup{{Hash: 2, EdgeTags: []string{"type:kafka"}, PathwayLatency: []byte{1}}},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "gzip", headers.Get("Content-Encoding"))
+	assert.Equal(t, "application/msgpack", headers.Get("Content-Type"))
+	assert.Equal(t, "service", payload.Service)
+	assert.Equal(t, uint64(2), payload.Stats[0].Stats[0].Hash)
+	assert.Equal(t, []string{"type:kafka"}, payload.Stats[0].Stats[0].EdgeTags)
+	assert.True(t, bytes.Equal([]byte{1}, payload.Stats[0].Stats[0].PathwayLatency))
+}
@@ -0,0 +1,137 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package datastreams
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// PropagationKeyBase64 is the key under which a base64 encoded pathway is
+// propagated in message headers or attributes.
+const PropagationKeyBase64 = "dd-pathway-ctx-base64"
+
+// TextMapWriter allows setting key/value pairs on a message carrier.
+type TextMapWriter interface {
+	// Set sets the given key/value pair.
+	Set(key, val string)
+}
+
+// TextMapReader allows iterating over the key/value pairs of a message carrier.
+type TextMapReader interface {
+	// ForeachKey iterates over all keys that exist in the underlying
+	// carrier. It takes a callback function which will be called
+	// using all key/value pairs as arguments. ForeachKey will return
+	// the first error returned by the handler.
+	ForeachKey(handler func(key, val string) error) error
+}
+
+type contextKey struct{}
+
+var activePathwayKey = contextKey{}
+
+// ContextWithPathway returns a copy of ctx holding p.
+func ContextWithPathway(ctx context.Context, p Pathway) context.Context {
+	return context.WithValue(ctx, activePathwayKey, p)
+}
+
+// PathwayFromContext returns the pathway stored in ctx, if any.
+func PathwayFromContext(ctx context.Context) (p Pathway, ok bool) {
+	if ctx == nil {
+		return p, false
+	}
+	p, ok = ctx.Value(activePathwayKey).(Pathway)
+	return p, ok
+}
+
+// Encode encodes the pathway as a fixed size hash followed by the pathway and
+// edge start times, in milliseconds, encoded as varints.
+func (p Pathway) Encode() []byte {
+	data := make([]byte, 8, 8+2*binary.MaxVarintLen64)
+	binary.LittleEndian.PutUint64(data, p.hash)
+	data = appendVarint(data, p.pathwayStart.UnixNano()/int64(time.Millisecond))
+	data = appendVarint(data, p.edgeStart.UnixNano()/int64(time.Millisecond))
+	return data
+}
+
+// EncodeBase64 encodes the pathway as a base64 string, suitable for
+// propagation through text based carriers.
+func (p Pathway) EncodeBase64() string {
+	return base64.StdEncoding.EncodeToString(p.Encode())
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+var errInvalidPathway = errors.New("datastreams: invalid encoded pathway")
+
+// Decode decodes a pathway previously encoded using Encode.
+func Decode(data []byte) (p Pathway, err error) {
+	if len(data) < 8 {
+		return p, errInvalidPathway
+	}
+	p.hash = binary.LittleEndian.Uint64(data)
+	data = data[8:]
+	pathwayStart, n := binary.Varint(data)
+	if n <= 0 {
+		return p, errInvalidPathway
+	}
+	data = data[n:]
+	edgeStart, n := binary.Varint(data)
+	if n <= 0 {
+		return p, errInvalidPathway
+	}
+	p.pathwayStart = time.Unix(0, pathwayStart*int64(time.Millisecond))
+	p.edgeStart = time.Unix(0, edgeStart*int64(time.Millisecond))
+	return p, nil
+}
+
+// DecodeBase64 decodes a pathway previously encoded using EncodeBase64.
+func DecodeBase64(str string) (p Pathway, err error) {
+	data, err := base64.StdEncoding.DecodeString(str)
+	if err != nil {
+		return p, err
+	}
+	return Decode(data)
+}
+
+// ExtractFromCarrier returns a copy of ctx holding the pathway propagated in
+// carrier. If carrier holds no valid pathway, ctx is returned as is.
+func ExtractFromCarrier(ctx context.Context, carrier TextMapReader) context.Context {
+	var (
+		p     Pathway
+		found bool
+	)
+	carrier.ForeachKey(func(key, val string) error {
+		if key != PropagationKeyBase64 {
+			return nil
+		}
+		var err error
+		if p, err = DecodeBase64(val); err == nil {
+			found = true
+		}
+		return nil
+	})
+	if !found {
+		return ctx
+	}
+	return ContextWithPathway(ctx, p)
+}
+
+// InjectToCarrier propagates the pathway held by ctx, if any, in carrier.
+func InjectToCarrier(ctx context.Context, carrier TextMapWriter) {
+	p, ok := PathwayFromContext(ctx)
+	if !ok {
+		return
+	}
+	carrier.Set(PropagationKeyBase64, p.EncodeBase64())
+}
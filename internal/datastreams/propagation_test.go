@@ -0,0 +1,70 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package datastreams
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mapCarrier map[string]string
+
+func (c mapCarrier) Set(key, val string) { c[key] = val }
+
+func (c mapCarrier) ForeachKey(handler func(key, val string) error) error {
+	for k, v := range c {
+		if err := handler(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestEncode(t *testing.T) {
+	p := Pathway{
+		hash:         234,
+		pathwayStart: time.Unix(1635418040, int64(time.Millisecond)),
+		edgeStart:    time.Unix(1635418050, 2*int64(time.Millisecond)),
+	}
+	decoded, err := Decode(p.Encode())
+	assert.NoError(t, err)
+	assert.Equal(t, p.Hash(), decoded.Hash())
+	assert.True(t, p.PathwayStart().Equal(decoded.PathwayStart()))
+	assert.True(t, p.EdgeStart().Equal(decoded.EdgeStart()))
+
+	decoded, err = DecodeBase64(p.EncodeBase64())
+	assert.NoError(t, err)
+	assert.Equal(t, p.Hash(), decoded.Hash())
+
+	_, err = Decode([]byte{1, 2, 3})
+	assert.Error(t, err)
+	_, err = DecodeBase64("invalid")
+	assert.Error(t, err)
+}
+
+func TestCarrier(t *testing.T) {
+	p := Pathway{
+		hash:         1,
+		pathwayStart: time.Unix(1635418040, 0),
+		edgeStart:    time.Unix(1635418050, 0),
+	}
+	carrier := mapCarrier{}
+	InjectToCarrier(context.Background(), carrier)
+	assert.Len(t, carrier, 0)
+
+	InjectToCarrier(ContextWithPathway(context.Background(), p), carrier)
+	assert.Contains(t, carrier, PropagationKeyBase64)
+
+	extracted, ok := PathwayFromContext(ExtractFromCarrier(context.Background(), carrier))
+	assert.True(t, ok)
+	assert.Equal(t, p.Hash(), extracted.Hash())
+
+	_, ok = PathwayFromContext(ExtractFromCarrier(context.Background(), mapCarrier{PropagationKeyBase64: "invalid"}))
+	assert.False(t, ok)
+}
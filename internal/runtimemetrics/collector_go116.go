@@ -0,0 +1,114 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build go1.16
+// +build go1.16
+
+package runtimemetrics
+
+import (
+	"runtime/metrics"
+	"sync"
+	"time"
+)
+
+// descriptions lists the runtime metrics collected into Stats, along with the
+// function setting their value.
+var descriptions = []struct {
+	name string
+	set  func(*Stats, metrics.Value)
+}{
+	{"/gc/heap/allocs:bytes", func(s *Stats, v metrics.Value) { s.HeapAllocBytes = v.Uint64() }},
+	{"/gc/heap/allocs:objects", func(s *Stats, v metrics.Value) { s.HeapAllocObjects += v.Uint64() }},
+	{"/gc/heap/frees:objects", func(s *Stats, v metrics.Value) { s.HeapFreeObjects += v.Uint64() }},
+	{"/gc/heap/tiny/allocs:objects", func(s *Stats, v metrics.Value) {
+		// Tiny objects are allocated and freed as part of a larger block.
+		s.HeapAllocObjects += v.Uint64()
+		s.HeapFreeObjects += v.Uint64()
+	}},
+	{"/gc/heap/objects:objects", func(s *Stats, v metrics.Value) { s.HeapObjects = v.Uint64() }},
+	{"/memory/classes/heap/objects:bytes", func(s *Stats, v metrics.Value) { s.HeapObjectsBytes = v.Uint64() }},
+	{"/memory/classes/heap/unused:bytes", func(s *Stats, v metrics.Value) { s.HeapUnusedBytes = v.Uint64() }},
+	{"/memory/classes/heap/free:bytes", func(s *Stats, v metrics.Value) { s.HeapFreeBytes = v.Uint64() }},
+	{"/memory/classes/heap/released:bytes", func(s *Stats, v metrics.Value) { s.HeapReleasedBytes = v.Uint64() }},
+	{"/gc/heap/goal:bytes", func(s *Stats, v metrics.Value) { s.HeapGoalBytes = v.Uint64() }},
+	{"/gc/heap/live:bytes", func(s *Stats, v metrics.Value) { s.HeapLiveBytes = v.Uint64() }},
+	{"/memory/classes/heap/stacks:bytes", func(s *Stats, v metrics.Value) { s.StackBytes = v.Uint64() }},
+	{"/memory/classes/os-stacks:bytes", func(s *Stats, v metrics.Value) { s.OSStackBytes = v.Uint64() }},
+	{"/memory/classes/metadata/mspan/inuse:bytes", func(s *Stats, v metrics.Value) { s.MSpanInuseBytes = v.Uint64() }},
+	{"/memory/classes/metadata/mspan/free:bytes", func(s *Stats, v metrics.Value) { s.MSpanFreeBytes = v.Uint64() }},
+	{"/memory/classes/metadata/mcache/inuse:bytes", func(s *Stats, v metrics.Value) { s.MCacheInuseBytes = v.Uint64() }},
+	{"/memory/classes/metadata/mcache/free:bytes", func(s *Stats, v metrics.Value) { s.MCacheFreeBytes = v.Uint64() }},
+	{"/memory/classes/profiling/buckets:bytes", func(s *Stats, v metrics.Value) { s.ProfilingBucketsBytes = v.Uint64() }},
+	{"/memory/classes/metadata/other:bytes", func(s *Stats, v metrics.Value) { s.GCMetadataBytes = v.Uint64() }},
+	{"/memory/classes/other:bytes", func(s *Stats, v metrics.Value) { s.OtherBytes = v.Uint64() }},
+	{"/memory/classes/total:bytes", func(s *Stats, v metrics.Value) { s.TotalBytes = v.Uint64() }},
+	{"/gc/cycles/total:gc-cycles", func(s *Stats, v metrics.Value) { s.GCCycles = v.Uint64() }},
+	{"/gc/cycles/forced:gc-cycles", func(s *Stats, v metrics.Value) { s.GCForcedCycles = v.Uint64() }},
+	{"/cpu/classes/gc/total:cpu-seconds", func(s *Stats, v metrics.Value) { s.GCCPUSeconds = v.Float64() }},
+	{"/cpu/classes/total:cpu-seconds", func(s *Stats, v metrics.Value) { s.TotalCPUSeconds = v.Float64() }},
+	{"/sync/mutex/wait/total:seconds", func(s *Stats, v metrics.Value) {
+		s.MutexWait = time.Duration(v.Float64() * float64(time.Second))
+	}},
+	{"/sched/pauses/total/gc:seconds", func(s *Stats, v metrics.Value) { s.GCPauses = newHistogram(v.Float64Histogram()) }},
+	{"/gc/pauses:seconds", func(s *Stats, v metrics.Value) {
+		// Deprecated in Go 1.22 for the identical metric above, which is
+		// preferred when both are supported.
+		if s.GCPauses.Counts == nil {
+			s.GCPauses = newHistogram(v.Float64Histogram())
+		}
+	}},
+	{"/sched/latencies:seconds", func(s *Stats, v metrics.Value) { s.SchedLatencies = newHistogram(v.Float64Histogram()) }},
+}
+
+// Supported reports whether the runtime metrics are read with runtime/metrics,
+// which provides the histograms and the metrics missing from
+// runtime.MemStats.
+const Supported = true
+
+// Collector reads the runtime metrics into Stats snapshots. It is safe for
+// concurrent use.
+type Collector struct {
+	mu      sync.Mutex
+	samples []metrics.Sample
+}
+
+// NewCollector returns a new runtime metrics collector.
+func NewCollector() *Collector {
+	samples := make([]metrics.Sample, len(descriptions))
+	for i, d := range descriptions {
+		samples[i].Name = d.name
+	}
+	return &Collector{samples: samples}
+}
+
+// Read returns a snapshot of the runtime metrics.
+func (c *Collector) Read() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	metrics.Read(c.samples)
+	var s Stats
+	for i, sample := range c.samples {
+		if sample.Value.Kind() == metrics.KindBad {
+			// Not supported by this Go version
+			continue
+		}
+		descriptions[i].set(&s, sample.Value)
+	}
+	if s.TotalCPUSeconds > 0 {
+		s.GCCPUFraction = s.GCCPUSeconds / s.TotalCPUSeconds
+	}
+	readGCStats(&s)
+	return s
+}
+
+// newHistogram returns a copy of the given runtime histogram, as its memory
+// may be reused by the following metric reads.
+func newHistogram(h *metrics.Float64Histogram) Histogram {
+	return Histogram{
+		Counts:  append([]uint64(nil), h.Counts...),
+		Buckets: append([]float64(nil), h.Buckets...),
+	}
+}
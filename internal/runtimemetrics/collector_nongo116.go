@@ -0,0 +1,58 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build !go1.16
+// +build !go1.16
+
+package runtimemetrics
+
+import "runtime"
+
+// Supported reports whether the runtime metrics are read with runtime/metrics,
+// which provides the histograms and the metrics missing from
+// runtime.MemStats.
+const Supported = false
+
+// Collector reads the runtime metrics into Stats snapshots. Before Go 1.16,
+// they are read with runtime.ReadMemStats, and the metrics only provided by
+// runtime/metrics are left zero. It is safe for concurrent use.
+type Collector struct{}
+
+// NewCollector returns a new runtime metrics collector.
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+// Read returns a snapshot of the runtime metrics.
+func (c *Collector) Read() Stats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	s := Stats{
+		HeapAllocBytes:        ms.TotalAlloc,
+		HeapAllocObjects:      ms.Mallocs,
+		HeapFreeObjects:       ms.Frees,
+		HeapObjects:           ms.HeapObjects,
+		HeapObjectsBytes:      ms.HeapAlloc,
+		HeapUnusedBytes:       ms.HeapInuse - ms.HeapAlloc,
+		HeapFreeBytes:         ms.HeapIdle - ms.HeapReleased,
+		HeapReleasedBytes:     ms.HeapReleased,
+		HeapGoalBytes:         ms.NextGC,
+		StackBytes:            ms.StackInuse,
+		OSStackBytes:          ms.StackSys - ms.StackInuse,
+		MSpanInuseBytes:       ms.MSpanInuse,
+		MSpanFreeBytes:        ms.MSpanSys - ms.MSpanInuse,
+		MCacheInuseBytes:      ms.MCacheInuse,
+		MCacheFreeBytes:       ms.MCacheSys - ms.MCacheInuse,
+		ProfilingBucketsBytes: ms.BuckHashSys,
+		GCMetadataBytes:       ms.GCSys,
+		OtherBytes:            ms.OtherSys,
+		TotalBytes:            ms.Sys,
+		GCCycles:              uint64(ms.NumGC),
+		GCForcedCycles:        uint64(ms.NumForcedGC),
+		GCCPUFraction:         ms.GCCPUFraction,
+	}
+	readGCStats(&s)
+	return s
+}
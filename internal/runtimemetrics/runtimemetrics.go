@@ -0,0 +1,248 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+// Package runtimemetrics collects the Go runtime metrics shared by the tracer
+// runtime metrics and the profiler metrics profile. It relies on
+// runtime/metrics which, unlike runtime.ReadMemStats, doesn't stop the world,
+// and falls back to runtime.ReadMemStats before Go 1.16.
+package runtimemetrics
+
+import (
+	"math"
+	"runtime/debug"
+	"time"
+)
+
+// Stats is a snapshot of the Go runtime metrics. Counters are cumulative since
+// the program start, and the metrics not supported by the running Go version
+// are left zero, such as the histograms before Go 1.16.
+type Stats struct {
+	// Cumulative bytes and objects allocated on the heap, tiny objects
+	// included.
+	HeapAllocBytes   uint64
+	HeapAllocObjects uint64
+	// Cumulative heap objects freed, tiny objects included.
+	HeapFreeObjects uint64
+	// Heap objects currently allocated, and their size in bytes.
+	HeapObjects      uint64
+	HeapObjectsBytes uint64
+	// Heap memory reserved for heap objects but not used, free and not
+	// released to the OS, and released to the OS.
+	HeapUnusedBytes   uint64
+	HeapFreeBytes     uint64
+	HeapReleasedBytes uint64
+	// Heap size target of the end of the current GC cycle.
+	HeapGoalBytes uint64
+	// Heap memory occupied by live objects as of the last GC cycle.
+	HeapLiveBytes uint64
+
+	// Stack memory allocated from the heap, and reserved by the OS.
+	StackBytes   uint64
+	OSStackBytes uint64
+	// Runtime metadata memory, in use and free.
+	MSpanInuseBytes  uint64
+	MSpanFreeBytes   uint64
+	MCacheInuseBytes uint64
+	MCacheFreeBytes  uint64
+	// Memory used by the profiling bucket hash tables.
+	ProfilingBucketsBytes uint64
+	// Memory used by the other GC metadata.
+	GCMetadataBytes uint64
+	// Memory used by the other runtime allocations.
+	OtherBytes uint64
+	// Memory mapped by the runtime.
+	TotalBytes uint64
+
+	// Cumulative GC cycles, and those forced by the application.
+	GCCycles       uint64
+	GCForcedCycles uint64
+	// Cumulative CPU time spent by the GC, and available to the program.
+	GCCPUSeconds    float64
+	TotalCPUSeconds float64
+	// Fraction of the available CPU time used by the GC since the program
+	// start, zero before Go 1.20 with runtime/metrics.
+	GCCPUFraction float64
+
+	// Cumulative time goroutines spent blocked on a sync.Mutex or
+	// sync.RWMutex.
+	MutexWait time.Duration
+
+	// Cumulative time of the stop-the-world pauses of the GC, and the most
+	// recent pauses, most recent first.
+	GCPauseTotal   time.Duration
+	RecentGCPauses []GCPause
+	// End of the last GC cycle, zero if there was none.
+	LastGC time.Time
+
+	// Distribution of the stop-the-world pauses of the GC, in seconds.
+	GCPauses Histogram
+	// Distribution of the time goroutines spent runnable before running, in
+	// seconds.
+	SchedLatencies Histogram
+}
+
+// Sub returns the difference between s and prev of the cumulative
+// histograms, so that they only account for the period between both
+// snapshots.
+func (s Stats) Sub(prev Stats) Stats {
+	s.GCPauses = s.GCPauses.Sub(prev.GCPauses)
+	s.SchedLatencies = s.SchedLatencies.Sub(prev.SchedLatencies)
+	return s
+}
+
+// GCPause is a stop-the-world pause of the GC.
+type GCPause struct {
+	End      time.Time
+	Duration time.Duration
+}
+
+// MaxGCPause returns the longest of the recent GC pauses which ended after
+// the given time.
+func (s Stats) MaxGCPause(since time.Time) (max time.Duration) {
+	for _, p := range s.RecentGCPauses {
+		// The pauses are sorted from the most recent
+		if p.End.Before(since) {
+			break
+		}
+		if p.Duration > max {
+			max = p.Duration
+		}
+	}
+	return max
+}
+
+// readGCStats sets the exact GC pause stats, which runtime/metrics only
+// reports as histograms. Unlike runtime.ReadMemStats, runtime/debug.ReadGCStats
+// doesn't stop the world.
+func readGCStats(s *Stats) {
+	var gc debug.GCStats
+	debug.ReadGCStats(&gc)
+	s.GCPauseTotal = gc.PauseTotal
+	s.LastGC = gc.LastGC
+	s.RecentGCPauses = make([]GCPause, len(gc.Pause))
+	for i, d := range gc.Pause {
+		s.RecentGCPauses[i] = GCPause{End: gc.PauseEnd[i], Duration: d}
+	}
+}
+
+// defaultCollector is the process-wide collector shared by the tracer and the
+// profiler.
+var defaultCollector = NewCollector()
+
+// Read returns a snapshot of the runtime metrics using the process-wide
+// collector.
+func Read() Stats {
+	return defaultCollector.Read()
+}
+
+// Histogram is a distribution of values, in seconds for the time histograms.
+type Histogram struct {
+	// Counts of values per bucket.
+	Counts []uint64
+	// Boundaries of the buckets, with len(Buckets) == len(Counts)+1. Bucket i
+	// counts the values in [Buckets[i], Buckets[i+1]), and the first and last
+	// boundaries may be infinite.
+	Buckets []float64
+}
+
+// Sub returns the histogram of the values added to h since prev, both being
+// cumulative histograms of the same metric.
+func (h Histogram) Sub(prev Histogram) Histogram {
+	if len(prev.Counts) != len(h.Counts) {
+		return h
+	}
+	counts := make([]uint64, len(h.Counts))
+	for i, c := range h.Counts {
+		if c > prev.Counts[i] {
+			counts[i] = c - prev.Counts[i]
+		}
+	}
+	return Histogram{Counts: counts, Buckets: h.Buckets}
+}
+
+// Total returns the number of values of the histogram.
+func (h Histogram) Total() (total uint64) {
+	for _, c := range h.Counts {
+		total += c
+	}
+	return total
+}
+
+// Quantile returns the upper boundary of the bucket of the q-quantile, with q
+// in [0, 1], or 0 when the histogram is empty.
+func (h Histogram) Quantile(q float64) float64 {
+	total := h.Total()
+	if total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+	var cumulated uint64
+	for i, c := range h.Counts {
+		cumulated += c
+		if cumulated >= rank {
+			return h.upperBound(i)
+		}
+	}
+	return h.upperBound(len(h.Counts) - 1)
+}
+
+// Max returns the upper boundary of the last non-empty bucket, or 0 when the
+// histogram is empty.
+func (h Histogram) Max() float64 {
+	for i := len(h.Counts) - 1; i >= 0; i-- {
+		if h.Counts[i] > 0 {
+			return h.upperBound(i)
+		}
+	}
+	return 0
+}
+
+// Sum returns an approximation of the sum of the values of the histogram,
+// using the middle of the buckets.
+func (h Histogram) Sum() (sum float64) {
+	for i, c := range h.Counts {
+		if c == 0 {
+			continue
+		}
+		lo, hi := h.Buckets[i], h.Buckets[i+1]
+		var v float64
+		switch {
+		case math.IsInf(lo, -1):
+			v = hi
+		case math.IsInf(hi, 1):
+			v = lo
+		default:
+			v = (lo + hi) / 2
+		}
+		sum += v * float64(c)
+	}
+	return sum
+}
+
+// upperBound returns the upper boundary of the given bucket, or its lower
+// boundary when the upper one is infinite.
+func (h Histogram) upperBound(i int) float64 {
+	if hi := h.Buckets[i+1]; !math.IsInf(hi, 1) {
+		return hi
+	}
+	return math.Max(h.Buckets[i], 0)
+}
+
+// Summary holds the main quantiles of a histogram.
+type Summary struct {
+	P50, P95, P99 float64
+}
+
+// Summary returns the p50, p95 and p99 quantiles of the histogram.
+func (h Histogram) Summary() Summary {
+	return Summary{
+		P50: h.Quantile(0.50),
+		P95: h.Quantile(0.95),
+		P99: h.Quantile(0.99),
+	}
+}
@@ -0,0 +1,119 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package runtimemetrics
+
+import (
+	"math"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRead(t *testing.T) {
+	prev := Read()
+	var sink [][]byte
+	for i := 0; i < 1000; i++ {
+		sink = append(sink, make([]byte, 1024))
+	}
+	runtime.KeepAlive(sink)
+	runtime.GC()
+	curr := Read()
+
+	assert := assert.New(t)
+	assert.Greater(curr.HeapAllocBytes, prev.HeapAllocBytes)
+	assert.Greater(curr.HeapAllocObjects, prev.HeapAllocObjects)
+	assert.Greater(curr.GCCycles, prev.GCCycles)
+	assert.NotZero(curr.HeapGoalBytes)
+	assert.NotZero(curr.HeapLiveBytes)
+	assert.NotZero(curr.TotalBytes)
+	assert.NotZero(curr.GCPauses.Total())
+	assert.Greater(curr.GCPauseTotal, prev.GCPauseTotal)
+	assert.NotEmpty(curr.RecentGCPauses)
+	assert.False(curr.LastGC.Before(curr.RecentGCPauses[0].End))
+	assert.True(curr.GCCPUFraction >= 0 && curr.GCCPUFraction <= 1)
+	assert.Len(curr.GCPauses.Buckets, len(curr.GCPauses.Counts)+1)
+	assert.Len(curr.SchedLatencies.Buckets, len(curr.SchedLatencies.Counts)+1)
+
+	delta := curr.Sub(prev)
+	assert.Equal(curr.GCPauses.Total()-prev.GCPauses.Total(), delta.GCPauses.Total())
+	assert.Equal(curr.HeapAllocBytes, delta.HeapAllocBytes, "only the histograms are subtracted")
+}
+
+func TestCollectorConcurrency(t *testing.T) {
+	c := NewCollector()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := c.Read()
+			assert.NotZero(t, s.TotalBytes)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMaxGCPause(t *testing.T) {
+	start := time.Now()
+	assert.Zero(t, Stats{}.MaxGCPause(start), "max is 0 without pauses")
+
+	s := Stats{RecentGCPauses: []GCPause{
+		{End: start.Add(1), Duration: time.Millisecond},
+		{End: start, Duration: time.Second},
+		{End: start.Add(-1), Duration: time.Minute},
+	}}
+	assert.Equal(t, time.Second, s.MaxGCPause(start), "only the pauses in the period are considered")
+	assert.Equal(t, time.Minute, s.MaxGCPause(time.Unix(0, 0)))
+}
+
+func TestHistogram(t *testing.T) {
+	h := Histogram{
+		Counts:  []uint64{0, 50, 45, 4, 1, 0},
+		Buckets: []float64{math.Inf(-1), 1, 2, 3, 4, math.Inf(1), math.Inf(1)},
+	}
+
+	t.Run("quantiles", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.Equal(uint64(100), h.Total())
+		assert.Equal(2., h.Quantile(0))
+		assert.Equal(2., h.Quantile(0.5))
+		assert.Equal(3., h.Quantile(0.95))
+		assert.Equal(4., h.Quantile(0.99))
+		assert.Equal(4., h.Quantile(1))
+		assert.Equal(Summary{P50: 2, P95: 3, P99: 4}, h.Summary())
+	})
+
+	t.Run("max", func(t *testing.T) {
+		assert.Equal(t, 4., h.Max())
+		overflow := Histogram{Counts: []uint64{1, 1}, Buckets: []float64{0, 1, math.Inf(1)}}
+		assert.Equal(t, 1., overflow.Max(), "the lower boundary is used for the overflow bucket")
+		underflow := Histogram{Counts: []uint64{1, 0}, Buckets: []float64{math.Inf(-1), 1, 2}}
+		assert.Equal(t, 1., underflow.Max())
+	})
+
+	t.Run("sum", func(t *testing.T) {
+		assert.Equal(t, 50*1.5+45*2.5+4*3.5+1*4., h.Sum())
+	})
+
+	t.Run("sub", func(t *testing.T) {
+		prev := Histogram{Counts: []uint64{0, 40, 45, 0, 0, 0}, Buckets: h.Buckets}
+		delta := h.Sub(prev)
+		assert.Equal(t, []uint64{0, 10, 0, 4, 1, 0}, delta.Counts)
+		assert.Equal(t, 4., delta.Max())
+		assert.Equal(t, h, h.Sub(Histogram{}), "subtracting an empty histogram is a no-op")
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		var empty Histogram
+		assert.Zero(t, empty.Total())
+		assert.Zero(t, empty.Quantile(0.5))
+		assert.Zero(t, empty.Max())
+		assert.Zero(t, empty.Sum())
+	})
+}
@@ -0,0 +1,156 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+
+	pprofile "github.com/google/pprof/profile"
+)
+
+// pruneThresholds are the fractions of the total value of a profile under
+// which its samples are pruned, tried in order until the batch fits into the
+// upload size budget.
+var pruneThresholds = []float64{0.0001, 0.001, 0.01, 0.1}
+
+// fitBatch returns a copy of the batch to upload, with its pprof profiles
+// compressed and fitting into the upload size budget. When over budget, the
+// samples of the pprof profiles accounting for less than increasing fractions
+// of their total value are pruned, and the largest profiles are dropped as a
+// last resort. The given batch is left untouched, so that its profiles are
+// still written as collected by WithOutputDir.
+func (p *profiler) fitBatch(bat batch) batch {
+	start, allocs := time.Now(), heapAllocs()
+	defer func() {
+		p.overhead.add(overheadUsage{encode: time.Since(start), allocBytes: heapAllocs() - allocs})
+	}()
+	up := bat
+	up.profiles = make([]*profile, 0, len(bat.profiles))
+	originals := make(map[*profile][]byte)
+	for _, prof := range bat.profiles {
+		c := *prof
+		up.profiles = append(up.profiles, &c)
+		if !isPprof(prof) {
+			continue
+		}
+		data, err := compress(p.cfg.compression, prof.data)
+		if err != nil {
+			log.Error("Failed to compress the %s profile: %v; uploading it as-is.", prof.name, err)
+			continue
+		}
+		originals[&c] = prof.data
+		c.data = data
+	}
+	bat = up
+	if bat.size() <= p.cfg.uploadBudget {
+		return bat
+	}
+
+	parsed := make(map[*profile]*pprofile.Profile)
+	for prof, data := range originals {
+		pp, err := pprofile.ParseData(data)
+		if err != nil {
+			log.Error("Failed to parse the %s profile for pruning: %v", prof.name, err)
+			continue
+		}
+		parsed[prof] = pp
+	}
+	pruned := make(map[*profile]bool)
+	for _, threshold := range pruneThresholds {
+		if bat.size() <= p.cfg.uploadBudget {
+			break
+		}
+		for prof, pp := range parsed {
+			prunedProf, n := prune(pp, threshold)
+			if n == 0 {
+				continue
+			}
+			var buf bytes.Buffer
+			if err := prunedProf.Write(&buf); err != nil {
+				log.Error("Failed to write the pruned %s profile: %v", prof.name, err)
+				continue
+			}
+			data, err := compress(p.cfg.compression, buf.Bytes())
+			if err != nil {
+				log.Error("Failed to compress the pruned %s profile: %v", prof.name, err)
+				continue
+			}
+			prof.data = data
+			pruned[prof] = true
+		}
+	}
+	for prof := range pruned {
+		p.cfg.statsd.Count("datadog.profiler.go.pruned_profile", 1, append(p.cfg.tags, "profile:"+prof.name), 1)
+	}
+	if len(pruned) > 0 {
+		log.Warn("Pruned the low-value samples of %d profiles to fit the upload size budget of %d bytes.", len(pruned), p.cfg.uploadBudget)
+	}
+
+	if bat.size() <= p.cfg.uploadBudget {
+		return bat
+	}
+	// Drop the largest profiles until the batch fits
+	sort.SliceStable(bat.profiles, func(i, j int) bool {
+		return len(bat.profiles[i].data) > len(bat.profiles[j].data)
+	})
+	for len(bat.profiles) > 0 && bat.size() > p.cfg.uploadBudget {
+		prof := bat.profiles[0]
+		bat.profiles = bat.profiles[1:]
+		p.cfg.statsd.Count("datadog.profiler.go.oversized_profile", 1, append(p.cfg.tags, "profile:"+prof.name), 1)
+		log.Error("Dropping the %s profile of %d bytes as it doesn't fit the upload size budget of %d bytes.", prof.name, len(prof.data), p.cfg.uploadBudget)
+	}
+	return bat
+}
+
+// size returns the size in bytes of the profiles of the batch.
+func (b *batch) size() (size int) {
+	for _, p := range b.profiles {
+		size += len(p.data)
+	}
+	return size
+}
+
+// prune returns a copy of the given profile without the samples accounting
+// for less than the given fraction of its total value, along with the number
+// of pruned samples. The value is the default sample type of the profile, or
+// its last sample type.
+func prune(pp *pprofile.Profile, threshold float64) (*pprofile.Profile, int) {
+	if len(pp.SampleType) == 0 {
+		return pp, 0
+	}
+	idx := len(pp.SampleType) - 1
+	for i, st := range pp.SampleType {
+		if st.Type == pp.DefaultSampleType {
+			idx = i
+		}
+	}
+	var total float64
+	for _, s := range pp.Sample {
+		total += math.Abs(float64(s.Value[idx]))
+	}
+	min := threshold * total
+	prunedProf := pp.Copy()
+	kept := prunedProf.Sample[:0]
+	for _, s := range prunedProf.Sample {
+		if math.Abs(float64(s.Value[idx])) >= min {
+			kept = append(kept, s)
+		}
+	}
+	n := len(prunedProf.Sample) - len(kept)
+	if n == 0 {
+		return pp, 0
+	}
+	prunedProf.Sample = kept
+	prunedProf.Comments = append(prunedProf.Comments, fmt.Sprintf("pruned %d samples below %g%% of the total %s", n, threshold*100, pp.SampleType[idx].Type))
+	// Remove the locations and functions no longer used
+	return prunedProf.Compact(), n
+}
@@ -0,0 +1,178 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	pprofile "github.com/google/pprof/profile"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// longTailProfile returns a goroutine profile made of one large sample and
+// many small ones.
+func longTailProfile(n int) []byte {
+	var text strings.Builder
+	text.WriteString("goroutine/count\nmain;serve 1000000\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&text, "main;worker;func%d 1\n", i)
+	}
+	return textProfile{Text: text.String()}.Protobuf()
+}
+
+func TestCompress(t *testing.T) {
+	data := textProfile{Text: "main;foo 5\nmain;bar 4\n"}.Protobuf()
+	require.True(t, bytes.HasPrefix(data, gzipMagic))
+
+	t.Run("gzip", func(t *testing.T) {
+		out, err := compress(CompressionGzip, data)
+		require.NoError(t, err)
+		assert.Equal(t, data, out, "gzip data is uploaded as-is")
+
+		raw := gunzip(t, data)
+		out, err = compress(CompressionGzip, raw)
+		require.NoError(t, err)
+		assert.Equal(t, raw, gunzip(t, out))
+	})
+
+	t.Run("zstd", func(t *testing.T) {
+		out, err := compress(CompressionZstd, data)
+		require.NoError(t, err)
+		assert.Equal(t, gunzip(t, data), unzstd(t, out), "gzip data is re-encoded")
+
+		raw := gunzip(t, data)
+		out, err = compress(CompressionZstd, raw)
+		require.NoError(t, err)
+		assert.Equal(t, raw, unzstd(t, out))
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		_, err := compress("lz4", data)
+		assert.Error(t, err)
+	})
+}
+
+func unzstd(t *testing.T, data []byte) []byte {
+	dec, err := zstd.NewReader(nil)
+	require.NoError(t, err)
+	defer dec.Close()
+	raw, err := dec.DecodeAll(data, nil)
+	require.NoError(t, err)
+	return raw
+}
+
+func gunzip(t *testing.T, data []byte) []byte {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	raw, err := ioutil.ReadAll(zr)
+	require.NoError(t, err)
+	return raw
+}
+
+func TestPrune(t *testing.T) {
+	pp, err := pprofile.ParseData(textProfile{Text: `
+samples/count duration/nanoseconds
+main;foo 5 500
+main;bar 4 5
+main;baz 3 495
+`}.Protobuf())
+	require.NoError(t, err)
+
+	pruned, n := prune(pp, 0.01)
+	assert.Equal(t, 1, n)
+	assert.Len(t, pp.Sample, 3, "the original profile should be left untouched")
+	var buf bytes.Buffer
+	require.NoError(t, pruned.Write(&buf))
+	assert.Equal(t, "samples/count duration/nanoseconds\nmain;foo 5 500\nmain;baz 3 495\n", protobufToText(buf.Bytes()))
+	assert.Len(t, pruned.Function, 3)
+	assert.Len(t, pruned.Comments, 1)
+
+	pruned, n = prune(pp, 0.001)
+	assert.Zero(t, n)
+	assert.Equal(t, pp, pruned)
+}
+
+func TestFitBatch(t *testing.T) {
+	newBatch := func() batch {
+		var bat batch
+		bat.addProfile(&profile{name: "goroutines.pprof", data: longTailProfile(10000)})
+		bat.addProfile(&profile{name: "metrics.json", data: []byte(`[["go_gcs_per_sec",0]]`)})
+		return bat
+	}
+
+	t.Run("invalid-config", func(t *testing.T) {
+		_, err := unstartedProfiler(WithUploadSizeBudget(0))
+		require.EqualError(t, err, "invalid upload size budget, must be > 0: 0")
+		_, err = unstartedProfiler(WithUploadCompression("lz4"))
+		require.EqualError(t, err, "unknown upload compression: lz4")
+	})
+
+	t.Run("within-budget", func(t *testing.T) {
+		p, err := unstartedProfiler()
+		require.NoError(t, err)
+		bat := newBatch()
+		data := bat.profiles[0].data
+		up := p.fitBatch(bat)
+		require.Len(t, up.profiles, 2)
+		assert.Equal(t, data, up.profiles[0].data)
+		assert.Equal(t, `[["go_gcs_per_sec",0]]`, string(up.profiles[1].data), "non-pprof profiles are uploaded as-is")
+	})
+
+	t.Run("uncompressed", func(t *testing.T) {
+		p, err := unstartedProfiler()
+		require.NoError(t, err)
+		bat := newBatch()
+		raw := gunzip(t, bat.profiles[0].data)
+		bat.profiles[0].data = raw
+		up := p.fitBatch(bat)
+		require.Len(t, up.profiles, 2)
+		assert.True(t, bytes.HasPrefix(up.profiles[0].data, gzipMagic))
+		assert.Equal(t, raw, bat.profiles[0].data, "the collected batch should be left untouched")
+	})
+
+	t.Run("zstd", func(t *testing.T) {
+		p, err := unstartedProfiler(WithUploadCompression(CompressionZstd))
+		require.NoError(t, err)
+		bat := newBatch()
+		data := bat.profiles[0].data
+		up := p.fitBatch(bat)
+		require.Len(t, up.profiles, 2)
+		assert.Equal(t, gunzip(t, data), unzstd(t, up.profiles[0].data))
+		assert.True(t, len(up.profiles[0].data) < len(data), "zstd should be smaller than the runtime gzip")
+		assert.Equal(t, `[["go_gcs_per_sec",0]]`, string(up.profiles[1].data), "non-pprof profiles are uploaded as-is")
+		assert.Equal(t, data, bat.profiles[0].data, "the collected batch should be left untouched")
+	})
+
+	t.Run("pruned", func(t *testing.T) {
+		bat := newBatch()
+		data := bat.profiles[0].data
+		budget := bat.size() / 4
+		p, err := unstartedProfiler(WithUploadSizeBudget(budget))
+		require.NoError(t, err)
+		up := p.fitBatch(bat)
+		require.Len(t, up.profiles, 2)
+		assert.True(t, up.size() <= budget)
+		assert.Equal(t, "goroutine/count\nmain;serve 1000000\n", protobufToText(up.profiles[0].data))
+		assert.Equal(t, data, bat.profiles[0].data, "the collected batch should be left untouched")
+	})
+
+	t.Run("oversized", func(t *testing.T) {
+		p, err := unstartedProfiler(WithUploadSizeBudget(100))
+		require.NoError(t, err)
+		bat := newBatch()
+		up := p.fitBatch(bat)
+		require.Len(t, up.profiles, 1)
+		assert.Equal(t, "metrics.json", up.profiles[0].name)
+		assert.Len(t, bat.profiles, 2, "the collected batch should be left untouched")
+	})
+}
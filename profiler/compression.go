@@ -0,0 +1,91 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the compression algorithm of the pprof profiles uploaded by
+// the profiler.
+type Compression string
+
+const (
+	// CompressionGzip uploads the pprof profiles gzip-compressed, as written
+	// by the Go runtime, which thus aren't compressed again. This is the
+	// default.
+	CompressionGzip Compression = "gzip"
+
+	// CompressionZstd uploads the pprof profiles zstd-compressed. They are
+	// decompressed from the gzip format of the Go runtime and compressed
+	// again with zstd, which produces smaller uploads at the cost of the
+	// re-encoding.
+	CompressionZstd Compression = "zstd"
+)
+
+// gzipMagic is the header of gzip-compressed data.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+var (
+	zstdEncoderOnce sync.Once
+	zstdEncoder     *zstd.Encoder
+	zstdEncoderErr  error
+)
+
+// isPprof returns true when the given profile is in the pprof format, and can
+// thus be compressed and pruned. The other profiles, such as the metrics or
+// the execution trace, are uploaded as-is.
+func isPprof(prof *profile) bool {
+	return strings.HasSuffix(prof.name, ".pprof")
+}
+
+// compress returns the given pprof data, either gzip-compressed or not,
+// compressed with the given algorithm. Data which is already gzip-compressed
+// is returned as-is with CompressionGzip.
+func compress(c Compression, data []byte) ([]byte, error) {
+	switch c {
+	case CompressionGzip:
+		if bytes.HasPrefix(data, gzipMagic) {
+			return data, nil
+		}
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		if bytes.HasPrefix(data, gzipMagic) {
+			zr, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			if data, err = ioutil.ReadAll(zr); err != nil {
+				return nil, err
+			}
+		}
+		zstdEncoderOnce.Do(func() {
+			zstdEncoder, zstdEncoderErr = zstd.NewWriter(nil)
+		})
+		if zstdEncoderErr != nil {
+			return nil, zstdEncoderErr
+		}
+		// EncodeAll is safe for concurrent use
+		return zstdEncoder.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown compression %q", c)
+	}
+}
@@ -6,7 +6,10 @@
 package profiler_test
 
 import (
+	"io"
 	"log"
+	"net/http"
+	"runtime/pprof"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/profiler"
 )
@@ -25,3 +28,50 @@ func Example() {
 
 	// ...
 }
+
+// This example illustrates how to collect and upload a custom runtime/pprof
+// profile along with the built-in ones.
+func ExampleRegisterProfileType() {
+	leases := pprof.NewProfile("example.com/pool.leases")
+	_, err := profiler.RegisterProfileType(profiler.CustomProfile{
+		Name:     "leases",
+		Filename: "leases.pprof",
+		Collect: func(w io.Writer) error {
+			return leases.WriteTo(w, 0)
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := profiler.Start(profiler.WithService("users-db")); err != nil {
+		log.Fatal(err)
+	}
+	defer profiler.Stop()
+
+	// ...
+}
+
+// This example illustrates how to let operators trigger the collection of
+// profiles on demand, e.g. when an alert fires, from an internal endpoint.
+func ExampleTriggerHandler() {
+	if err := profiler.Start(profiler.WithService("users-db")); err != nil {
+		log.Fatal(err)
+	}
+	defer profiler.Stop()
+
+	mux := http.NewServeMux()
+	// curl -X POST 'localhost:6060/debug/profiler/collect?types=cpu,goroutine'
+	mux.Handle("/debug/profiler/collect", profiler.TriggerHandler())
+	log.Fatal(http.ListenAndServe("localhost:6060", mux))
+}
+
+func ExamplePullHandler() {
+	if err := profiler.Start(profiler.WithService("users-db"), profiler.WithPullMode(5)); err != nil {
+		log.Fatal(err)
+	}
+	defer profiler.Stop()
+
+	// go tool pprof 'localhost:6060/debug/profiler/delta-heap'
+	http.Handle("/debug/profiler/", profiler.PullHandler())
+	log.Fatal(http.ListenAndServe("localhost:6060", nil))
+}
@@ -41,14 +41,6 @@ func (p Protobuf) Convert(protobuf *profile.Profile, text io.Writer) error {
 		return protobuf.Sample[i].Value[0] > protobuf.Sample[j].Value[0]
 	})
 	for _, sample := range protobuf.Sample {
-		var frames []string
-		for i := range sample.Location {
-			loc := sample.Location[len(sample.Location)-i-1]
-			for j := range loc.Line {
-				line := loc.Line[len(loc.Line)-j-1]
-				frames = append(frames, line.Function.Name)
-			}
-		}
 		var values []string
 		for _, val := range sample.Value {
 			values = append(values, fmt.Sprintf("%d", val))
@@ -59,9 +51,23 @@ func (p Protobuf) Convert(protobuf *profile.Profile, text io.Writer) error {
 		fmt.Fprintf(
 			w,
 			"%s %s\n",
-			strings.Join(frames, ";"),
+			FoldedStack(sample),
 			strings.Join(values, " "),
 		)
 	}
 	return w.Flush()
 }
+
+// FoldedStack returns the stack of the given sample in folded text format,
+// i.e. the function names from the root to the leaf separated by semicolons.
+func FoldedStack(sample *profile.Sample) string {
+	var frames []string
+	for i := range sample.Location {
+		loc := sample.Location[len(sample.Location)-i-1]
+		for j := range loc.Line {
+			line := loc.Line[len(loc.Line)-j-1]
+			frames = append(frames, line.Function.Name)
+		}
+	}
+	return strings.Join(frames, ";")
+}
@@ -0,0 +1,230 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+	"gopkg.in/DataDog/dd-trace-go.v1/profiler/internal/pprofutils"
+
+	pprofile "github.com/google/pprof/profile"
+)
+
+// goroutineLeaksFilename is the filename of the goroutine leak report
+// attached to the batches.
+const goroutineLeaksFilename = "goroutine-leaks.json"
+
+// maxLeakSuspects is the maximum number of stacks in the goroutine leak
+// report, keeping the ones with the most goroutines.
+const maxLeakSuspects = 10
+
+// leakDetector detects the possible goroutine leaks by comparing the
+// goroutine profiles of successive profiling periods. It is only used by the
+// collect goroutine.
+type leakDetector struct {
+	periods int                       // number of periods of growth for a stack to be suspect
+	wait    time.Duration             // wait duration for a stack to be suspect
+	stacks  map[string]*stackActivity // stacks of the previous period, in folded text format
+}
+
+// stackActivity is the goroutine activity of a stack across the periods.
+type stackActivity struct {
+	goroutines int64 // goroutine count in the last period
+	growth     int   // number of successive periods the goroutine count grew
+	suspect    bool  // whether the stack was suspect in the last period
+}
+
+// leakSuspect is a stack of the goroutine leak report.
+type leakSuspect struct {
+	Stack         string   `json:"stack"`
+	Goroutines    int64    `json:"goroutines"`
+	GrowthPeriods int      `json:"growth_periods"`
+	Waiting       int64    `json:"waiting_goroutines,omitempty"`
+	MaxWait       float64  `json:"max_wait_seconds,omitempty"`
+	Reasons       []string `json:"reasons"`
+}
+
+// leakReport is the goroutine leak report attached to the batches.
+type leakReport struct {
+	GrowthPeriods int           `json:"growth_periods"`
+	WaitSeconds   float64       `json:"wait_threshold_seconds"`
+	Suspects      []leakSuspect `json:"suspects"`
+	// Omitted is the number of suspect stacks over maxLeakSuspects.
+	Omitted int `json:"omitted,omitempty"`
+}
+
+func newLeakDetector(periods int, wait time.Duration) *leakDetector {
+	return &leakDetector{
+		periods: periods,
+		wait:    wait,
+		stacks:  make(map[string]*stackActivity),
+	}
+}
+
+// detectLeaks looks for possible goroutine leaks in the goroutine profiles of
+// the batch, reports them as metrics, and attaches the leak report to the
+// batch when there are any.
+func (p *profiler) detectLeaks(bat *batch) {
+	if p.leaks == nil {
+		return
+	}
+	var goroutines, waits *pprofile.Profile
+	for _, prof := range bat.profiles {
+		var err error
+		switch prof.name {
+		case GoroutineProfile.lookup().Filename:
+			goroutines, err = pprofile.ParseData(prof.data)
+		case expGoroutineWaitProfile.lookup().Filename:
+			waits, err = pprofile.ParseData(prof.data)
+		default:
+			continue
+		}
+		if err != nil {
+			log.Error("Failed to parse the %s profile for goroutine leak detection: %v", prof.name, err)
+		}
+	}
+	if goroutines == nil {
+		// The goroutine profile was skipped for this period, or couldn't be
+		// parsed
+		return
+	}
+	report := p.leaks.update(goroutines, waits)
+	var suspects int64
+	for _, s := range report.Suspects {
+		suspects += s.Goroutines
+	}
+	if g, ok := p.cfg.statsd.(statsdGauge); ok {
+		g.Gauge("datadog.profiler.go.goroutine_leak_stacks", float64(len(report.Suspects)+report.Omitted), p.cfg.tags, 1)
+		g.Gauge("datadog.profiler.go.goroutine_leak_goroutines", float64(suspects), p.cfg.tags, 1)
+	}
+	if len(report.Suspects) == 0 {
+		return
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		log.Error("Failed to marshal the goroutine leak report: %v", err)
+		return
+	}
+	bat.addProfile(&profile{name: goroutineLeaksFilename, data: data})
+}
+
+// update updates the goroutine activity of the stacks with the given
+// goroutine profile, and goroutine wait profile if not nil, and returns the
+// leak report of this period.
+func (d *leakDetector) update(goroutines, waits *pprofile.Profile) leakReport {
+	counts := make(map[string]int64)
+	for _, s := range goroutines.Sample {
+		if stack := leakStack(s); stack != "" && len(s.Value) > 0 {
+			counts[stack] += s.Value[0]
+		}
+	}
+	type waitStats struct {
+		waiting int64
+		max     time.Duration
+	}
+	waiting := make(map[string]*waitStats)
+	if waits != nil {
+		for _, s := range waits.Sample {
+			if len(s.Value) == 0 || time.Duration(s.Value[0]) < d.wait {
+				continue
+			}
+			stack := leakStack(s)
+			if stack == "" {
+				continue
+			}
+			// The goroutine wait profile includes the frame which created the
+			// goroutine at the root of its stack, which the goroutine profile
+			// doesn't.
+			if i := strings.IndexByte(stack, ';'); i >= 0 && counts[stack] == 0 && counts[stack[i+1:]] > 0 {
+				stack = stack[i+1:]
+			}
+			w := waiting[stack]
+			if w == nil {
+				w = &waitStats{}
+				waiting[stack] = w
+			}
+			w.waiting++
+			if wait := time.Duration(s.Value[0]); wait > w.max {
+				w.max = wait
+			}
+		}
+	}
+	// The goroutines waiting for stacks missing from the goroutine profile are
+	// still reported.
+	for stack, w := range waiting {
+		if counts[stack] == 0 {
+			counts[stack] = w.waiting
+		}
+	}
+
+	report := leakReport{
+		GrowthPeriods: d.periods,
+		WaitSeconds:   d.wait.Seconds(),
+	}
+	stacks := make(map[string]*stackActivity, len(counts))
+	for stack, n := range counts {
+		a := d.stacks[stack]
+		if a == nil {
+			a = &stackActivity{}
+		} else if n > a.goroutines {
+			a.growth++
+		} else {
+			a.growth = 0
+		}
+		a.goroutines = n
+		stacks[stack] = a
+
+		suspect := leakSuspect{Stack: stack, Goroutines: n, GrowthPeriods: a.growth}
+		if a.growth >= d.periods {
+			suspect.Reasons = append(suspect.Reasons, "growing")
+		}
+		if w := waiting[stack]; w != nil {
+			suspect.Waiting = w.waiting
+			suspect.MaxWait = w.max.Seconds()
+			suspect.Reasons = append(suspect.Reasons, "waiting")
+		}
+		wasSuspect := a.suspect
+		if a.suspect = len(suspect.Reasons) > 0; !a.suspect {
+			continue
+		}
+		if !wasSuspect {
+			log.Warn("Possible goroutine leak of %d goroutines (%s): %s", n, strings.Join(suspect.Reasons, ", "), stack)
+		}
+		report.Suspects = append(report.Suspects, suspect)
+	}
+	d.stacks = stacks
+
+	sort.Slice(report.Suspects, func(i, j int) bool {
+		if report.Suspects[i].Goroutines != report.Suspects[j].Goroutines {
+			return report.Suspects[i].Goroutines > report.Suspects[j].Goroutines
+		}
+		return report.Suspects[i].Stack < report.Suspects[j].Stack
+	})
+	if n := len(report.Suspects); n > maxLeakSuspects {
+		report.Omitted = n - maxLeakSuspects
+		report.Suspects = report.Suspects[:maxLeakSuspects]
+	}
+	return report
+}
+
+// leakStack returns the stack of the given goroutine profile sample in folded
+// text format, without the frames of the runtime, which only the goroutine
+// profile includes, nor the virtual frame of the truncated stacks of the
+// goroutine wait profile.
+func leakStack(s *pprofile.Sample) string {
+	var frames []string
+	for _, f := range strings.Split(pprofutils.FoldedStack(s), ";") {
+		if f == "" || f == elidedFramesFunc || strings.HasPrefix(f, "runtime.") {
+			continue
+		}
+		frames = append(frames, f)
+	}
+	return strings.Join(frames, ";")
+}
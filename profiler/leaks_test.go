@@ -0,0 +1,131 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	pprofile "github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// goroutineProfile returns the given goroutine profile in folded text
+// format, parsed.
+func goroutineProfile(t *testing.T, text string) *pprofile.Profile {
+	prof, err := pprofile.ParseData(textProfile{Text: text}.Protobuf())
+	require.NoError(t, err)
+	return prof
+}
+
+func TestLeakDetector(t *testing.T) {
+	t.Run("growing", func(t *testing.T) {
+		d := newLeakDetector(2, time.Minute)
+		period := func(leaking int) leakReport {
+			return d.update(goroutineProfile(t, fmt.Sprintf(`
+goroutine/count
+main;serve;runtime.gopark 3
+main;handle;runtime.gopark %d
+`, leaking)), nil)
+		}
+		assert.Empty(t, period(1).Suspects)
+		assert.Empty(t, period(2).Suspects)
+		report := period(3)
+		require.Len(t, report.Suspects, 1)
+		assert.Equal(t, leakSuspect{
+			Stack:         "main;handle",
+			Goroutines:    3,
+			GrowthPeriods: 2,
+			Reasons:       []string{"growing"},
+		}, report.Suspects[0])
+		assert.Len(t, period(4).Suspects, 1)
+		assert.Empty(t, period(4).Suspects, "the goroutine count stopped growing")
+	})
+
+	t.Run("waiting", func(t *testing.T) {
+		d := newLeakDetector(2, time.Minute)
+		goroutines := goroutineProfile(t, `
+goroutine/count
+main.worker;runtime.gopark 2
+main.idle 1
+`)
+		waits := goroutineProfile(t, `
+waitduration/nanoseconds
+main.spawn;main.worker 120000000000
+main.spawn;main.worker 30000000000
+main.other;main.sleeping 600000000000
+`)
+		report := d.update(goroutines, waits)
+		require.Len(t, report.Suspects, 2)
+		assert.Equal(t, leakSuspect{
+			Stack:      "main.worker",
+			Goroutines: 2,
+			Waiting:    1,
+			MaxWait:    120,
+			Reasons:    []string{"waiting"},
+		}, report.Suspects[0])
+		assert.Equal(t, leakSuspect{
+			Stack:      "main.other;main.sleeping",
+			Goroutines: 1,
+			Waiting:    1,
+			MaxWait:    600,
+			Reasons:    []string{"waiting"},
+		}, report.Suspects[1])
+	})
+
+	t.Run("max-suspects", func(t *testing.T) {
+		d := newLeakDetector(2, time.Minute)
+		var waits strings.Builder
+		waits.WriteString("waitduration/nanoseconds\n")
+		for i := 0; i < maxLeakSuspects+2; i++ {
+			fmt.Fprintf(&waits, "main.func%d 120000000000\n", i)
+		}
+		report := d.update(goroutineProfile(t, "goroutine/count\nmain 1\n"), goroutineProfile(t, waits.String()))
+		assert.Len(t, report.Suspects, maxLeakSuspects)
+		assert.Equal(t, 2, report.Omitted)
+	})
+}
+
+func TestDetectLeaks(t *testing.T) {
+	var stats gaugeStatsd
+	p, err := unstartedProfiler(WithStatsd(&stats), WithGoroutineLeakDetection(2, time.Minute), WithProfileTypes(CPUProfile))
+	require.NoError(t, err)
+	_, ok := p.cfg.types[GoroutineProfile]
+	assert.True(t, ok, "the goroutine profile is enabled along with the leak detection")
+
+	for i := 1; i <= 3; i++ {
+		var bat batch
+		bat.addProfile(&profile{
+			name: "goroutines.pprof",
+			data: textProfile{Text: fmt.Sprintf("goroutine/count\nmain;handle %d\n", i)}.Protobuf(),
+		})
+		p.detectLeaks(&bat)
+		if i < 3 {
+			assert.Len(t, bat.profiles, 1)
+			assert.Zero(t, stats.gauge("datadog.profiler.go.goroutine_leak_stacks"))
+			continue
+		}
+		require.Len(t, bat.profiles, 2)
+		assert.Equal(t, goroutineLeaksFilename, bat.profiles[1].name)
+		var report leakReport
+		require.NoError(t, json.Unmarshal(bat.profiles[1].data, &report))
+		require.Len(t, report.Suspects, 1)
+		assert.Equal(t, "main;handle", report.Suspects[0].Stack)
+		assert.Equal(t, 1.0, stats.gauge("datadog.profiler.go.goroutine_leak_stacks"))
+		assert.Equal(t, 3.0, stats.gauge("datadog.profiler.go.goroutine_leak_goroutines"))
+	}
+
+	t.Run("invalid-config", func(t *testing.T) {
+		_, err := unstartedProfiler(WithGoroutineLeakDetection(1, time.Minute))
+		assert.EqualError(t, err, "invalid goroutine leak detection periods, must be >= 2: 1")
+		_, err = unstartedProfiler(WithGoroutineLeakDetection(2, 0))
+		assert.EqualError(t, err, "invalid goroutine leak detection wait, must be > 0: 0s")
+	})
+}
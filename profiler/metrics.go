@@ -10,8 +10,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
-	"runtime"
 	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/runtimemetrics"
 )
 
 type point struct {
@@ -27,6 +28,18 @@ func (p point) MarshalJSON() ([]byte, error) {
 	})
 }
 
+// UnmarshalJSON deserializes points from array tuples
+func (p *point) UnmarshalJSON(data []byte) error {
+	var tuple [2]json.RawMessage
+	if err := json.Unmarshal(data, &tuple); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(tuple[0], &p.metric); err != nil {
+		return err
+	}
+	return json.Unmarshal(tuple[1], &p.value)
+}
+
 type collectionTooFrequent struct {
 	min      time.Duration
 	observed time.Duration
@@ -38,8 +51,8 @@ func (e collectionTooFrequent) Error() string {
 
 type metrics struct {
 	collectedAt time.Time
-	stats       runtime.MemStats
-	compute     func(*runtime.MemStats, *runtime.MemStats, time.Duration, time.Time) []point
+	stats       runtimemetrics.Stats
+	compute     func(*runtimemetrics.Stats, *runtimemetrics.Stats, time.Duration, time.Time) []point
 }
 
 func newMetrics() *metrics {
@@ -50,7 +63,7 @@ func newMetrics() *metrics {
 
 func (m *metrics) reset(now time.Time) {
 	m.collectedAt = now
-	runtime.ReadMemStats(&m.stats)
+	m.stats = runtimemetrics.Read()
 }
 
 func (m *metrics) report(now time.Time, buf *bytes.Buffer) error {
@@ -81,15 +94,28 @@ func (m *metrics) report(now time.Time, buf *bytes.Buffer) error {
 	return nil
 }
 
-func computeMetrics(prev *runtime.MemStats, curr *runtime.MemStats, period time.Duration, now time.Time) []point {
+func computeMetrics(prev *runtimemetrics.Stats, curr *runtimemetrics.Stats, period time.Duration, now time.Time) []point {
+	// Histograms of the period, for the approximated quantiles
+	delta := curr.Sub(*prev)
+	pauses := delta.GCPauses.Summary()
+	latencies := delta.SchedLatencies.Summary()
 	return []point{
-		{metric: "go_alloc_bytes_per_sec", value: rate(curr.TotalAlloc, prev.TotalAlloc, period/time.Second)},
-		{metric: "go_allocs_per_sec", value: rate(curr.Mallocs, prev.Mallocs, period/time.Second)},
-		{metric: "go_frees_per_sec", value: rate(curr.Frees, prev.Frees, period/time.Second)},
-		{metric: "go_heap_growth_bytes_per_sec", value: rate(curr.HeapAlloc, prev.HeapAlloc, period/time.Second)},
-		{metric: "go_gcs_per_sec", value: rate(uint64(curr.NumGC), uint64(prev.NumGC), period/time.Second)},
-		{metric: "go_gc_pause_time", value: rate(curr.PauseTotalNs, prev.PauseTotalNs, period)}, // % of time spent paused
-		{metric: "go_max_gc_pause_time", value: float64(maxPauseNs(curr, now.Add(-period)))},
+		{metric: "go_alloc_bytes_per_sec", value: rate(curr.HeapAllocBytes, prev.HeapAllocBytes, period/time.Second)},
+		{metric: "go_allocs_per_sec", value: rate(curr.HeapAllocObjects, prev.HeapAllocObjects, period/time.Second)},
+		{metric: "go_frees_per_sec", value: rate(curr.HeapFreeObjects, prev.HeapFreeObjects, period/time.Second)},
+		{metric: "go_heap_growth_bytes_per_sec", value: rate(curr.HeapObjectsBytes, prev.HeapObjectsBytes, period/time.Second)},
+		{metric: "go_gcs_per_sec", value: rate(curr.GCCycles, prev.GCCycles, period/time.Second)},
+		{metric: "go_gc_pause_time", value: rate(uint64(curr.GCPauseTotal), uint64(prev.GCPauseTotal), period)}, // % of time spent paused
+		{metric: "go_max_gc_pause_time", value: float64(curr.MaxGCPause(now.Add(-period)))},
+		{metric: "go_gc_pause_time_p50", value: nanoseconds(pauses.P50)},
+		{metric: "go_gc_pause_time_p95", value: nanoseconds(pauses.P95)},
+		{metric: "go_gc_pause_time_p99", value: nanoseconds(pauses.P99)},
+		{metric: "go_sched_latency_p50", value: nanoseconds(latencies.P50)},
+		{metric: "go_sched_latency_p95", value: nanoseconds(latencies.P95)},
+		{metric: "go_sched_latency_p99", value: nanoseconds(latencies.P99)},
+		{metric: "go_heap_goal_bytes", value: float64(curr.HeapGoalBytes)},
+		{metric: "go_heap_live_bytes", value: float64(curr.HeapLiveBytes)},
+		{metric: "go_mutex_wait_time", value: rate(uint64(curr.MutexWait), uint64(prev.MutexWait), period)}, // % of time spent waiting
 	}
 }
 
@@ -97,24 +123,10 @@ func rate(curr, prev uint64, period time.Duration) float64 {
 	return float64(int64(curr)-int64(prev)) / float64(period)
 }
 
-// maxPauseNs returns maximum pause time within the recent period, assumes stats populated at period end
-func maxPauseNs(stats *runtime.MemStats, periodStart time.Time) (max uint64) {
-	// NB
-	// stats.PauseEnd is a circular buffer of recent GC pause end times as nanoseconds since the epoch.
-	// stats.PauseNs is a circular buffer of recent GC pause times in nanoseconds.
-	// The most recent pause is indexed by (stats.NumGC+255)%256
-
-	for i := 0; i < 256; i++ {
-		offset := (int(stats.NumGC) + 255 - i) % 256
-		// Stop searching if we find a PauseEnd outside the period
-		if time.Unix(0, int64(stats.PauseEnd[offset])).Before(periodStart) {
-			break
-		}
-		if stats.PauseNs[offset] > max {
-			max = stats.PauseNs[offset]
-		}
-	}
-	return max
+// nanoseconds converts the given seconds into nanoseconds, the unit of the
+// time metrics.
+func nanoseconds(s float64) float64 {
+	return s * float64(time.Second)
 }
 
 // removeInvalid removes NaN and +/-Inf values as they can't be json-serialized
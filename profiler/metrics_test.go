@@ -8,10 +8,11 @@ package profiler
 import (
 	"bytes"
 	"math"
-	"runtime"
 	"testing"
 	"time"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/runtimemetrics"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,43 +22,38 @@ func newTestMetrics(now time.Time) *metrics {
 	return m
 }
 
-func valsRing(vals ...time.Duration) [256]uint64 {
-	var ring [256]uint64
-	for i := 0; i < len(vals) && i < 256; i++ {
-		ring[i] = uint64(vals[i])
-	}
-	return ring
-}
-
-func timeRing(vals ...time.Time) [256]uint64 {
-	var ring [256]uint64
-	for i := 0; i < len(vals) && i < 256; i++ {
-		ring[i] = uint64(vals[i].UnixNano())
-	}
-	return ring
-}
-
 func TestMetricsCompute(t *testing.T) {
 	now := now()
-	prev := runtime.MemStats{
-		TotalAlloc:   100,
-		Mallocs:      10,
-		Frees:        2,
-		HeapAlloc:    75,
-		NumGC:        1,
-		PauseTotalNs: uint64(2 * time.Second),
-		PauseEnd:     timeRing(now.Add(-11 * time.Second)),
-		PauseNs:      valsRing(2 * time.Second),
+	buckets := []float64{math.Inf(-1), 0.25, 0.5, 1, 2, math.Inf(1)}
+	prev := runtimemetrics.Stats{
+		HeapAllocBytes:   100,
+		HeapAllocObjects: 10,
+		HeapFreeObjects:  2,
+		HeapObjectsBytes: 75,
+		GCCycles:         1,
+		MutexWait:        time.Second,
+		GCPauseTotal:     2 * time.Second,
+		RecentGCPauses:   []runtimemetrics.GCPause{{End: now.Add(-11 * time.Second), Duration: 2 * time.Second}},
+		GCPauses:         runtimemetrics.Histogram{Counts: []uint64{0, 0, 0, 1, 0}, Buckets: buckets},
+		SchedLatencies:   runtimemetrics.Histogram{Counts: []uint64{0, 10, 0, 0, 0}, Buckets: buckets},
 	}
-	curr := runtime.MemStats{
-		TotalAlloc:   150,
-		Mallocs:      14,
-		Frees:        30,
-		HeapAlloc:    50,
-		NumGC:        3,
-		PauseTotalNs: uint64(3 * time.Second),
-		PauseEnd:     timeRing(now.Add(-11*time.Second), now.Add(-9*time.Second), now.Add(-time.Second)),
-		PauseNs:      valsRing(time.Second, time.Second/2, time.Second/2),
+	curr := runtimemetrics.Stats{
+		HeapAllocBytes:   150,
+		HeapAllocObjects: 14,
+		HeapFreeObjects:  30,
+		HeapObjectsBytes: 50,
+		HeapGoalBytes:    4096,
+		HeapLiveBytes:    1024,
+		GCCycles:         3,
+		MutexWait:        2 * time.Second,
+		GCPauseTotal:     3 * time.Second,
+		RecentGCPauses: []runtimemetrics.GCPause{
+			{End: now.Add(-time.Second), Duration: time.Second / 2},
+			{End: now.Add(-9 * time.Second), Duration: time.Second / 2},
+			{End: now.Add(-11 * time.Second), Duration: 2 * time.Second},
+		},
+		GCPauses:       runtimemetrics.Histogram{Counts: []uint64{0, 0, 2, 1, 0}, Buckets: buckets},
+		SchedLatencies: runtimemetrics.Histogram{Counts: []uint64{0, 100, 5, 5, 0}, Buckets: buckets},
 	}
 
 	assert.Equal(t,
@@ -69,6 +65,15 @@ func TestMetricsCompute(t *testing.T) {
 			{metric: "go_gcs_per_sec", value: 0.2},
 			{metric: "go_gc_pause_time", value: 0.1}, // % of time spent paused
 			{metric: "go_max_gc_pause_time", value: float64(time.Second / 2)},
+			{metric: "go_gc_pause_time_p50", value: float64(time.Second)},
+			{metric: "go_gc_pause_time_p95", value: float64(time.Second)},
+			{metric: "go_gc_pause_time_p99", value: float64(time.Second)},
+			{metric: "go_sched_latency_p50", value: float64(time.Second / 2)},
+			{metric: "go_sched_latency_p95", value: float64(time.Second)},
+			{metric: "go_sched_latency_p99", value: float64(2 * time.Second)},
+			{metric: "go_heap_goal_bytes", value: 4096},
+			{metric: "go_heap_live_bytes", value: 1024},
+			{metric: "go_mutex_wait_time", value: 0.1}, // % of time spent waiting
 		},
 		computeMetrics(&prev, &curr, 10*time.Second, now))
 
@@ -81,39 +86,18 @@ func TestMetricsCompute(t *testing.T) {
 			{metric: "go_gcs_per_sec", value: 0},
 			{metric: "go_gc_pause_time", value: 0},
 			{metric: "go_max_gc_pause_time", value: 0},
+			{metric: "go_gc_pause_time_p50", value: 0},
+			{metric: "go_gc_pause_time_p95", value: 0},
+			{metric: "go_gc_pause_time_p99", value: 0},
+			{metric: "go_sched_latency_p50", value: 0},
+			{metric: "go_sched_latency_p95", value: 0},
+			{metric: "go_sched_latency_p99", value: 0},
+			{metric: "go_heap_goal_bytes", value: 0},
+			{metric: "go_heap_live_bytes", value: 0},
+			{metric: "go_mutex_wait_time", value: 0},
 		},
 		computeMetrics(&prev, &prev, 10*time.Second, now),
-		"identical memstats")
-}
-
-func TestMetricsMaxPauseNs(t *testing.T) {
-	start := now()
-
-	assert.Equal(t, uint64(0),
-		maxPauseNs(&runtime.MemStats{}, start),
-		"max is 0 for empty pause buffers")
-
-	assert.Equal(t, uint64(time.Second),
-		maxPauseNs(
-			&runtime.MemStats{
-				NumGC:    3,
-				PauseNs:  valsRing(time.Minute, time.Second, time.Millisecond),
-				PauseEnd: timeRing(start.Add(-1), start, start.Add(1)),
-			},
-			start,
-		),
-		"only values in period are considered")
-
-	assert.Equal(t, uint64(time.Minute),
-		maxPauseNs(
-			&runtime.MemStats{
-				NumGC:    1000,
-				PauseNs:  valsRing(time.Second, time.Minute, time.Millisecond),
-				PauseEnd: timeRing(),
-			},
-			time.Unix(0, 0),
-		),
-		"should terminate if all values are in period")
+		"identical stats")
 }
 
 func TestMetricsReport(t *testing.T) {
@@ -122,7 +106,7 @@ func TestMetricsReport(t *testing.T) {
 	var buf bytes.Buffer
 	m := newTestMetrics(now)
 
-	m.compute = func(_ *runtime.MemStats, _ *runtime.MemStats, _ time.Duration, _ time.Time) []point {
+	m.compute = func(_ *runtimemetrics.Stats, _ *runtimemetrics.Stats, _ time.Duration, _ time.Time) []point {
 		return []point{
 			{metric: "metric_name", value: 1.1},
 			{metric: "does_not_include_NaN", value: math.NaN()},
@@ -51,6 +51,40 @@ const (
 	// It can be overwritten using the DD_PROFILING_UPLOAD_TIMEOUT env variable
 	// or the WithUploadTimeout option.
 	DefaultUploadTimeout = 10 * time.Second
+
+	// DefaultExecutionTracePeriod specifies the default minimum interval
+	// between two execution traces. For more information or for changing this
+	// value, check WithExecutionTrace.
+	DefaultExecutionTracePeriod = 15 * time.Minute
+
+	// DefaultExecutionTraceDuration specifies the default maximum length of an
+	// execution trace.
+	DefaultExecutionTraceDuration = 5 * time.Second
+
+	// DefaultExecutionTraceLimit specifies the default maximum size in bytes of
+	// an execution trace.
+	DefaultExecutionTraceLimit = 5 * 1024 * 1024
+
+	// DefaultUploadSpoolMaxBytes specifies the default size limit in bytes of
+	// the upload spool. For more information or for changing this value,
+	// check WithUploadSpool.
+	DefaultUploadSpoolMaxBytes = 100 * 1024 * 1024
+
+	// DefaultUploadSizeBudget specifies the default maximum size in bytes of
+	// the profiles uploaded at once. For more information or for changing
+	// this value, check WithUploadSizeBudget.
+	DefaultUploadSizeBudget = 10 * 1024 * 1024
+
+	// DefaultGoroutineLeakPeriods specifies the default number of successive
+	// profiling periods the goroutine count of a stack must grow over to be
+	// reported as a possible goroutine leak. For more information or for
+	// changing this value, check WithGoroutineLeakDetection.
+	DefaultGoroutineLeakPeriods = 5
+
+	// DefaultGoroutineLeakWait specifies the default wait duration over which
+	// goroutines are reported as possibly leaked. For more information or for
+	// changing this value, check WithGoroutineLeakDetection.
+	DefaultGoroutineLeakWait = 10 * time.Minute
 )
 
 const (
@@ -100,7 +134,18 @@ type config struct {
 	maxGoroutinesWait int
 	mutexFraction     int
 	blockRate         int
+	tracePeriod       time.Duration
+	traceDuration     time.Duration
+	traceLimit        int
 	outputDir         string
+	spoolDir          string
+	spoolMaxBytes     int64
+	compression       Compression
+	uploadBudget      int
+	maxOverhead       float64
+	leakPeriods       int           // goroutine leak detection growth periods; 0 when disabled
+	leakWait          time.Duration // goroutine leak detection wait threshold
+	pullBatches       int           // number of batches kept in memory in pull mode; 0 when disabled
 	deltaProfiles     bool
 	logStartup        bool
 }
@@ -128,6 +173,17 @@ func logStartup(c *config) {
 		MutexProfileFraction int      `json:"mutex_profile_fraction"`
 		MaxGoroutinesWait    int      `json:"max_goroutines_wait"`
 		UploadTimeout        string   `json:"upload_timeout"`
+		TracePeriod          string   `json:"execution_trace_period"`
+		TraceDuration        string   `json:"execution_trace_duration"`
+		TraceLimit           int      `json:"execution_trace_limit_bytes"`
+		UploadSpoolDir       string   `json:"upload_spool_dir"`
+		UploadSpoolMaxBytes  int64    `json:"upload_spool_max_bytes"`
+		UploadCompression    string   `json:"upload_compression"`
+		UploadSizeBudget     int      `json:"upload_size_budget_bytes"`
+		MaxOverhead          float64  `json:"max_overhead_percent"`
+		GoroutineLeakPeriods int      `json:"goroutine_leak_periods"`
+		GoroutineLeakWait    string   `json:"goroutine_leak_wait"`
+		PullModeBatches      int      `json:"pull_mode_batches"`
 	}{
 		Date:                 time.Now().Format(time.RFC3339),
 		OSName:               osinfo.OSName(),
@@ -148,6 +204,17 @@ func logStartup(c *config) {
 		MutexProfileFraction: c.mutexFraction,
 		MaxGoroutinesWait:    c.maxGoroutinesWait,
 		UploadTimeout:        c.uploadTimeout.String(),
+		TracePeriod:          c.tracePeriod.String(),
+		TraceDuration:        c.traceDuration.String(),
+		TraceLimit:           c.traceLimit,
+		UploadSpoolDir:       c.spoolDir,
+		UploadSpoolMaxBytes:  c.spoolMaxBytes,
+		UploadCompression:    string(c.compression),
+		UploadSizeBudget:     c.uploadBudget,
+		MaxOverhead:          c.maxOverhead,
+		GoroutineLeakPeriods: c.leakPeriods,
+		GoroutineLeakWait:    c.leakWait.String(),
+		PullModeBatches:      c.pullBatches,
 	}
 	for t := range c.types {
 		info.EnabledProfiles = append(info.EnabledProfiles, t.String())
@@ -198,6 +265,12 @@ func defaultConfig() (*config, error) {
 		blockRate:         DefaultBlockRate,
 		mutexFraction:     DefaultMutexFraction,
 		uploadTimeout:     DefaultUploadTimeout,
+		tracePeriod:       DefaultExecutionTracePeriod,
+		traceDuration:     DefaultExecutionTraceDuration,
+		traceLimit:        DefaultExecutionTraceLimit,
+		spoolMaxBytes:     DefaultUploadSpoolMaxBytes,
+		compression:       CompressionGzip,
+		uploadBudget:      DefaultUploadSizeBudget,
 		maxGoroutinesWait: 1000, // arbitrary value, should limit STW to ~30ms
 		tags:              []string{fmt.Sprintf("pid:%d", os.Getpid())},
 		deltaProfiles:     internal.BoolEnv("DD_PROFILING_DELTA", true),
@@ -206,6 +279,9 @@ func defaultConfig() (*config, error) {
 	for _, t := range defaultProfileTypes {
 		c.addProfileType(t)
 	}
+	for _, t := range customProfileTypes() {
+		c.addProfileType(t)
+	}
 
 	agentHost, agentPort := defaultAgentHost, defaultAgentPort
 	if v := os.Getenv("DD_AGENT_HOST"); v != "" {
@@ -270,6 +346,81 @@ func defaultConfig() (*config, error) {
 	if v := os.Getenv("DD_PROFILING_OUTPUT_DIR"); v != "" {
 		withOutputDir(v)(&c)
 	}
+	if internal.BoolEnv("DD_PROFILING_EXECUTION_TRACE_ENABLED", false) {
+		c.addProfileType(ExecutionTrace)
+	}
+	if v := os.Getenv("DD_PROFILING_EXECUTION_TRACE_PERIOD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("DD_PROFILING_EXECUTION_TRACE_PERIOD: %s", err)
+		}
+		c.tracePeriod = d
+	}
+	if v := os.Getenv("DD_PROFILING_EXECUTION_TRACE_DURATION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("DD_PROFILING_EXECUTION_TRACE_DURATION: %s", err)
+		}
+		c.traceDuration = d
+	}
+	if v := os.Getenv("DD_PROFILING_EXECUTION_TRACE_LIMIT_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("DD_PROFILING_EXECUTION_TRACE_LIMIT_BYTES: %s", err)
+		}
+		c.traceLimit = n
+	}
+	if v := os.Getenv("DD_PROFILING_UPLOAD_SPOOL_DIR"); v != "" {
+		c.spoolDir = v
+	}
+	if v := os.Getenv("DD_PROFILING_UPLOAD_SPOOL_MAX_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("DD_PROFILING_UPLOAD_SPOOL_MAX_BYTES: %s", err)
+		}
+		c.spoolMaxBytes = n
+	}
+	if v := os.Getenv("DD_PROFILING_UPLOAD_COMPRESSION"); v != "" {
+		c.compression = Compression(v)
+	}
+	if v := os.Getenv("DD_PROFILING_UPLOAD_SIZE_BUDGET_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("DD_PROFILING_UPLOAD_SIZE_BUDGET_BYTES: %s", err)
+		}
+		c.uploadBudget = n
+	}
+	if v := os.Getenv("DD_PROFILING_MAX_OVERHEAD_PERCENT"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("DD_PROFILING_MAX_OVERHEAD_PERCENT: %s", err)
+		}
+		c.maxOverhead = f
+	}
+	if internal.BoolEnv("DD_PROFILING_GOROUTINE_LEAK_DETECTION_ENABLED", false) {
+		WithGoroutineLeakDetection(DefaultGoroutineLeakPeriods, DefaultGoroutineLeakWait)(&c)
+	}
+	if v := os.Getenv("DD_PROFILING_GOROUTINE_LEAK_PERIODS"); v != "" && c.leakPeriods != 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("DD_PROFILING_GOROUTINE_LEAK_PERIODS: %s", err)
+		}
+		c.leakPeriods = n
+	}
+	if v := os.Getenv("DD_PROFILING_GOROUTINE_LEAK_WAIT"); v != "" && c.leakPeriods != 0 {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("DD_PROFILING_GOROUTINE_LEAK_WAIT: %s", err)
+		}
+		c.leakWait = d
+	}
+	if v := os.Getenv("DD_PROFILING_PULL_MODE_BATCHES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("DD_PROFILING_PULL_MODE_BATCHES: %s", err)
+		}
+		c.pullBatches = n
+	}
 	if v := os.Getenv("DD_PROFILING_WAIT_PROFILE_MAX_GOROUTINES"); v != "" {
 		n, err := strconv.Atoi(v)
 		if err != nil {
@@ -370,7 +521,30 @@ func BlockProfileRate(rate int) Option {
 	}
 }
 
+// WithExecutionTrace turns on execution traces (runtime/trace) recording
+// scheduler latency, GC pauses, syscalls and network blocking timelines. To
+// keep its overhead low, an execution trace is recorded at most once every
+// period, for at most duration or until it reaches the given size limit in
+// bytes, and uploaded with the profiles of the current profiling period.
+// The spans started while recording are correlated with the trace by means of
+// runtime/trace tasks. The duration must be less than the profiling period.
+// These values can also be set with the DD_PROFILING_EXECUTION_TRACE_PERIOD,
+// DD_PROFILING_EXECUTION_TRACE_DURATION and
+// DD_PROFILING_EXECUTION_TRACE_LIMIT_BYTES env variables, while setting
+// DD_PROFILING_EXECUTION_TRACE_ENABLED to true turns them on with the
+// default values.
+func WithExecutionTrace(period, duration time.Duration, limit int) Option {
+	return func(cfg *config) {
+		cfg.addProfileType(ExecutionTrace)
+		cfg.tracePeriod = period
+		cfg.traceDuration = duration
+		cfg.traceLimit = limit
+	}
+}
+
 // WithProfileTypes specifies the profile types to be collected by the profiler.
+// The custom profile types registered with RegisterProfileType are only
+// collected when they are given too.
 func WithProfileTypes(types ...ProfileType) Option {
 	return func(cfg *config) {
 		// reset the types and only use what the user has specified
@@ -429,6 +603,99 @@ func WithUploadTimeout(d time.Duration) Option {
 	}
 }
 
+// WithUploadSpool turns on the disk-backed upload spool, storing into the
+// given directory the profile batches which could not be uploaded, e.g.
+// during an agent restart, and replaying them oldest first once the agent or
+// intake is reachable again. The spool is limited to maxBytes, evicting the
+// oldest batches to make room for the new ones, and is kept across restarts
+// of the program. These values can also be set with the
+// DD_PROFILING_UPLOAD_SPOOL_DIR and DD_PROFILING_UPLOAD_SPOOL_MAX_BYTES env
+// variables. The spool is disabled by default.
+func WithUploadSpool(dir string, maxBytes int64) Option {
+	return func(cfg *config) {
+		cfg.spoolDir = dir
+		cfg.spoolMaxBytes = maxBytes
+	}
+}
+
+// WithUploadCompression specifies the compression algorithm of the uploaded
+// pprof profiles, CompressionGzip by default, with which the profiles are
+// uploaded as compressed by the Go runtime. It can also be set with the
+// DD_PROFILING_UPLOAD_COMPRESSION env variable. Using an unknown algorithm
+// will cause an error when starting the profiler.
+func WithUploadCompression(c Compression) Option {
+	return func(cfg *config) {
+		cfg.compression = c
+	}
+}
+
+// WithUploadSizeBudget specifies the maximum size in bytes of the profiles
+// uploaded at once, after compression. When over budget, the samples
+// accounting for the smallest parts of the pprof profiles are pruned, and
+// the profiles which still don't fit are dropped. The default budget is
+// specified by DefaultUploadSizeBudget or the
+// DD_PROFILING_UPLOAD_SIZE_BUDGET_BYTES env variable. Using a negative value
+// or 0 will cause an error when starting the profiler.
+func WithUploadSizeBudget(bytes int) Option {
+	return func(cfg *config) {
+		cfg.uploadBudget = bytes
+	}
+}
+
+// WithMaxOverhead specifies the maximum percentage of the profiling period the
+// profiler may spend collecting, deriving and encoding the profiles, excluding
+// the CPU profile duration and the execution trace duration while which the
+// application runs as usual. When over this limit, the profiler reduces its
+// overhead for the next profiling periods by halving the goroutine profile
+// frequency, down to one every 16 profiling periods. The overhead is reported
+// as datadog.profiler.go.overhead_* metrics regardless of this limit. The
+// default value of 0 disables the adjustments, and can be changed with the
+// DD_PROFILING_MAX_OVERHEAD_PERCENT env variable. Using a negative value will
+// cause an error when starting the profiler.
+func WithMaxOverhead(percent float64) Option {
+	return func(cfg *config) {
+		cfg.maxOverhead = percent
+	}
+}
+
+// WithGoroutineLeakDetection enables the goroutine leak detection, which
+// compares the goroutine profiles of successive profiling periods and reports
+// the stacks whose goroutine count grew over the given number of periods in a
+// row, or whose goroutines have been waiting for longer than the given
+// duration, as the goroutine_leak_* metrics and a goroutine-leaks.json
+// attachment uploaded with the profiles. The goroutine profile is enabled
+// along with it, while the wait durations are only known when the
+// experimental goroutine wait profile is enabled too. It can also be enabled
+// with the DD_PROFILING_GOROUTINE_LEAK_DETECTION_ENABLED env variable, in which
+// case the number of periods and the duration default to
+// DefaultGoroutineLeakPeriods and DefaultGoroutineLeakWait, and can be changed
+// with the DD_PROFILING_GOROUTINE_LEAK_PERIODS and
+// DD_PROFILING_GOROUTINE_LEAK_WAIT env variables. Using a number of periods
+// lower than 2, or a negative or 0 duration will cause an error when starting
+// the profiler.
+func WithGoroutineLeakDetection(periods int, wait time.Duration) Option {
+	return func(cfg *config) {
+		cfg.leakPeriods = periods
+		cfg.leakWait = wait
+	}
+}
+
+// WithPullMode enables the pull mode, in which the profiles are no longer
+// uploaded to the agent or the intake. Instead, the given number of most
+// recent batches of profiles, including the delta profiles, are kept in
+// memory to be served by PullHandler, e.g. for environments scraping their
+// telemetry or for local tools such as go tool pprof. The pprof profiles are
+// kept as collected, regardless of WithUploadCompression and
+// WithUploadSizeBudget. It can also be enabled with the
+// DD_PROFILING_PULL_MODE_BATCHES env variable. The default value of 0
+// disables it, and using a negative value will cause an error when starting
+// the profiler.
+func WithPullMode(batches int) Option {
+	return func(cfg *config) {
+		cfg.pullBatches = batches
+	}
+}
+
 // WithSite specifies the datadog site (datadoghq.com, datadoghq.eu, etc.)
 // which profiles will be sent to.
 func WithSite(site string) Option {
@@ -119,6 +119,53 @@ func TestOptions(t *testing.T) {
 		assert.Contains(t, cfg.types, BlockProfile)
 	})
 
+	t.Run("WithExecutionTrace", func(t *testing.T) {
+		var cfg config
+		WithExecutionTrace(time.Hour, time.Second, 1024)(&cfg)
+		assert.Equal(t, time.Hour, cfg.tracePeriod)
+		assert.Equal(t, time.Second, cfg.traceDuration)
+		assert.Equal(t, 1024, cfg.traceLimit)
+		assert.Contains(t, cfg.types, ExecutionTrace)
+	})
+
+	t.Run("WithUploadSpool", func(t *testing.T) {
+		var cfg config
+		WithUploadSpool("/tmp/spool", 1024)(&cfg)
+		assert.Equal(t, "/tmp/spool", cfg.spoolDir)
+		assert.Equal(t, int64(1024), cfg.spoolMaxBytes)
+	})
+
+	t.Run("WithUploadCompression", func(t *testing.T) {
+		var cfg config
+		WithUploadCompression(CompressionZstd)(&cfg)
+		assert.Equal(t, CompressionZstd, cfg.compression)
+	})
+
+	t.Run("WithUploadSizeBudget", func(t *testing.T) {
+		var cfg config
+		WithUploadSizeBudget(1024)(&cfg)
+		assert.Equal(t, 1024, cfg.uploadBudget)
+	})
+
+	t.Run("WithMaxOverhead", func(t *testing.T) {
+		var cfg config
+		WithMaxOverhead(2.5)(&cfg)
+		assert.Equal(t, 2.5, cfg.maxOverhead)
+	})
+
+	t.Run("WithGoroutineLeakDetection", func(t *testing.T) {
+		var cfg config
+		WithGoroutineLeakDetection(3, time.Hour)(&cfg)
+		assert.Equal(t, 3, cfg.leakPeriods)
+		assert.Equal(t, time.Hour, cfg.leakWait)
+	})
+
+	t.Run("WithPullMode", func(t *testing.T) {
+		var cfg config
+		WithPullMode(3)(&cfg)
+		assert.Equal(t, 3, cfg.pullBatches)
+	})
+
 	t.Run("WithProfileTypes", func(t *testing.T) {
 		var cfg config
 		WithProfileTypes(HeapProfile)(&cfg)
@@ -302,6 +349,135 @@ func TestEnvVars(t *testing.T) {
 		assert.Contains(t, cfg.tags, "c:3")
 	})
 
+	t.Run("DD_PROFILING_EXECUTION_TRACE", func(t *testing.T) {
+		cfg, err := defaultConfig()
+		require.NoError(t, err)
+		assert.NotContains(t, cfg.types, ExecutionTrace)
+		assert.Equal(t, DefaultExecutionTracePeriod, cfg.tracePeriod)
+		assert.Equal(t, DefaultExecutionTraceDuration, cfg.traceDuration)
+		assert.Equal(t, DefaultExecutionTraceLimit, cfg.traceLimit)
+
+		os.Setenv("DD_PROFILING_EXECUTION_TRACE_ENABLED", "true")
+		defer os.Unsetenv("DD_PROFILING_EXECUTION_TRACE_ENABLED")
+		os.Setenv("DD_PROFILING_EXECUTION_TRACE_PERIOD", "1h")
+		defer os.Unsetenv("DD_PROFILING_EXECUTION_TRACE_PERIOD")
+		os.Setenv("DD_PROFILING_EXECUTION_TRACE_DURATION", "2s")
+		defer os.Unsetenv("DD_PROFILING_EXECUTION_TRACE_DURATION")
+		os.Setenv("DD_PROFILING_EXECUTION_TRACE_LIMIT_BYTES", "1024")
+		defer os.Unsetenv("DD_PROFILING_EXECUTION_TRACE_LIMIT_BYTES")
+		cfg, err = defaultConfig()
+		require.NoError(t, err)
+		assert.Contains(t, cfg.types, ExecutionTrace)
+		assert.Equal(t, time.Hour, cfg.tracePeriod)
+		assert.Equal(t, 2*time.Second, cfg.traceDuration)
+		assert.Equal(t, 1024, cfg.traceLimit)
+
+		os.Setenv("DD_PROFILING_EXECUTION_TRACE_LIMIT_BYTES", "lots")
+		_, err = defaultConfig()
+		assert.Error(t, err)
+	})
+
+	t.Run("DD_PROFILING_UPLOAD_SPOOL", func(t *testing.T) {
+		cfg, err := defaultConfig()
+		require.NoError(t, err)
+		assert.Equal(t, "", cfg.spoolDir)
+		assert.Equal(t, int64(DefaultUploadSpoolMaxBytes), cfg.spoolMaxBytes)
+
+		os.Setenv("DD_PROFILING_UPLOAD_SPOOL_DIR", "/tmp/spool")
+		defer os.Unsetenv("DD_PROFILING_UPLOAD_SPOOL_DIR")
+		os.Setenv("DD_PROFILING_UPLOAD_SPOOL_MAX_BYTES", "1024")
+		defer os.Unsetenv("DD_PROFILING_UPLOAD_SPOOL_MAX_BYTES")
+		cfg, err = defaultConfig()
+		require.NoError(t, err)
+		assert.Equal(t, "/tmp/spool", cfg.spoolDir)
+		assert.Equal(t, int64(1024), cfg.spoolMaxBytes)
+
+		os.Setenv("DD_PROFILING_UPLOAD_SPOOL_MAX_BYTES", "lots")
+		_, err = defaultConfig()
+		assert.Error(t, err)
+	})
+
+	t.Run("DD_PROFILING_UPLOAD_COMPRESSION", func(t *testing.T) {
+		cfg, err := defaultConfig()
+		require.NoError(t, err)
+		assert.Equal(t, CompressionGzip, cfg.compression)
+
+		os.Setenv("DD_PROFILING_UPLOAD_COMPRESSION", "zstd")
+		defer os.Unsetenv("DD_PROFILING_UPLOAD_COMPRESSION")
+		cfg, err = defaultConfig()
+		require.NoError(t, err)
+		assert.Equal(t, CompressionZstd, cfg.compression)
+	})
+
+	t.Run("DD_PROFILING_UPLOAD_SIZE_BUDGET_BYTES", func(t *testing.T) {
+		cfg, err := defaultConfig()
+		require.NoError(t, err)
+		assert.Equal(t, DefaultUploadSizeBudget, cfg.uploadBudget)
+
+		os.Setenv("DD_PROFILING_UPLOAD_SIZE_BUDGET_BYTES", "1024")
+		defer os.Unsetenv("DD_PROFILING_UPLOAD_SIZE_BUDGET_BYTES")
+		cfg, err = defaultConfig()
+		require.NoError(t, err)
+		assert.Equal(t, 1024, cfg.uploadBudget)
+
+		os.Setenv("DD_PROFILING_UPLOAD_SIZE_BUDGET_BYTES", "lots")
+		_, err = defaultConfig()
+		assert.Error(t, err)
+	})
+
+	t.Run("DD_PROFILING_MAX_OVERHEAD_PERCENT", func(t *testing.T) {
+		cfg, err := defaultConfig()
+		require.NoError(t, err)
+		assert.Zero(t, cfg.maxOverhead)
+
+		os.Setenv("DD_PROFILING_MAX_OVERHEAD_PERCENT", "1.5")
+		defer os.Unsetenv("DD_PROFILING_MAX_OVERHEAD_PERCENT")
+		cfg, err = defaultConfig()
+		require.NoError(t, err)
+		assert.Equal(t, 1.5, cfg.maxOverhead)
+
+		os.Setenv("DD_PROFILING_MAX_OVERHEAD_PERCENT", "lots")
+		_, err = defaultConfig()
+		assert.Error(t, err)
+	})
+
+	t.Run("DD_PROFILING_GOROUTINE_LEAK_DETECTION_ENABLED", func(t *testing.T) {
+		os.Setenv("DD_PROFILING_GOROUTINE_LEAK_PERIODS", "3")
+		defer os.Unsetenv("DD_PROFILING_GOROUTINE_LEAK_PERIODS")
+		cfg, err := defaultConfig()
+		require.NoError(t, err)
+		assert.Zero(t, cfg.leakPeriods, "the leak detection is opt-in")
+
+		os.Setenv("DD_PROFILING_GOROUTINE_LEAK_DETECTION_ENABLED", "true")
+		defer os.Unsetenv("DD_PROFILING_GOROUTINE_LEAK_DETECTION_ENABLED")
+		os.Setenv("DD_PROFILING_GOROUTINE_LEAK_WAIT", "1h")
+		defer os.Unsetenv("DD_PROFILING_GOROUTINE_LEAK_WAIT")
+		cfg, err = defaultConfig()
+		require.NoError(t, err)
+		assert.Equal(t, 3, cfg.leakPeriods)
+		assert.Equal(t, time.Hour, cfg.leakWait)
+
+		os.Setenv("DD_PROFILING_GOROUTINE_LEAK_WAIT", "forever")
+		_, err = defaultConfig()
+		assert.Error(t, err)
+	})
+
+	t.Run("DD_PROFILING_PULL_MODE_BATCHES", func(t *testing.T) {
+		cfg, err := defaultConfig()
+		require.NoError(t, err)
+		assert.Zero(t, cfg.pullBatches)
+
+		os.Setenv("DD_PROFILING_PULL_MODE_BATCHES", "3")
+		defer os.Unsetenv("DD_PROFILING_PULL_MODE_BATCHES")
+		cfg, err = defaultConfig()
+		require.NoError(t, err)
+		assert.Equal(t, 3, cfg.pullBatches)
+
+		os.Setenv("DD_PROFILING_PULL_MODE_BATCHES", "many")
+		_, err = defaultConfig()
+		assert.Error(t, err)
+	})
+
 	t.Run("DD_PROFILING_DELTA", func(t *testing.T) {
 		os.Setenv("DD_PROFILING_DELTA", "false")
 		defer os.Unsetenv("DD_PROFILING_DELTA")
@@ -0,0 +1,129 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"sync"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+)
+
+// maxGoroutineInterval is the highest number of profiling periods between two
+// goroutine profiles the profiler reduces their frequency to when over the
+// overhead limit.
+const maxGoroutineInterval = 16
+
+// overhead accounts for the time spent and the memory allocated by the
+// profiler itself while collecting, deriving and encoding the profiles.
+type overhead struct {
+	mu         sync.Mutex
+	collect    time.Duration // time spent collecting the profiles, except while waiting for the CPU profile or execution trace
+	delta      time.Duration // time spent deriving the delta profiles
+	encode     time.Duration // time spent compressing and pruning the profiles
+	allocBytes uint64        // bytes allocated while deriving and encoding the profiles
+	waiting    time.Duration // time spent waiting while collecting the current profile
+}
+
+// overheadUsage is a snapshot of the overhead of a profiling period.
+type overheadUsage struct {
+	collect, delta, encode time.Duration
+	allocBytes             uint64
+}
+
+// total returns the time spent by the profiler.
+func (u overheadUsage) total() time.Duration {
+	return u.collect + u.delta + u.encode
+}
+
+// percent returns the time spent by the profiler as a percentage of the
+// given period.
+func (u overheadUsage) percent(period time.Duration) float64 {
+	if period <= 0 {
+		return 0
+	}
+	return float64(u.total()) / float64(period) * 100
+}
+
+// add adds the given usage.
+func (o *overhead) add(u overheadUsage) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.collect += u.collect
+	o.delta += u.delta
+	o.encode += u.encode
+	o.allocBytes += u.allocBytes
+}
+
+// wait accounts for the given time spent waiting, e.g. for the CPU profile
+// duration, while collecting a profile, which isn't part of the overhead.
+func (o *overhead) wait(d time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.waiting += d
+}
+
+// collected accounts for the collection of a profile which took the given
+// time, including the time spent waiting.
+func (o *overhead) collected(d time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if d -= o.waiting; d > 0 {
+		o.collect += d
+	}
+	o.waiting = 0
+}
+
+// reset returns the usage accounted for since the last reset, and resets it.
+func (o *overhead) reset() overheadUsage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	u := overheadUsage{collect: o.collect, delta: o.delta, encode: o.encode, allocBytes: o.allocBytes}
+	o.collect, o.delta, o.encode, o.allocBytes = 0, 0, 0, 0
+	return u
+}
+
+// reportOverhead reports the overhead of the profiler since the last report,
+// and reduces it when over the configured limit.
+func (p *profiler) reportOverhead() {
+	u := p.overhead.reset()
+	pct := u.percent(p.cfg.period)
+	p.cfg.statsd.Timing("datadog.profiler.go.overhead_collect_time", u.collect, p.cfg.tags, 1)
+	p.cfg.statsd.Timing("datadog.profiler.go.overhead_delta_time", u.delta, p.cfg.tags, 1)
+	p.cfg.statsd.Timing("datadog.profiler.go.overhead_encode_time", u.encode, p.cfg.tags, 1)
+	p.cfg.statsd.Count("datadog.profiler.go.overhead_alloc_bytes", int64(u.allocBytes), p.cfg.tags, 1)
+	if g, ok := p.cfg.statsd.(statsdGauge); ok {
+		g.Gauge("datadog.profiler.go.overhead_percent", pct, p.cfg.tags, 1)
+	}
+	if p.cfg.maxOverhead > 0 && pct > p.cfg.maxOverhead {
+		p.reduceOverhead(pct)
+	}
+}
+
+// reduceOverhead makes the next profiling periods cheaper by halving the
+// goroutine profile frequency, as long as it can be reduced. Only the settings
+// whose cost is part of the measured overhead are adjusted: the CPU profile
+// duration is spent waiting, and the block profile rate affects the
+// application rather than the profiler.
+func (p *profiler) reduceOverhead(pct float64) {
+	if _, ok := p.cfg.types[GoroutineProfile]; !ok || p.goroutineInterval >= maxGoroutineInterval {
+		return
+	}
+	p.goroutineInterval *= 2
+	p.cfg.statsd.Count("datadog.profiler.go.overhead_adjusted", 1, append(p.cfg.tags, "setting:goroutine_interval"), 1)
+	log.Warn("Profiler overhead of %.2f%% exceeds the limit of %.2f%%; collecting the goroutine profile every %s.", pct, p.cfg.maxOverhead, time.Duration(p.goroutineInterval)*p.cfg.period)
+}
+
+// skipGoroutineProfile returns true when the goroutine profile is skipped
+// for this profiling period, as its frequency was reduced to limit the
+// overhead.
+func (p *profiler) skipGoroutineProfile() bool {
+	if p.goroutineInterval <= 1 {
+		return false
+	}
+	p.goroutineCycle++
+	return p.goroutineCycle%p.goroutineInterval != 0
+}
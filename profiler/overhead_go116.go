@@ -0,0 +1,28 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+//go:build go1.16
+// +build go1.16
+
+package profiler
+
+import rtmetrics "runtime/metrics"
+
+// heapAllocsMetric is the runtime/metrics name of the cumulative bytes
+// allocated on the heap.
+const heapAllocsMetric = "/gc/heap/allocs:bytes"
+
+// heapAllocs returns the bytes allocated on the heap since the program
+// started. As it covers all goroutines, the difference between two calls also
+// includes the allocations of the application in the meantime, and is thus an
+// upper bound of the allocations of the profiler.
+func heapAllocs() uint64 {
+	s := []rtmetrics.Sample{{Name: heapAllocsMetric}}
+	rtmetrics.Read(s)
+	if s[0].Value.Kind() != rtmetrics.KindUint64 {
+		return 0
+	}
+	return s[0].Value.Uint64()
+}
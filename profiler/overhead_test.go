@@ -0,0 +1,153 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverhead(t *testing.T) {
+	var o overhead
+	o.wait(3 * time.Second)
+	o.collected(5 * time.Second)
+	o.collected(time.Second)
+	o.add(overheadUsage{delta: time.Second, encode: time.Second, allocBytes: 1024})
+	u := o.reset()
+	assert.Equal(t, overheadUsage{collect: 3 * time.Second, delta: time.Second, encode: time.Second, allocBytes: 1024}, u)
+	assert.Equal(t, 5.0, u.percent(100*time.Second))
+	assert.Equal(t, overheadUsage{}, o.reset())
+}
+
+func TestReportOverhead(t *testing.T) {
+	t.Run("accounting", func(t *testing.T) {
+		var stats gaugeStatsd
+		p, err := unstartedProfiler(
+			WithStatsd(&stats),
+			CPUDuration(100*time.Millisecond),
+			WithProfileTypes(CPUProfile, HeapProfile),
+		)
+		require.NoError(t, err)
+		p.collectBatch(p.enabledProfileTypes(), p.runProfile)
+		u := p.overhead.reset()
+		assert.True(t, u.collect > 0)
+		assert.True(t, u.collect < 100*time.Millisecond, "the CPU profile duration isn't part of the overhead: %s", u.collect)
+		assert.True(t, u.delta > 0)
+
+		p.overhead.add(overheadUsage{collect: 3 * time.Second})
+		p.reportOverhead()
+		assert.Equal(t, 5.0, stats.gauge("datadog.profiler.go.overhead_percent"))
+	})
+
+	t.Run("reduce", func(t *testing.T) {
+		p, err := unstartedProfiler(
+			WithMaxOverhead(1),
+			CPUDuration(4*time.Second),
+			BlockProfileRate(int(time.Millisecond)/2),
+			WithProfileTypes(CPUProfile, BlockProfile, GoroutineProfile),
+		)
+		require.NoError(t, err)
+
+		over := func() {
+			p.overhead.add(overheadUsage{encode: time.Second})
+			p.reportOverhead()
+		}
+		for _, interval := range []int{2, 4, 8, 16, 16} {
+			over()
+			assert.Equal(t, interval, p.goroutineInterval)
+		}
+		// The settings whose cost isn't measured are left untouched
+		assert.Equal(t, 4*time.Second, p.cfg.cpuDuration)
+		assert.Equal(t, int(time.Millisecond)/2, p.cfg.blockRate)
+
+		// Within the limit
+		p.goroutineInterval = 1
+		p.overhead.add(overheadUsage{encode: 100 * time.Millisecond})
+		p.reportOverhead()
+		assert.Equal(t, 1, p.goroutineInterval)
+	})
+
+	t.Run("reduced", func(t *testing.T) {
+		defer func(old func(_ string, _ io.Writer, _ int) error) { lookupProfile = old }(lookupProfile)
+		lookupProfile = func(name string, w io.Writer, _ int) error {
+			time.Sleep(50 * time.Millisecond)
+			_, err := w.Write([]byte(name))
+			return err
+		}
+		var stats gaugeStatsd
+		p, err := unstartedProfiler(
+			WithStatsd(&stats),
+			WithPeriod(time.Second),
+			WithMaxOverhead(1),
+			WithProfileTypes(GoroutineProfile),
+		)
+		require.NoError(t, err)
+
+		// measure returns the average overhead of the given number of
+		// profiling periods.
+		measure := func(periods int) (pct float64) {
+			for i := 0; i < periods; i++ {
+				_, err := p.runProfile(GoroutineProfile)
+				require.NoError(t, err)
+				p.reportOverhead()
+				pct += stats.gauge("datadog.profiler.go.overhead_percent")
+			}
+			return pct / float64(periods)
+		}
+		before := measure(1)
+		assert.True(t, before > 1, "over the limit: %.2f%%", before)
+		assert.Equal(t, 2, p.goroutineInterval)
+		after := measure(2)
+		assert.True(t, after < before, "the overhead should drop after the adjustment: %.2f%% >= %.2f%%", after, before)
+	})
+
+	t.Run("unmeasured", func(t *testing.T) {
+		p, err := unstartedProfiler(
+			WithMaxOverhead(1),
+			CPUDuration(4*time.Second),
+			WithProfileTypes(CPUProfile, HeapProfile),
+		)
+		require.NoError(t, err)
+		p.overhead.add(overheadUsage{encode: time.Second})
+		p.reportOverhead()
+		assert.Equal(t, 4*time.Second, p.cfg.cpuDuration)
+		assert.Equal(t, 1, p.goroutineInterval)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		p, err := unstartedProfiler(CPUDuration(4 * time.Second))
+		require.NoError(t, err)
+		p.overhead.add(overheadUsage{encode: time.Minute})
+		p.reportOverhead()
+		assert.Equal(t, 4*time.Second, p.cfg.cpuDuration)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := unstartedProfiler(WithMaxOverhead(-1))
+		assert.EqualError(t, err, "invalid max overhead, must be >= 0: -1")
+	})
+}
+
+func TestSkipGoroutineProfile(t *testing.T) {
+	p, err := unstartedProfiler(WithProfileTypes(GoroutineProfile))
+	require.NoError(t, err)
+	profs, err := p.runProfile(GoroutineProfile)
+	require.NoError(t, err)
+	assert.Len(t, profs, 1)
+
+	p.goroutineInterval = 2
+	var collected int
+	for i := 0; i < 4; i++ {
+		profs, err := p.runProfile(GoroutineProfile)
+		require.NoError(t, err)
+		collected += len(profs)
+	}
+	assert.Equal(t, 2, collected)
+}
@@ -12,6 +12,10 @@ import (
 	"io"
 	"runtime"
 	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"gopkg.in/DataDog/dd-trace-go.v1/profiler/internal/pprofutils"
@@ -45,6 +49,11 @@ const (
 	expGoroutineWaitProfile
 	// MetricsProfile reports top-line metrics associated with user-specified profiles
 	MetricsProfile
+	// ExecutionTrace records an execution trace (runtime/trace) of the
+	// scheduler, GC, syscall and network blocking events, at a lower frequency
+	// than the other profiles. Execution trace is not enabled by default, see
+	// WithExecutionTrace.
+	ExecutionTrace
 )
 
 // profileType holds the implementation details of a ProfileType.
@@ -69,6 +78,7 @@ type profileType struct {
 	Delta *pprofutils.Delta
 	// Collect collects the given profile and returns the data for it. Most
 	// profiles will be in pprof format, i.e. gzip compressed proto buf data.
+	// It returns errSkipProfile when the profile is skipped for this period.
 	Collect func(profileType, *profiler) ([]byte, error)
 }
 
@@ -82,7 +92,9 @@ var profileTypes = map[ProfileType]profileType{
 			if err := startCPUProfile(&buf); err != nil {
 				return nil, err
 			}
+			start := time.Now()
 			p.interruptibleSleep(p.cfg.cpuDuration)
+			p.overhead.wait(time.Since(start))
 			stopCPUProfile()
 			return buf.Bytes(), nil
 		},
@@ -121,23 +133,43 @@ var profileTypes = map[ProfileType]profileType{
 	expGoroutineWaitProfile: {
 		Name:     "goroutinewait",
 		Filename: "goroutineswait.pprof",
-		Collect: func(t profileType, p *profiler) ([]byte, error) {
+		Collect: func(_ profileType, p *profiler) ([]byte, error) {
 			if n := runtime.NumGoroutine(); n > p.cfg.maxGoroutinesWait {
 				return nil, fmt.Errorf("skipping goroutines wait profile: %d goroutines exceeds DD_PROFILING_WAIT_PROFILE_MAX_GOROUTINES limit of %d", n, p.cfg.maxGoroutinesWait)
 			}
 
 			var (
-				now   = now()
-				text  = &bytes.Buffer{}
-				pprof = &bytes.Buffer{}
+				now    = now()
+				text   = &bytes.Buffer{}
+				pprof  = &bytes.Buffer{}
+				labels *goroutineLabels
 			)
-			if err := lookupProfile(t.Name, text, 2); err != nil {
+			// The debug=2 output doesn't include the pprof labels of the
+			// goroutines, such as the trace endpoint and span ids set by the
+			// tracer, so they are recovered on a best-effort basis from a
+			// labelled goroutine profile taken right before: the goroutines
+			// may change in between, and the ones with the same stack can't
+			// be told apart. This second profile stops the world as well, so
+			// it is only taken when both fit in the goroutine limit.
+			if n := runtime.NumGoroutine(); 2*n <= p.cfg.maxGoroutinesWait {
+				buf := &bytes.Buffer{}
+				if err := lookupProfile("goroutine", buf, 0); err != nil {
+					return nil, err
+				}
+				labels = newGoroutineLabels(buf.Bytes())
+			}
+			if err := lookupProfile("goroutine", text, 2); err != nil {
 				return nil, err
 			}
-			err := goroutineDebug2ToPprof(text, pprof, now)
+			err := goroutineDebug2ToPprof(text, pprof, now, labels)
 			return pprof.Bytes(), err
 		},
 	},
+	ExecutionTrace: {
+		Name:     "trace",
+		Filename: "go.trace",
+		Collect:  collectExecutionTrace,
+	},
 	MetricsProfile: {
 		Name:     "metrics",
 		Filename: "metrics.json",
@@ -149,6 +181,170 @@ var profileTypes = map[ProfileType]profileType{
 	},
 }
 
+// customProfileTypeStart is the ProfileType of the first custom profile type,
+// leaving room for future built-in profile types.
+const customProfileTypeStart ProfileType = 1000
+
+var (
+	// profileTypesMu protects profileTypes and nextCustomProfileType from the
+	// concurrent registrations of custom profile types.
+	profileTypesMu sync.RWMutex
+	// nextCustomProfileType is the ProfileType of the next registered custom
+	// profile type.
+	nextCustomProfileType = customProfileTypeStart
+)
+
+// ValueType describes the type and the unit of the values of a profile sample,
+// such as alloc_space/bytes.
+type ValueType struct {
+	Type string
+	Unit string
+}
+
+// CustomProfile describes a user-defined profile type to register with
+// RegisterProfileType.
+type CustomProfile struct {
+	// Name of the profile, as returned by ProfileType.String() and reported in
+	// the profile_type tag. It must be unique.
+	Name string
+	// Filename used for uploading the profile, such as "leases.pprof". Delta
+	// profiles are prefixed with "delta-" automatically. It must be unique.
+	Filename string
+	// Delta controls if this profile should also be uploaded as a delta
+	// profile. This is useful for profiles that represent samples collected
+	// over the lifetime of the process.
+	Delta bool
+	// DeltaSampleTypes limits the delta profile derivation to the given sample
+	// types, the other ones retaining their current values. If empty, all
+	// sample types are subject to the delta profile derivation.
+	DeltaSampleTypes []ValueType
+	// Collect writes the profile in pprof format to w. For example, a custom
+	// runtime/pprof profile can be collected with
+	// func(w io.Writer) error { return prof.WriteTo(w, 0) }.
+	Collect func(w io.Writer) error
+}
+
+// RegisterProfileType registers the given custom profile type and returns its
+// ProfileType. Once registered, it is collected by the profilers started
+// afterwards along with the default profile types, at every profiling period,
+// and uploaded in the same batch. Using WithProfileTypes disables it, unless
+// its ProfileType is given too. An error is returned when the profile
+// description is incomplete or when its name or filename is already used by
+// another profile type.
+func RegisterProfileType(p CustomProfile) (ProfileType, error) {
+	if p.Name == "" {
+		return 0, errors.New("missing profile name")
+	}
+	if p.Filename == "" {
+		return 0, errors.New("missing profile filename")
+	}
+	if p.Collect == nil {
+		return 0, errors.New("missing profile collect function")
+	}
+	profileTypesMu.Lock()
+	defer profileTypesMu.Unlock()
+	for _, t := range profileTypes {
+		if t.Name == p.Name {
+			return 0, fmt.Errorf("profile name %s already used", p.Name)
+		}
+		if t.Filename == p.Filename {
+			return 0, fmt.Errorf("profile filename %s already used", p.Filename)
+		}
+	}
+	t := profileType{
+		Name:     p.Name,
+		Filename: p.Filename,
+		Collect: func(_ profileType, _ *profiler) ([]byte, error) {
+			var buf bytes.Buffer
+			err := p.Collect(&buf)
+			return buf.Bytes(), err
+		},
+	}
+	if p.Delta {
+		t.Delta = &pprofutils.Delta{}
+		for _, st := range p.DeltaSampleTypes {
+			t.Delta.SampleTypes = append(t.Delta.SampleTypes, pprofutils.ValueType{Type: st.Type, Unit: st.Unit})
+		}
+	}
+	pt := nextCustomProfileType
+	nextCustomProfileType++
+	profileTypes[pt] = t
+	return pt, nil
+}
+
+// customProfileTypes returns the registered custom profile types in their
+// registration order.
+func customProfileTypes() []ProfileType {
+	profileTypesMu.RLock()
+	defer profileTypesMu.RUnlock()
+	var types []ProfileType
+	for pt := range profileTypes {
+		if pt >= customProfileTypeStart {
+			types = append(types, pt)
+		}
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// collectExecutionTrace records an execution trace when the execution trace
+// period elapsed since the last one, until the execution trace duration or size
+// limit is reached.
+func collectExecutionTrace(_ profileType, p *profiler) ([]byte, error) {
+	start := now()
+	if !p.lastTrace.IsZero() && start.Sub(p.lastTrace) < p.cfg.tracePeriod {
+		return nil, errSkipProfile
+	}
+	p.lastTrace = start
+	var buf bytes.Buffer
+	w := &limitedWriter{w: &buf, limit: p.cfg.traceLimit, full: make(chan struct{})}
+	if err := startExecutionTrace(w); err != nil {
+		return nil, err
+	}
+	waitStart := time.Now()
+	select {
+	case <-p.exit:
+	case <-w.full:
+	case <-time.After(p.cfg.traceDuration):
+	}
+	p.overhead.wait(time.Since(waitStart))
+	stopExecutionTrace()
+	if w.truncated {
+		p.cfg.statsd.Count("datadog.profiler.go.execution_trace_truncated", 1, p.cfg.tags, 1)
+	}
+	return buf.Bytes(), nil
+}
+
+// limitedWriter writes up to limit bytes to w, discarding the rest, and closes
+// full once the limit is reached. It is only used by the single runtime/trace
+// writer goroutine, while full and truncated are only read once the execution
+// trace is stopped.
+type limitedWriter struct {
+	w         io.Writer
+	limit     int
+	written   int
+	truncated bool
+	full      chan struct{}
+}
+
+// Write implements io.Writer.
+func (l *limitedWriter) Write(b []byte) (int, error) {
+	if l.truncated {
+		return len(b), nil
+	}
+	n := len(b)
+	if l.written+len(b) > l.limit {
+		b = b[:l.limit-l.written]
+		l.truncated = true
+		close(l.full)
+	}
+	l.written += len(b)
+	if _, err := l.w.Write(b); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
 func collectGenericProfile(t profileType, _ *profiler) ([]byte, error) {
 	var buf bytes.Buffer
 	err := lookupProfile(t.Name, &buf, 0)
@@ -157,7 +353,9 @@ func collectGenericProfile(t profileType, _ *profiler) ([]byte, error) {
 
 // lookup returns t's profileType implementation.
 func (t ProfileType) lookup() profileType {
+	profileTypesMu.RLock()
 	c, ok := profileTypes[t]
+	profileTypesMu.RUnlock()
 	if ok {
 		c.Type = t
 		return c
@@ -172,6 +370,18 @@ func (t ProfileType) lookup() profileType {
 	}
 }
 
+// profileTypeByName returns the profile type of the given name.
+func profileTypeByName(name string) (ProfileType, bool) {
+	profileTypesMu.RLock()
+	defer profileTypesMu.RUnlock()
+	for t, c := range profileTypes {
+		if c.Name == name {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
 // String returns the name of the profile.
 func (t ProfileType) String() string {
 	return t.lookup().Name
@@ -200,17 +410,29 @@ type batch struct {
 	start, end time.Time
 	host       string
 	profiles   []*profile
+	extraTags  []string // tags specific to this batch, e.g. its trigger
 }
 
 func (b *batch) addProfile(p *profile) {
 	b.profiles = append(b.profiles, p)
 }
 
+// errSkipProfile is returned by the profile types which are not collected at
+// every profiling period, when they are skipped.
+var errSkipProfile = errors.New("profile skipped")
+
 func (p *profiler) runProfile(pt ProfileType) ([]*profile, error) {
+	if pt == GoroutineProfile && p.skipGoroutineProfile() {
+		return nil, nil
+	}
 	start := now()
 	t := pt.lookup()
 	// Collect the original profile as-is.
 	data, err := t.Collect(t, p)
+	p.overhead.collected(now().Sub(start))
+	if err == errSkipProfile {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -219,13 +441,16 @@ func (p *profiler) runProfile(pt ProfileType) ([]*profile, error) {
 		data: data,
 	}}
 	// Compute the deltaProf (will be nil if not enabled for this profile type).
-	deltaStart := time.Now()
+	deltaStart, deltaAllocs := time.Now(), heapAllocs()
 	deltaProf, err := p.deltaProfile(t, data)
 	if err != nil {
 		return nil, fmt.Errorf("delta profile error: %s", err)
 	}
 	// Report metrics and append deltaProf if not nil.
 	end := now()
+	if deltaProf != nil {
+		p.overhead.add(overheadUsage{delta: end.Sub(deltaStart), allocBytes: heapAllocs() - deltaAllocs})
+	}
 	tags := append(p.cfg.tags, pt.Tag())
 	// TODO(fg) stop uploading non-delta profiles in the next version of
 	// dd-trace-go after delta profiles are released.
@@ -287,6 +512,10 @@ var (
 	startCPUProfile = pprof.StartCPUProfile
 	// stopCPUProfile stops the CPU profile; replaced in tests
 	stopCPUProfile = pprof.StopCPUProfile
+	// startExecutionTrace starts the execution trace; replaced in tests
+	startExecutionTrace = trace.Start
+	// stopExecutionTrace stops the execution trace; replaced in tests
+	stopExecutionTrace = trace.Stop
 )
 
 // lookpupProfile looks up the profile with the given name and writes it to w. It returns
@@ -299,7 +528,7 @@ var lookupProfile = func(name string, w io.Writer, debug int) error {
 	return prof.WriteTo(w, debug)
 }
 
-func goroutineDebug2ToPprof(r io.Reader, w io.Writer, t time.Time) (err error) {
+func goroutineDebug2ToPprof(r io.Reader, w io.Writer, t time.Time, labels *goroutineLabels) (err error) {
 	// gostackparse.Parse() has been extensively tested and should not crash
 	// under any circumstances, but we really want to avoid crashing a customers
 	// applications, so this code will recover from any unexpected panics and
@@ -338,6 +567,12 @@ func goroutineDebug2ToPprof(r io.Reader, w io.Writer, t time.Time) (err error) {
 			NumLabel: map[string][]int64{"goid": {int64(g.ID)}},
 		}
 
+		for k, v := range labels.take(g.Stack) {
+			if _, ok := sample.Label[k]; !ok {
+				sample.Label[k] = v
+			}
+		}
+
 		// Treat the frame that created this goroutine as part of the stack so it
 		// shows up in the stack trace / flame graph. Hopefully this will be more
 		// useful than confusing for people.
@@ -351,7 +586,7 @@ func goroutineDebug2ToPprof(r io.Reader, w io.Writer, t time.Time) (err error) {
 		// [1] https://github.com/DataDog/dd-trace-py/blob/e933d2485b9019a7afad7127f7c0eb541341cdb7/ddtrace/profiling/exporter/pprof.pyx#L117-L121
 		if g.FramesElided {
 			g.Stack = append(g.Stack, &gostackparse.Frame{
-				Func: "...additional frames elided...",
+				Func: elidedFramesFunc,
 			})
 		}
 
@@ -396,6 +631,90 @@ func goroutineDebug2ToPprof(r io.Reader, w io.Writer, t time.Time) (err error) {
 	return nil
 }
 
+// elidedFramesFunc is the function name of the virtual frame added to the
+// truncated stacks of the goroutine wait profile.
+const elidedFramesFunc = "...additional frames elided..."
+
+// goroutineLabels holds the pprof labels of the goroutines of a goroutine
+// profile, indexed by stack, so that they can be attached to the goroutines of
+// a debug=2 goroutine dump, which doesn't include them. As goroutines with the
+// same stack can't be told apart, the label sets of a stack are handed out in
+// order, each one as many times as goroutines carried it.
+type goroutineLabels struct {
+	stacks map[string][]*labelCount
+}
+
+// labelCount is a label set along with the number of goroutines left to
+// attach it to.
+type labelCount struct {
+	labels map[string][]string
+	count  int64
+}
+
+// maxLabelledStackDepth is the number of leaf frames used for matching the
+// stacks of both goroutine profiles, which have different depth limits.
+const maxLabelledStackDepth = 32
+
+// newGoroutineLabels returns the labels of the goroutines of the given
+// goroutine profile in pprof format. It returns nil when the profile can't be
+// parsed, or when no goroutine is labelled.
+func newGoroutineLabels(data []byte) *goroutineLabels {
+	prof, err := pprofile.ParseData(data)
+	if err != nil {
+		return nil
+	}
+	gl := &goroutineLabels{stacks: make(map[string][]*labelCount)}
+	for _, s := range prof.Sample {
+		if len(s.Label) == 0 || len(s.Value) == 0 {
+			continue
+		}
+		var funcs []string
+		for _, loc := range s.Location {
+			for _, line := range loc.Line {
+				if line.Function != nil {
+					funcs = appendStackFrame(funcs, line.Function.Name, line.Line)
+				}
+			}
+		}
+		key := strings.Join(funcs, "\n")
+		gl.stacks[key] = append(gl.stacks[key], &labelCount{labels: s.Label, count: s.Value[0]})
+	}
+	if len(gl.stacks) == 0 {
+		return nil
+	}
+	return gl
+}
+
+// take returns the labels of a goroutine with the given stack, or nil when
+// there isn't any left.
+func (gl *goroutineLabels) take(stack []*gostackparse.Frame) map[string][]string {
+	if gl == nil {
+		return nil
+	}
+	var funcs []string
+	for _, f := range stack {
+		funcs = appendStackFrame(funcs, f.Func, int64(f.Line))
+	}
+	key := strings.Join(funcs, "\n")
+	for _, lc := range gl.stacks[key] {
+		if lc.count > 0 {
+			lc.count--
+			return lc.labels
+		}
+	}
+	return nil
+}
+
+// appendStackFrame appends the given frame to the stack key, unless it is a
+// frame of the runtime, which the debug=2 goroutine dumps hide, or the stack
+// is already deep enough.
+func appendStackFrame(funcs []string, name string, line int64) []string {
+	if len(funcs) >= maxLabelledStackDepth || strings.HasPrefix(name, "runtime.") {
+		return funcs
+	}
+	return append(funcs, fmt.Sprintf("%s:%d", name, line))
+}
+
 // now returns current time in UTC.
 func now() time.Time {
 	return time.Now().UTC()
@@ -7,15 +7,19 @@ package profiler
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"runtime"
+	"runtime/pprof"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/traceprof"
 	"gopkg.in/DataDog/dd-trace-go.v1/profiler/internal/pprofutils"
 
 	pprofile "github.com/google/pprof/profile"
@@ -234,8 +238,36 @@ main.main()
 ...additional frames elided...
 `
 
+		// The labelled goroutine profile, taken along with the debug=2 one,
+		// has the same stack for the sleeping goroutine, once the runtime
+		// frames hidden by debug=2 are left out.
+		sleep := &pprofile.Function{ID: 1, Name: "time.Sleep"}
+		gopark := &pprofile.Function{ID: 2, Name: "runtime.gopark"}
+		labelled := &pprofile.Profile{
+			SampleType: []*pprofile.ValueType{{Type: "goroutine", Unit: "count"}},
+			Function:   []*pprofile.Function{sleep, gopark},
+			Location: []*pprofile.Location{
+				{ID: 1, Line: []pprofile.Line{{Function: gopark, Line: 363}}},
+				{ID: 2, Line: []pprofile.Line{{Function: sleep, Line: 188}}},
+			},
+		}
+		labelled.Sample = []*pprofile.Sample{{
+			Location: labelled.Location,
+			Value:    []int64{1},
+			Label: map[string][]string{
+				traceprof.TraceEndpoint: {"GET /users"},
+				traceprof.SpanID:        {"1234"},
+			},
+		}}
+		var labelledData bytes.Buffer
+		require.NoError(t, labelled.Write(&labelledData))
+
 		defer func(old func(_ string, _ io.Writer, _ int) error) { lookupProfile = old }(lookupProfile)
-		lookupProfile = func(_ string, w io.Writer, _ int) error {
+		lookupProfile = func(_ string, w io.Writer, debug int) error {
+			if debug == 0 {
+				_, err := w.Write(labelledData.Bytes())
+				return err
+			}
 			_, err := w.Write([]byte(sample))
 			return err
 		}
@@ -274,6 +306,12 @@ main.main()
 		require.Equal(t, []string{"false"}, pp.Sample[0].Label["lockedm"])
 		require.Equal(t, []int64{3}, pp.Sample[1].NumLabel["goid"])
 		require.Equal(t, []string{"id"}, pp.Sample[1].NumUnit["goid"])
+		// pprof labels of the labelled goroutine profile
+		require.Equal(t, []string{"GET /users"}, pp.Sample[1].Label[traceprof.TraceEndpoint])
+		require.Equal(t, []string{"1234"}, pp.Sample[1].Label[traceprof.SpanID])
+		require.Equal(t, []string{"sleep"}, pp.Sample[1].Label["state"])
+		require.Empty(t, pp.Sample[0].Label[traceprof.TraceEndpoint])
+		require.Empty(t, pp.Sample[2].Label[traceprof.TraceEndpoint])
 		// Virtual frame for "frames elided" goroutine
 		requireFunctions(t, pp.Sample[2], []string{
 			"main.stackDump",
@@ -287,6 +325,43 @@ main.main()
 		})
 	})
 
+	t.Run("goroutinewait-labels", func(t *testing.T) {
+		stop := make(chan struct{})
+		defer close(stop)
+		started := make(chan struct{})
+		pprof.Do(context.Background(), pprof.Labels(traceprof.TraceEndpoint, "GET /wait"), func(context.Context) {
+			go func() {
+				started <- struct{}{}
+				<-stop
+			}()
+		})
+		<-started
+
+		labelled := func(t *testing.T, maxGoroutines int) int {
+			p, err := unstartedProfiler()
+			require.NoError(t, err)
+			if maxGoroutines > 0 {
+				p.cfg.maxGoroutinesWait = maxGoroutines
+			}
+			profs, err := p.runProfile(expGoroutineWaitProfile)
+			require.NoError(t, err)
+			pp, err := pprofile.ParseData(profs[0].data)
+			require.NoError(t, err)
+			var n int
+			for _, s := range pp.Sample {
+				if v := s.Label[traceprof.TraceEndpoint]; len(v) > 0 {
+					assert.Equal(t, []string{"GET /wait"}, v)
+					n++
+				}
+			}
+			return n
+		}
+		assert.Equal(t, 1, labelled(t, 0))
+		// The labelled goroutine profile counts against the goroutine limit,
+		// so the labels are left out when only one profile fits in it.
+		assert.Equal(t, 0, labelled(t, runtime.NumGoroutine()+1))
+	})
+
 	t.Run("goroutineswaitLimit", func(t *testing.T) {
 		// spawGoroutines spawns n goroutines, waits for them to start executing,
 		// and then returns a func to stop them. For more details about `executing`
@@ -337,7 +412,7 @@ main.main()
 }
 
 func Test_goroutineDebug2ToPprof_CrashSafety(t *testing.T) {
-	err := goroutineDebug2ToPprof(panicReader{}, ioutil.Discard, time.Time{})
+	err := goroutineDebug2ToPprof(panicReader{}, ioutil.Discard, time.Time{}, nil)
 	require.NotNil(t, err)
 	require.Equal(t, "panic: 42", err.Error())
 }
@@ -413,3 +488,160 @@ func TestProfileTypeSoundness(t *testing.T) {
 		require.EqualError(t, err, "unknown profile type: -1")
 	})
 }
+
+// registerTestProfileType registers the given custom profile type for the
+// duration of the test.
+func registerTestProfileType(t *testing.T, p CustomProfile) ProfileType {
+	pt, err := RegisterProfileType(p)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		profileTypesMu.Lock()
+		defer profileTypesMu.Unlock()
+		delete(profileTypes, pt)
+	})
+	return pt
+}
+
+func TestRegisterProfileType(t *testing.T) {
+	collect := func(w io.Writer) error {
+		_, err := w.Write(textProfile{Text: "leases/count\nmain 5\n"}.Protobuf())
+		return err
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, test := range []struct {
+			profile CustomProfile
+			err     string
+		}{
+			{CustomProfile{Filename: "leases.pprof", Collect: collect}, "missing profile name"},
+			{CustomProfile{Name: "leases", Collect: collect}, "missing profile filename"},
+			{CustomProfile{Name: "leases", Filename: "leases.pprof"}, "missing profile collect function"},
+			{CustomProfile{Name: "heap", Filename: "leases.pprof", Collect: collect}, "profile name heap already used"},
+			{CustomProfile{Name: "leases", Filename: "cpu.pprof", Collect: collect}, "profile filename cpu.pprof already used"},
+		} {
+			_, err := RegisterProfileType(test.profile)
+			require.EqualError(t, err, test.err)
+		}
+	})
+
+	t.Run("collect", func(t *testing.T) {
+		leases := registerTestProfileType(t, CustomProfile{
+			Name:     "leases",
+			Filename: "leases.pprof",
+			Delta:    true,
+			Collect:  collect,
+		})
+		entries := registerTestProfileType(t, CustomProfile{
+			Name:     "entries",
+			Filename: "entries.pprof",
+			Collect:  collect,
+		})
+		require.Equal(t, "leases", leases.String())
+		require.Equal(t, "entries.pprof", entries.Filename())
+		require.Equal(t, "profile_type:entries", entries.Tag())
+
+		// The custom profile types are enabled by default, after the built-in
+		// ones.
+		p, err := unstartedProfiler(WithProfileTypes())
+		require.NoError(t, err)
+		require.Equal(t, []ProfileType{MetricsProfile}, p.enabledProfileTypes())
+		p, err = unstartedProfiler()
+		require.NoError(t, err)
+		require.Equal(t, []ProfileType{CPUProfile, HeapProfile, MetricsProfile, leases, entries}, p.enabledProfileTypes())
+
+		p, err = unstartedProfiler(WithProfileTypes(leases, entries))
+		require.NoError(t, err)
+		profs, err := p.runProfile(leases)
+		require.NoError(t, err)
+		require.Len(t, profs, 2)
+		require.Equal(t, "leases.pprof", profs[0].name)
+		require.Equal(t, "delta-leases.pprof", profs[1].name)
+		require.Equal(t, "leases/count\nmain 5\n", protobufToText(profs[0].data))
+		profs, err = p.runProfile(entries)
+		require.NoError(t, err)
+		require.Len(t, profs, 1)
+		require.Equal(t, "entries.pprof", profs[0].name)
+	})
+
+	t.Run("delta-sample-types", func(t *testing.T) {
+		pt := registerTestProfileType(t, CustomProfile{
+			Name:             "leases",
+			Filename:         "leases.pprof",
+			Delta:            true,
+			DeltaSampleTypes: []ValueType{{Type: "leases", Unit: "count"}},
+			Collect:          collect,
+		})
+		require.Equal(t, &pprofutils.Delta{SampleTypes: []pprofutils.ValueType{{Type: "leases", Unit: "count"}}}, pt.lookup().Delta)
+	})
+}
+
+func TestExecutionTrace(t *testing.T) {
+	t.Run("invalid", func(t *testing.T) {
+		_, err := unstartedProfiler(WithExecutionTrace(time.Hour, time.Hour, 1024))
+		require.EqualError(t, err, "invalid execution trace duration, must be > 0 and < 1m0s: 1h0m0s")
+		_, err = unstartedProfiler(WithExecutionTrace(time.Hour, time.Second, 0))
+		require.EqualError(t, err, "invalid execution trace limit, must be > 0: 0")
+	})
+
+	t.Run("period", func(t *testing.T) {
+		var starts int
+		defer func(old func(io.Writer) error) { startExecutionTrace = old }(startExecutionTrace)
+		startExecutionTrace = func(w io.Writer) error {
+			starts++
+			_, err := w.Write([]byte("trace"))
+			return err
+		}
+		defer func(old func()) { stopExecutionTrace = old }(stopExecutionTrace)
+		stopExecutionTrace = func() {}
+
+		p, err := unstartedProfiler(WithExecutionTrace(time.Hour, time.Millisecond, 1024))
+		require.NoError(t, err)
+		profs, err := p.runProfile(ExecutionTrace)
+		require.NoError(t, err)
+		require.Len(t, profs, 1)
+		require.Equal(t, "go.trace", profs[0].name)
+		require.Equal(t, "trace", string(profs[0].data))
+
+		// The next execution trace is only recorded once the execution trace
+		// period has elapsed.
+		profs, err = p.runProfile(ExecutionTrace)
+		require.NoError(t, err)
+		require.Empty(t, profs)
+		p.lastTrace = p.lastTrace.Add(-time.Hour)
+		profs, err = p.runProfile(ExecutionTrace)
+		require.NoError(t, err)
+		require.Len(t, profs, 1)
+		require.Equal(t, 2, starts)
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		defer func(old func(io.Writer) error) { startExecutionTrace = old }(startExecutionTrace)
+		startExecutionTrace = func(w io.Writer) error {
+			_, err := w.Write([]byte("0123456789"))
+			return err
+		}
+		defer func(old func()) { stopExecutionTrace = old }(stopExecutionTrace)
+		stopExecutionTrace = func() {}
+
+		// The execution trace is stopped as soon as its limit is reached.
+		p, err := unstartedProfiler(WithExecutionTrace(time.Hour, 30*time.Second, 4))
+		require.NoError(t, err)
+		start := time.Now()
+		profs, err := p.runProfile(ExecutionTrace)
+		require.NoError(t, err)
+		require.Less(t, time.Since(start), 30*time.Second)
+		require.Len(t, profs, 1)
+		require.Equal(t, "0123", string(profs[0].data))
+	})
+
+	t.Run("runtime", func(t *testing.T) {
+		p, err := unstartedProfiler(WithExecutionTrace(time.Hour, 10*time.Millisecond, DefaultExecutionTraceLimit))
+		require.NoError(t, err)
+		profs, err := p.runProfile(ExecutionTrace)
+		if err != nil {
+			t.Skipf("execution tracer unavailable: %v", err)
+		}
+		require.Len(t, profs, 1)
+		require.NotEmpty(t, profs[0].data)
+	})
+}
@@ -69,6 +69,16 @@ type profiler struct {
 	wg         sync.WaitGroup                    // wg waits for all goroutines to exit when stopping.
 	met        *metrics                          // metric collector state
 	prev       map[ProfileType]*pprofile.Profile // previous collection results for delta profiling
+	lastTrace  time.Time                         // start time of the last execution trace
+	spool      *spool                            // disk-backed spool of the failed uploads; nil when disabled
+	collecting chan struct{}                     // collecting is held while a batch is collected, as profiles can't be collected concurrently
+	overhead   overhead                          // resources used by the profiler itself since the last report
+	leaks      *leakDetector                     // goroutine leak detector; nil when disabled
+	pull       *pullStore                        // last batches kept in memory in pull mode; nil when disabled
+
+	// The following fields are only used while holding collecting.
+	goroutineInterval int // number of profiling periods between two goroutine profiles
+	goroutineCycle    int // number of profiling periods the goroutine profile was due
 }
 
 // newProfiler creates a new, unstarted profiler.
@@ -84,6 +94,15 @@ func newProfiler(opts ...Option) (*profiler, error) {
 	if os.Getenv("DD_PROFILING_WAIT_PROFILE") != "" {
 		cfg.addProfileType(expGoroutineWaitProfile)
 	}
+	if cfg.leakPeriods != 0 {
+		if cfg.leakPeriods < 2 {
+			return nil, fmt.Errorf("invalid goroutine leak detection periods, must be >= 2: %d", cfg.leakPeriods)
+		}
+		if cfg.leakWait <= 0 {
+			return nil, fmt.Errorf("invalid goroutine leak detection wait, must be > 0: %s", cfg.leakWait)
+		}
+		cfg.addProfileType(GoroutineProfile)
+	}
 	// Agentless upload is disabled by default as of v1.30.0, but
 	// WithAgentlessUpload can be used to enable it for testing and debugging.
 	if cfg.agentless {
@@ -126,23 +145,62 @@ func newProfiler(opts ...Option) (*profiler, error) {
 	if cfg.uploadTimeout <= 0 {
 		return nil, fmt.Errorf("invalid upload timeout, must be > 0: %s", cfg.uploadTimeout)
 	}
+	if cfg.compression != CompressionGzip && cfg.compression != CompressionZstd {
+		return nil, fmt.Errorf("unknown upload compression: %s", cfg.compression)
+	}
+	if cfg.uploadBudget <= 0 {
+		return nil, fmt.Errorf("invalid upload size budget, must be > 0: %d", cfg.uploadBudget)
+	}
+	if cfg.maxOverhead < 0 {
+		return nil, fmt.Errorf("invalid max overhead, must be >= 0: %g", cfg.maxOverhead)
+	}
+	if cfg.pullBatches < 0 {
+		return nil, fmt.Errorf("invalid pull mode batches, must be >= 0: %d", cfg.pullBatches)
+	}
+	if cfg.spoolDir != "" && cfg.spoolMaxBytes <= 0 {
+		return nil, fmt.Errorf("invalid upload spool size limit, must be > 0: %d", cfg.spoolMaxBytes)
+	}
+	if _, ok := cfg.types[ExecutionTrace]; ok {
+		if cfg.traceDuration <= 0 || cfg.traceDuration >= cfg.period {
+			return nil, fmt.Errorf("invalid execution trace duration, must be > 0 and < %s: %s", cfg.period, cfg.traceDuration)
+		}
+		if cfg.traceLimit <= 0 {
+			return nil, fmt.Errorf("invalid execution trace limit, must be > 0: %d", cfg.traceLimit)
+		}
+	}
+	profileTypesMu.RLock()
 	for pt := range cfg.types {
 		if _, ok := profileTypes[pt]; !ok {
+			profileTypesMu.RUnlock()
 			return nil, fmt.Errorf("unknown profile type: %d", pt)
 		}
 	}
+	profileTypesMu.RUnlock()
 	if cfg.logStartup {
 		logStartup(cfg)
 	}
 
 	p := profiler{
-		cfg:  cfg,
-		out:  make(chan batch, outChannelSize),
-		exit: make(chan struct{}),
-		met:  newMetrics(),
-		prev: make(map[ProfileType]*pprofile.Profile),
+		cfg:               cfg,
+		out:               make(chan batch, outChannelSize),
+		exit:              make(chan struct{}),
+		met:               newMetrics(),
+		prev:              make(map[ProfileType]*pprofile.Profile),
+		collecting:        make(chan struct{}, 1),
+		goroutineInterval: 1,
 	}
 	p.uploadFunc = p.upload
+	if cfg.leakPeriods != 0 {
+		p.leaks = newLeakDetector(cfg.leakPeriods, cfg.leakWait)
+	}
+	if cfg.pullBatches > 0 {
+		p.pull = newPullStore(cfg.pullBatches)
+	}
+	if cfg.spoolDir != "" {
+		if p.spool, err = openSpool(cfg.spoolDir, cfg.spoolMaxBytes); err != nil {
+			return nil, fmt.Errorf("could not open the upload spool: %v", err)
+		}
+	}
 	return &p, nil
 }
 
@@ -167,49 +225,83 @@ func (p *profiler) run() {
 		defer p.wg.Done()
 		p.send()
 	}()
+	if p.spool != nil {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.replaySpool()
+		}()
+	}
 }
 
 // collect runs the profile types found in the configuration whenever the ticker receives
 // an item.
 func (p *profiler) collect(ticker <-chan time.Time) {
-	defer close(p.out)
+	defer func() {
+		// Wait for the ongoing on-demand collection, and prevent new ones,
+		// before closing the upload queue.
+		p.collecting <- struct{}{}
+		close(p.out)
+	}()
+	first := true
 	for {
 		select {
 		case <-ticker:
-			now := now()
-			bat := batch{
-				host:  p.cfg.hostname,
-				start: now,
-				// NB: while this is technically wrong in that it does not
-				// record the actual start and end timestamps for the batch,
-				// it is how the backend understands the client-side
-				// configured CPU profile duration: (start-end).
-				end: now.Add(p.cfg.cpuDuration),
+			select {
+			case p.collecting <- struct{}{}:
+			case <-p.exit:
+				return
 			}
-
-			for _, t := range p.enabledProfileTypes() {
-				profs, err := p.runProfile(t)
-				if err != nil {
-					log.Error("Error getting %s profile: %v; skipping.", t, err)
-					p.cfg.statsd.Count("datadog.profiler.go.collect_error", 1, append(p.cfg.tags, t.Tag()), 1)
-					continue
-				}
-				for _, prof := range profs {
-					bat.addProfile(prof)
-				}
+			// Report the overhead of the previous period, now that the
+			// profiling settings can be adjusted.
+			if !first {
+				p.reportOverhead()
 			}
-			p.enqueueUpload(bat)
+			first = false
+			bat := p.collectBatch(p.enabledProfileTypes(), p.runProfile)
+			<-p.collecting
+			p.detectLeaks(&bat)
+			p.publish(bat)
 		case <-p.exit:
 			return
 		}
 	}
 }
 
+// collectBatch collects a batch of profiles of the given types using the
+// given function.
+func (p *profiler) collectBatch(types []ProfileType, run func(ProfileType) ([]*profile, error)) batch {
+	now := now()
+	bat := batch{
+		host:  p.cfg.hostname,
+		start: now,
+		// NB: while this is technically wrong in that it does not
+		// record the actual start and end timestamps for the batch,
+		// it is how the backend understands the client-side
+		// configured CPU profile duration: (start-end).
+		end: now.Add(p.cfg.cpuDuration),
+	}
+
+	for _, t := range types {
+		profs, err := run(t)
+		if err != nil {
+			log.Error("Error getting %s profile: %v; skipping.", t, err)
+			p.cfg.statsd.Count("datadog.profiler.go.collect_error", 1, append(p.cfg.tags, t.Tag()), 1)
+			continue
+		}
+		for _, prof := range profs {
+			bat.addProfile(prof)
+		}
+	}
+	return bat
+}
+
 // enabledProfileTypes returns the enabled profile types in a deterministic
 // order. The CPU profile always comes first because people might spot
 // interesting events in there and then try to look for the counter-part event
 // in the mutex/heap/block profile. Deterministic ordering is also important
-// for delta profiles, otherwise they'd cover varying profiling periods.
+// for delta profiles, otherwise they'd cover varying profiling periods. The
+// custom profile types come last, in their registration order.
 func (p *profiler) enabledProfileTypes() []ProfileType {
 	order := []ProfileType{
 		CPUProfile,
@@ -218,8 +310,10 @@ func (p *profiler) enabledProfileTypes() []ProfileType {
 		MutexProfile,
 		GoroutineProfile,
 		expGoroutineWaitProfile,
+		ExecutionTrace,
 		MetricsProfile,
 	}
+	order = append(order, customProfileTypes()...)
 	enabled := []ProfileType{}
 	for _, t := range order {
 		if _, ok := p.cfg.types[t]; ok {
@@ -229,8 +323,19 @@ func (p *profiler) enabledProfileTypes() []ProfileType {
 	return enabled
 }
 
+// publish makes the given batch available: in pull mode, it is kept in memory
+// to be served by PullHandler, otherwise it is queued for upload.
+func (p *profiler) publish(bat batch) {
+	if p.pull != nil {
+		p.pull.add(bat)
+		return
+	}
+	p.enqueueUpload(bat)
+}
+
 // enqueueUpload pushes a batch of profiles onto the queue to be uploaded. If there is no room, it will
-// evict the oldest profile to make some. Typically a batch would be one of each enabled profile.
+// evict the oldest profile to make some, moving it to the upload spool when enabled. Typically a batch
+// would be one of each enabled profile.
 func (p *profiler) enqueueUpload(bat batch) {
 	for {
 		select {
@@ -239,9 +344,10 @@ func (p *profiler) enqueueUpload(bat batch) {
 		default:
 			// queue is full; evict oldest
 			select {
-			case <-p.out:
+			case evicted := <-p.out:
 				p.cfg.statsd.Count("datadog.profiler.go.queue_full", 1, p.cfg.tags, 1)
 				log.Warn("Evicting one profile batch from the upload queue to make room.")
+				p.spoolBatch(evicted)
 			default:
 				// this case should be almost impossible to trigger, it would require a
 				// full p.out to completely drain within nanoseconds or extreme
@@ -261,9 +367,21 @@ func (p *profiler) send() {
 			if err := p.outputDir(bat); err != nil {
 				log.Error("Failed to output profile to dir: %v", err)
 			}
-			if err := p.uploadFunc(bat); err != nil {
+			up := p.fitBatch(bat)
+			err := p.uploadFunc(up)
+			if err != nil {
 				log.Error("Failed to upload profile: %v", err)
 			}
+			if p.spool == nil {
+				continue
+			}
+			if _, ok := err.(*retriableError); ok {
+				p.spoolBatch(up)
+			} else if err == nil {
+				// The agent or intake is reachable, replay the spooled
+				// batches right away.
+				p.spool.notify()
+			}
 		}
 	}
 }
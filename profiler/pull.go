@@ -0,0 +1,210 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pullStore keeps the last completed batches in memory in pull mode, so that
+// they can be served by PullHandler.
+type pullStore struct {
+	mu      sync.Mutex
+	max     int
+	batches []batch // oldest first
+}
+
+func newPullStore(max int) *pullStore {
+	return &pullStore{max: max}
+}
+
+// add keeps the given batch, evicting the oldest one when full.
+func (s *pullStore) add(bat batch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, bat)
+	if n := len(s.batches); n > s.max {
+		// Let the evicted batches be garbage collected
+		copy(s.batches, s.batches[n-s.max:])
+		for i := s.max; i < n; i++ {
+			s.batches[i] = batch{}
+		}
+		s.batches = s.batches[:s.max]
+	}
+}
+
+// get returns the i-th most recent batch, starting from 0.
+func (s *pullStore) get(i int) (batch, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i < 0 || i >= len(s.batches) {
+		return batch{}, false
+	}
+	return s.batches[len(s.batches)-1-i], true
+}
+
+// all returns the batches, most recent first.
+func (s *pullStore) all() []batch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := make([]batch, len(s.batches))
+	for i, bat := range s.batches {
+		all[len(all)-1-i] = bat
+	}
+	return all
+}
+
+// lookup returns the profile of the batch with the given name, which is its
+// filename with or without its extension, or "profile" for the CPU profile as
+// in net/http/pprof.
+func (b *batch) lookup(name string) (*profile, bool) {
+	if name == "profile" {
+		name = CPUProfile.lookup().Filename
+	}
+	for _, prof := range b.profiles {
+		if prof.name == name || strings.TrimSuffix(prof.name, path.Ext(prof.name)) == name {
+			return prof, true
+		}
+	}
+	return nil, false
+}
+
+// PullHandler returns an http.Handler serving the profiles kept in memory in
+// pull mode, see WithPullMode, so that they can be fetched by scrapers or by
+// go tool pprof. The profile is selected by the last element of the request
+// path, which is the name of the profile file with or without its extension,
+// such as delta-heap or cpu.pprof, or profile for the CPU profile, so that it
+// can be mounted under any prefix:
+//
+//	go tool pprof http://localhost:6060/debug/profiler/delta-heap
+//
+// The most recent batch is served by default, and the older ones can be
+// selected with the batch query parameter (e.g. ?batch=1 for the previous
+// one). The metrics profile can also be served in the OpenMetrics text format
+// with the format=openmetrics query parameter, as gauges timestamped with the
+// end of the batch, for the scrapers of such telemetry:
+//
+//	curl http://localhost:6060/debug/profiler/metrics?format=openmetrics
+//
+// The available batches and profiles are listed when the last element of the
+// path is empty.
+func PullHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		mu.Lock()
+		p := activeProfiler
+		mu.Unlock()
+		if p == nil {
+			http.Error(w, errNotRunning.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if p.pull == nil {
+			http.Error(w, "profiler pull mode is disabled", http.StatusServiceUnavailable)
+			return
+		}
+		name := r.URL.Path
+		if i := strings.LastIndexByte(name, '/'); i >= 0 {
+			name = name[i+1:]
+		}
+		if name == "" {
+			writePullIndex(w, p.pull.all())
+			return
+		}
+		i := 0
+		if v := r.URL.Query().Get("batch"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid batch: %s", v), http.StatusBadRequest)
+				return
+			}
+			i = n
+		}
+		bat, ok := p.pull.get(i)
+		if !ok {
+			http.Error(w, "no such batch", http.StatusNotFound)
+			return
+		}
+		prof, ok := bat.lookup(name)
+		if !ok {
+			http.Error(w, fmt.Sprintf("no %s profile in this batch", name), http.StatusNotFound)
+			return
+		}
+		data := prof.data
+		switch format := r.URL.Query().Get("format"); format {
+		case "":
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, prof.name))
+		case "openmetrics":
+			if prof.name != MetricsProfile.lookup().Filename {
+				http.Error(w, fmt.Sprintf("the openmetrics format isn't available for the %s profile", name), http.StatusBadRequest)
+				return
+			}
+			var buf bytes.Buffer
+			if err := writeOpenMetrics(&buf, bat.end, prof.data); err != nil {
+				http.Error(w, fmt.Sprintf("invalid metrics profile: %v", err), http.StatusInternalServerError)
+				return
+			}
+			data = buf.Bytes()
+			w.Header().Set("Content-Type", openMetricsContentType)
+		default:
+			http.Error(w, fmt.Sprintf("unknown format: %s", format), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Last-Modified", bat.start.Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	})
+}
+
+// writePullIndex lists the given batches and their profiles in plain text.
+func writePullIndex(w http.ResponseWriter, batches []batch) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for i, bat := range batches {
+		fmt.Fprintf(w, "batch=%d start=%s end=%s", i, bat.start.Format(time.RFC3339), bat.end.Format(time.RFC3339))
+		if len(bat.extraTags) > 0 {
+			fmt.Fprintf(w, " tags=%s", strings.Join(bat.extraTags, ","))
+		}
+		fmt.Fprintln(w)
+		for _, prof := range bat.profiles {
+			fmt.Fprintf(w, "\t%s\t%d bytes\n", prof.name, len(prof.data))
+		}
+	}
+}
+
+// openMetricsContentType is the content type of the OpenMetrics text format.
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// writeOpenMetrics writes the points of the given metrics profile data in the
+// OpenMetrics text format, as gauges timestamped with the given time.
+func writeOpenMetrics(w io.Writer, ts time.Time, data []byte) error {
+	var points []point
+	if err := json.Unmarshal(data, &points); err != nil {
+		return err
+	}
+	timestamp := strconv.FormatFloat(float64(ts.UnixNano())/float64(time.Second), 'f', 3, 64)
+	for _, p := range points {
+		fmt.Fprintf(w, "# TYPE %s gauge\n", p.metric)
+		fmt.Fprintf(w, "%s %s %s\n", p.metric, strconv.FormatFloat(p.value, 'g', -1, 64), timestamp)
+	}
+	_, err := io.WriteString(w, "# EOF\n")
+	return err
+}
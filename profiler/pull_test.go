@@ -0,0 +1,162 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pprofile "github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPullStore(t *testing.T) {
+	s := newPullStore(2)
+	_, ok := s.get(0)
+	assert.False(t, ok)
+	for i := 0; i < 3; i++ {
+		s.add(batch{host: string(rune('a' + i))})
+	}
+	bat, ok := s.get(0)
+	require.True(t, ok)
+	assert.Equal(t, "c", bat.host)
+	bat, ok = s.get(1)
+	require.True(t, ok)
+	assert.Equal(t, "b", bat.host)
+	_, ok = s.get(2)
+	assert.False(t, ok)
+	all := s.all()
+	require.Len(t, all, 2)
+	assert.Equal(t, "c", all[0].host)
+	assert.Equal(t, "b", all[1].host)
+}
+
+func TestPullMode(t *testing.T) {
+	t.Run("invalid-config", func(t *testing.T) {
+		_, err := unstartedProfiler(WithPullMode(-1))
+		assert.EqualError(t, err, "invalid pull mode batches, must be >= 0: -1")
+	})
+
+	t.Run("no-upload", func(t *testing.T) {
+		p, err := unstartedProfiler(
+			WithPullMode(2),
+			WithPeriod(10*time.Millisecond),
+			WithProfileTypes(HeapProfile),
+		)
+		require.NoError(t, err)
+		p.uploadFunc = func(batch) error {
+			t.Error("batches shouldn't be uploaded in pull mode")
+			return nil
+		}
+		p.run()
+		require.Eventually(t, func() bool {
+			return len(p.pull.all()) == 2
+		}, 5*time.Second, 10*time.Millisecond)
+		p.stop()
+
+		bat, ok := p.pull.get(0)
+		require.True(t, ok)
+		prof, ok := bat.lookup("delta-heap")
+		require.True(t, ok)
+		assert.Equal(t, "delta-heap.pprof", prof.name)
+		_, err = pprofile.ParseData(prof.data)
+		assert.NoError(t, err)
+	})
+}
+
+func TestPullHandler(t *testing.T) {
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		PullHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	t.Run("method", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		PullHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+
+	t.Run("not-running", func(t *testing.T) {
+		assert.Equal(t, http.StatusServiceUnavailable, get("/debug/profiler/heap").Code)
+	})
+
+	t.Run("pull", func(t *testing.T) {
+		err := Start(
+			WithPullMode(2),
+			WithPeriod(time.Hour),
+			WithProfileTypes(HeapProfile),
+			WithLogStartup(false),
+		)
+		require.NoError(t, err)
+		defer Stop()
+
+		assert.Equal(t, http.StatusNotFound, get("/debug/profiler/heap").Code, "no batch yet")
+		require.NoError(t, CollectNow(context.Background()))
+
+		w := get("/debug/profiler/heap")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, `attachment; filename="heap.pprof"`, w.Header().Get("Content-Disposition"))
+		_, err = pprofile.ParseData(w.Body.Bytes())
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, get("/debug/profiler/heap.pprof?batch=0").Code)
+
+		w = get("/debug/profiler/")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "batch=0")
+		assert.Contains(t, w.Body.String(), "tags="+manualTriggerTag)
+		assert.Contains(t, w.Body.String(), "heap.pprof")
+
+		assert.Equal(t, http.StatusNotFound, get("/debug/profiler/profile").Code, "no cpu profile")
+		assert.Equal(t, http.StatusNotFound, get("/debug/profiler/heap?batch=1").Code)
+		assert.Equal(t, http.StatusBadRequest, get("/debug/profiler/heap?batch=last").Code)
+	})
+
+	t.Run("openmetrics", func(t *testing.T) {
+		err := Start(WithPullMode(2), WithPeriod(time.Hour), WithLogStartup(false))
+		require.NoError(t, err)
+		defer Stop()
+		mu.Lock()
+		p := activeProfiler
+		mu.Unlock()
+		p.pull.add(batch{
+			end: time.Unix(1600000000, 500000000),
+			profiles: []*profile{
+				{name: "metrics.json", data: []byte(`[["go_gcs_per_sec",0.5],["go_heap_live_bytes",1024]]`)},
+				{name: "heap.pprof", data: []byte("heap")},
+			},
+		})
+
+		w := get("/debug/profiler/metrics?format=openmetrics")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, openMetricsContentType, w.Header().Get("Content-Type"))
+		assert.Equal(t, `# TYPE go_gcs_per_sec gauge
+go_gcs_per_sec 0.5 1600000000.500
+# TYPE go_heap_live_bytes gauge
+go_heap_live_bytes 1024 1600000000.500
+# EOF
+`, w.Body.String())
+
+		w = get("/debug/profiler/metrics.json")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `[["go_gcs_per_sec",0.5],["go_heap_live_bytes",1024]]`, w.Body.String())
+		assert.Equal(t, http.StatusBadRequest, get("/debug/profiler/heap?format=openmetrics").Code)
+		assert.Equal(t, http.StatusBadRequest, get("/debug/profiler/metrics?format=xml").Code)
+	})
+
+	t.Run("push-mode", func(t *testing.T) {
+		srv := startHTTPTestServer(t, 200)
+		defer srv.close()
+		err := Start(WithAgentAddr(srv.address), WithPeriod(time.Hour), WithLogStartup(false))
+		require.NoError(t, err)
+		defer Stop()
+		assert.Equal(t, http.StatusServiceUnavailable, get("/debug/profiler/heap").Code)
+	})
+}
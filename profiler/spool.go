@@ -0,0 +1,294 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/internal/log"
+)
+
+// spoolFileExt is the file extension of the batches stored in the spool
+// directory.
+const spoolFileExt = ".batch"
+
+// Bounds of the backoff between two attempts to replay the spooled batches
+// while the upload keeps failing. Replaced in tests.
+var (
+	spoolMinBackoff = time.Second
+	spoolMaxBackoff = 5 * time.Minute
+)
+
+// spool is a disk-backed queue of the batches which could not be uploaded,
+// so that they are replayed once the agent or intake is reachable again. It
+// is bounded by a size in bytes, evicting the oldest batches to make room
+// for the new ones. It is safe for concurrent use.
+type spool struct {
+	dir      string
+	maxBytes int64
+
+	mu    sync.Mutex
+	files []spoolFile // spooled batches, oldest first
+	size  int64       // total size of the files
+	seq   uint64      // sequence number of the next file, making names unique
+
+	// wake is notified when the replay should be attempted without waiting
+	// for the backoff, e.g. after a successful upload.
+	wake chan struct{}
+}
+
+// spoolFile is a batch file stored in the spool directory.
+type spoolFile struct {
+	name string
+	size int64
+}
+
+// spooledBatch is the on-disk representation of a batch.
+type spooledBatch struct {
+	Start, End time.Time
+	Host       string
+	Profiles   []spooledProfile
+	ExtraTags  []string
+}
+
+// spooledProfile is the on-disk representation of a profile.
+type spooledProfile struct {
+	Name string
+	Data []byte
+}
+
+// openSpool opens the spool stored in the given directory, creating it if
+// needed. The batches left by a previous run are kept to be replayed.
+func openSpool(dir string, maxBytes int64) (*spool, error) {
+	// 0755 is what mkdir does, should be reasonable for the use cases here.
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &spool{dir: dir, maxBytes: maxBytes, wake: make(chan struct{}, 1)}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), spoolFileExt) {
+			continue
+		}
+		s.files = append(s.files, spoolFile{name: e.Name(), size: e.Size()})
+		s.size += e.Size()
+	}
+	// The file names start with the zero-padded batch end time
+	sort.Slice(s.files, func(i, j int) bool { return s.files[i].name < s.files[j].name })
+	return s, nil
+}
+
+// push stores the given batch into the spool, evicting the oldest batches
+// when the size limit is reached. It returns the number of evicted batches.
+func (s *spool) push(bat batch) (evicted int, err error) {
+	sb := spooledBatch{Start: bat.start, End: bat.end, Host: bat.host, ExtraTags: bat.extraTags}
+	for _, p := range bat.profiles {
+		sb.Profiles = append(sb.Profiles, spooledProfile{Name: p.name, Data: p.data})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Write into a temporary file first so that a partially written batch is
+	// never replayed.
+	f, err := ioutil.TempFile(s.dir, "tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	if err := gob.NewEncoder(f).Encode(sb); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return 0, err
+	}
+	info, err := f.Stat()
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		return 0, err
+	}
+	if info.Size() > s.maxBytes {
+		os.Remove(f.Name())
+		return 0, fmt.Errorf("batch of %d bytes exceeds the spool size limit of %d bytes", info.Size(), s.maxBytes)
+	}
+	for len(s.files) > 0 && s.size+info.Size() > s.maxBytes {
+		s.removeLocked(s.files[0].name)
+		evicted++
+	}
+	name := fmt.Sprintf("%020d-%06d%s", bat.end.UnixNano(), s.seq%1e6, spoolFileExt)
+	s.seq++
+	if err := os.Rename(f.Name(), filepath.Join(s.dir, name)); err != nil {
+		os.Remove(f.Name())
+		return evicted, err
+	}
+	s.files = append(s.files, spoolFile{name: name, size: info.Size()})
+	sort.Slice(s.files, func(i, j int) bool { return s.files[i].name < s.files[j].name })
+	s.size += info.Size()
+	return evicted, nil
+}
+
+// oldest returns the oldest spooled batch along with its file name, or false
+// when the spool is empty. The batches which can no longer be read are
+// removed.
+func (s *spool) oldest() (bat batch, name string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.files) > 0 {
+		name = s.files[0].name
+		f, err := os.Open(filepath.Join(s.dir, name))
+		if err != nil {
+			log.Warn("Removing unreadable spooled profile batch %s: %v", name, err)
+			s.removeLocked(name)
+			continue
+		}
+		var sb spooledBatch
+		err = gob.NewDecoder(f).Decode(&sb)
+		f.Close()
+		if err != nil {
+			log.Warn("Removing invalid spooled profile batch %s: %v", name, err)
+			s.removeLocked(name)
+			continue
+		}
+		bat = batch{start: sb.Start, end: sb.End, host: sb.Host, extraTags: sb.ExtraTags}
+		for _, p := range sb.Profiles {
+			bat.addProfile(&profile{name: p.Name, data: p.Data})
+		}
+		return bat, name, true
+	}
+	return batch{}, "", false
+}
+
+// remove removes the given batch file from the spool.
+func (s *spool) remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeLocked(name)
+}
+
+// removeLocked removes the given batch file from the spool. s.mu must be
+// held.
+func (s *spool) removeLocked(name string) {
+	for i, f := range s.files {
+		if f.name != name {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !os.IsNotExist(err) {
+			log.Warn("Failed to remove spooled profile batch %s: %v", name, err)
+		}
+		s.files = append(s.files[:i], s.files[i+1:]...)
+		s.size -= f.size
+		return
+	}
+}
+
+// stats returns the number of spooled batches and their total size in bytes.
+func (s *spool) stats() (batches int, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.files), s.size
+}
+
+// notify wakes the replay up without waiting for its backoff.
+func (s *spool) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// spoolBatch stores the given batch into the spool, when enabled, so that it
+// gets uploaded later.
+func (p *profiler) spoolBatch(bat batch) {
+	if p.spool == nil {
+		return
+	}
+	evicted, err := p.spool.push(bat)
+	if evicted > 0 {
+		p.cfg.statsd.Count("datadog.profiler.go.spool_evicted", int64(evicted), p.cfg.tags, 1)
+		log.Warn("Evicted %d profile batches from the upload spool to make room.", evicted)
+	}
+	if err != nil {
+		p.cfg.statsd.Count("datadog.profiler.go.spool_error", 1, p.cfg.tags, 1)
+		log.Error("Failed to spool profile batch: %v", err)
+	}
+	p.reportSpoolSize()
+}
+
+// replaySpool uploads the spooled batches, oldest first, until the profiler
+// stops. While the upload keeps failing, it waits between two attempts with
+// an exponential backoff and jitter.
+func (p *profiler) replaySpool() {
+	p.reportSpoolSize()
+	// The spool is polled every spoolMinBackoff while empty
+	backoff := spoolMinBackoff
+	for {
+		bat, name, ok := p.spool.oldest()
+		if ok {
+			// The batches evicted from the upload queue are spooled as
+			// collected
+			err := p.uploadFunc(p.fitBatch(bat))
+			select {
+			case <-p.exit:
+				// The upload was interrupted, keep the batch for the next run
+				return
+			default:
+			}
+			if _, retriable := err.(*retriableError); !retriable {
+				if err != nil {
+					log.Error("Failed to upload spooled profile batch, dropping it: %v", err)
+				}
+				p.spool.remove(name)
+				p.reportSpoolSize()
+				backoff = spoolMinBackoff
+				continue
+			}
+			log.Warn("Failed to upload spooled profile batch: %v. Trying again later.", err)
+		}
+		// Wait between half and the full backoff, so that the profilers spooling
+		// during the same outage don't replay at the same time.
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		if ok {
+			if backoff *= 2; backoff > spoolMaxBackoff {
+				backoff = spoolMaxBackoff
+			}
+		}
+		select {
+		case <-p.exit:
+			return
+		case <-p.spool.wake:
+			backoff = spoolMinBackoff
+		case <-time.After(wait):
+		}
+	}
+}
+
+// reportSpoolSize reports the spool size as statsd gauges, when the statsd
+// client supports them.
+func (p *profiler) reportSpoolSize() {
+	g, ok := p.cfg.statsd.(statsdGauge)
+	if !ok {
+		return
+	}
+	batches, size := p.spool.stats()
+	g.Gauge("datadog.profiler.go.spool_batches", float64(batches), p.cfg.tags, 1)
+	g.Gauge("datadog.profiler.go.spool_bytes", float64(size), p.cfg.tags, 1)
+}
+
+// statsdGauge is implemented by the statsd clients able to send gauges, such
+// as the datadog-go one.
+type statsdGauge interface {
+	Gauge(name string, value float64, tags []string, rate float64) error
+}
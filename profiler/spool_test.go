@@ -0,0 +1,196 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func spoolTestBatch(end time.Time, data string) batch {
+	bat := batch{start: end.Add(-time.Minute), end: end, host: "my-host"}
+	bat.addProfile(&profile{name: "cpu.pprof", data: []byte(data)})
+	return bat
+}
+
+func TestSpool(t *testing.T) {
+	t.Run("push-oldest-remove", func(t *testing.T) {
+		s, err := openSpool(t.TempDir(), 1024*1024)
+		require.NoError(t, err)
+		_, _, ok := s.oldest()
+		assert.False(t, ok)
+
+		start := now()
+		for i, data := range []string{"second", "first", "third"} {
+			end := start.Add(time.Duration(i) * time.Minute)
+			if data == "first" {
+				end = start.Add(-time.Minute)
+			}
+			evicted, err := s.push(spoolTestBatch(end, data))
+			require.NoError(t, err)
+			assert.Zero(t, evicted)
+		}
+		batches, size := s.stats()
+		assert.Equal(t, 3, batches)
+		assert.NotZero(t, size)
+
+		for _, want := range []string{"first", "second", "third"} {
+			bat, name, ok := s.oldest()
+			require.True(t, ok)
+			assert.Equal(t, "my-host", bat.host)
+			require.Len(t, bat.profiles, 1)
+			assert.Equal(t, "cpu.pprof", bat.profiles[0].name)
+			assert.Equal(t, want, string(bat.profiles[0].data))
+			s.remove(name)
+		}
+		batches, size = s.stats()
+		assert.Zero(t, batches)
+		assert.Zero(t, size)
+	})
+
+	t.Run("reopen", func(t *testing.T) {
+		dir := t.TempDir()
+		s, err := openSpool(dir, 1024*1024)
+		require.NoError(t, err)
+		end := now()
+		_, err = s.push(spoolTestBatch(end, "data"))
+		require.NoError(t, err)
+		// Leftovers of an interrupted push are ignored
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "tmp-123"), []byte("partial"), 0644))
+
+		s, err = openSpool(dir, 1024*1024)
+		require.NoError(t, err)
+		bat, _, ok := s.oldest()
+		require.True(t, ok)
+		assert.True(t, end.Equal(bat.end))
+		assert.Equal(t, "data", string(bat.profiles[0].data))
+	})
+
+	t.Run("size-limit", func(t *testing.T) {
+		dir := t.TempDir()
+		s, err := openSpool(dir, 1024*1024)
+		require.NoError(t, err)
+		_, err = s.push(spoolTestBatch(now(), "data"))
+		require.NoError(t, err)
+		_, size := s.stats()
+
+		// Room for two batches
+		s, err = openSpool(dir, 2*size)
+		require.NoError(t, err)
+		start := now().Add(time.Minute)
+		for i := 0; i < 2; i++ {
+			evicted, err := s.push(spoolTestBatch(start.Add(time.Duration(i)*time.Minute), "data"))
+			require.NoError(t, err)
+			assert.Equal(t, i, evicted)
+		}
+		batches, _ := s.stats()
+		assert.Equal(t, 2, batches)
+		bat, _, ok := s.oldest()
+		require.True(t, ok)
+		assert.True(t, start.Equal(bat.end), "the oldest batch should have been evicted")
+
+		_, err = s.push(spoolTestBatch(now(), string(make([]byte, 2*size))))
+		assert.Error(t, err, "batches larger than the spool should be rejected")
+		batches, _ = s.stats()
+		assert.Equal(t, 2, batches)
+	})
+
+	t.Run("invalid-file", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "0"+spoolFileExt), []byte("invalid"), 0644))
+		s, err := openSpool(dir, 1024*1024)
+		require.NoError(t, err)
+		_, _, ok := s.oldest()
+		assert.False(t, ok)
+		_, err = os.Stat(filepath.Join(dir, "0"+spoolFileExt))
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+// gaugeStatsd is a statsd client recording the last value of its gauges.
+type gaugeStatsd struct {
+	mu     sync.Mutex
+	gauges map[string]float64
+}
+
+func (s *gaugeStatsd) Count(_ string, _ int64, _ []string, _ float64) error          { return nil }
+func (s *gaugeStatsd) Timing(_ string, _ time.Duration, _ []string, _ float64) error { return nil }
+
+func (s *gaugeStatsd) Gauge(name string, value float64, _ []string, _ float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gauges == nil {
+		s.gauges = make(map[string]float64)
+	}
+	s.gauges[name] = value
+	return nil
+}
+
+func (s *gaugeStatsd) gauge(name string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gauges[name]
+}
+
+func TestSpoolReplay(t *testing.T) {
+	defer func(min, max time.Duration) {
+		spoolMinBackoff, spoolMaxBackoff = min, max
+	}(spoolMinBackoff, spoolMaxBackoff)
+	spoolMinBackoff, spoolMaxBackoff = time.Millisecond, 10*time.Millisecond
+
+	var stats gaugeStatsd
+	p, err := unstartedProfiler(
+		WithUploadSpool(t.TempDir(), 1024*1024),
+		WithStatsd(&stats),
+		WithPeriod(10*time.Millisecond),
+		CPUDuration(time.Millisecond),
+		WithProfileTypes(),
+	)
+	require.NoError(t, err)
+
+	var (
+		mu       sync.Mutex
+		outage   = true
+		uploaded []batch
+	)
+	p.uploadFunc = func(bat batch) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if outage {
+			return &retriableError{errors.New("agent unreachable")}
+		}
+		uploaded = append(uploaded, bat)
+		return nil
+	}
+	p.run()
+	defer p.stop()
+
+	// The batches failing to upload during the outage are spooled
+	require.Eventually(t, func() bool {
+		return stats.gauge("datadog.profiler.go.spool_batches") >= 3
+	}, 5*time.Second, time.Millisecond)
+
+	mu.Lock()
+	outage = false
+	mu.Unlock()
+
+	require.Eventually(t, func() bool {
+		return stats.gauge("datadog.profiler.go.spool_batches") == 0
+	}, 5*time.Second, time.Millisecond)
+	assert.Zero(t, stats.gauge("datadog.profiler.go.spool_bytes"))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.True(t, len(uploaded) >= 3)
+}
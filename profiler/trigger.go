@@ -0,0 +1,133 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// manualTriggerTag is the tag of the batches collected on demand.
+const manualTriggerTag = "trigger:manual"
+
+// errNotRunning is returned when collecting profiles on demand while the
+// profiler is not running.
+var errNotRunning = errors.New("profiler is not running")
+
+// CollectNow immediately collects a batch of profiles of the given types, or
+// of the enabled ones when none are given, and queues it for upload with the
+// trigger:manual tag, or keeps it in memory in pull mode. It is meant to be used when an incident is ongoing, in
+// addition to the periodic collection. The profiles are collected out of
+// band: the delta profiles are not computed so that the baselines of the
+// periodic delta profiles are left untouched, and the metrics profile and the
+// execution trace, which are bound to the profiling period, are not
+// supported. As profiles can't be collected concurrently, it waits for the
+// ongoing periodic collection, if any, for as long as the context allows it.
+// It returns once the batch is queued for upload or kept, which can take the
+// CPU profile duration.
+func CollectNow(ctx context.Context, types ...ProfileType) error {
+	mu.Lock()
+	p := activeProfiler
+	mu.Unlock()
+	if p == nil {
+		return errNotRunning
+	}
+	return p.collectNow(ctx, types)
+}
+
+// collectNow collects and queues for upload a batch of profiles of the given
+// types, or of the enabled ones when none are given.
+func (p *profiler) collectNow(ctx context.Context, types []ProfileType) error {
+	if len(types) == 0 {
+		for _, t := range p.enabledProfileTypes() {
+			if onDemand(t) {
+				types = append(types, t)
+			}
+		}
+	}
+	for _, t := range types {
+		if !onDemand(t) {
+			return fmt.Errorf("%s profiles can't be collected on demand", t)
+		}
+	}
+
+	select {
+	case p.collecting <- struct{}{}:
+	case <-p.exit:
+		return errNotRunning
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-p.collecting }()
+	select {
+	case <-p.exit:
+		return errNotRunning
+	default:
+	}
+	bat := p.collectBatch(types, p.runProfileOnDemand)
+	bat.extraTags = []string{manualTriggerTag}
+	p.publish(bat)
+	return nil
+}
+
+// onDemand returns true when the given profile type can be collected on
+// demand.
+func onDemand(t ProfileType) bool {
+	return t != MetricsProfile && t != ExecutionTrace
+}
+
+// runProfileOnDemand collects the given profile type out of band, without its
+// delta profile.
+func (p *profiler) runProfileOnDemand(pt ProfileType) ([]*profile, error) {
+	start := now()
+	t := pt.lookup()
+	data, err := t.Collect(t, p)
+	p.overhead.collected(now().Sub(start))
+	if err != nil {
+		return nil, err
+	}
+	p.cfg.statsd.Timing("datadog.profiler.go.collect_time", now().Sub(start), append(p.cfg.tags, pt.Tag(), manualTriggerTag), 1)
+	return []*profile{{name: t.Filename, data: data}}, nil
+}
+
+// TriggerHandler returns an http.Handler collecting profiles on demand with
+// CollectNow when receiving POST requests, so that operators can mount it on
+// an internal endpoint. The profile types can be selected with the types
+// query parameter, as a comma-separated list of profile type names (e.g.
+// ?types=cpu,heap), and default to the enabled ones. The request returns
+// once the profiles are queued for upload.
+func TriggerHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var types []ProfileType
+		if v := r.URL.Query().Get("types"); v != "" {
+			for _, name := range strings.Split(v, ",") {
+				t, ok := profileTypeByName(strings.TrimSpace(name))
+				if !ok {
+					http.Error(w, fmt.Sprintf("unknown profile type: %s", name), http.StatusBadRequest)
+					return
+				}
+				types = append(types, t)
+			}
+		}
+		switch err := CollectNow(r.Context(), types...); {
+		case err == errNotRunning || err == context.Canceled || err == context.DeadlineExceeded:
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintln(w, "profiles collected and queued for upload")
+		}
+	})
+}
@@ -0,0 +1,116 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2016 Datadog, Inc.
+
+package profiler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectNow(t *testing.T) {
+	t.Run("not-running", func(t *testing.T) {
+		assert.Equal(t, errNotRunning, CollectNow(context.Background()))
+	})
+
+	t.Run("out-of-band", func(t *testing.T) {
+		p, err := unstartedProfiler(
+			WithPeriod(time.Hour),
+			CPUDuration(10*time.Millisecond),
+			WithProfileTypes(CPUProfile, HeapProfile),
+		)
+		require.NoError(t, err)
+		uploaded := make(chan batch, 1)
+		p.uploadFunc = func(bat batch) error {
+			uploaded <- bat
+			return nil
+		}
+		p.run()
+		defer p.stop()
+
+		require.NoError(t, p.collectNow(context.Background(), nil))
+		var bat batch
+		select {
+		case bat = <-uploaded:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+		assert.Equal(t, []string{manualTriggerTag}, bat.extraTags)
+		var names []string
+		for _, prof := range bat.profiles {
+			names = append(names, prof.name)
+		}
+		// The metrics profile isn't collected, and neither are the delta
+		// profiles
+		assert.Equal(t, []string{"cpu.pprof", "heap.pprof"}, names)
+		assert.Empty(t, p.prev, "the delta profile baselines should be left untouched")
+	})
+
+	t.Run("unsupported-type", func(t *testing.T) {
+		p, err := unstartedProfiler()
+		require.NoError(t, err)
+		err = p.collectNow(context.Background(), []ProfileType{MetricsProfile})
+		assert.EqualError(t, err, "metrics profiles can't be collected on demand")
+	})
+
+	t.Run("busy", func(t *testing.T) {
+		p, err := unstartedProfiler()
+		require.NoError(t, err)
+		// Another collection is ongoing
+		p.collecting <- struct{}{}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.Equal(t, context.DeadlineExceeded, p.collectNow(ctx, []ProfileType{HeapProfile}))
+	})
+}
+
+func TestTriggerHandler(t *testing.T) {
+	post := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		TriggerHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, url, nil))
+		return w
+	}
+
+	t.Run("method", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		TriggerHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+
+	t.Run("not-running", func(t *testing.T) {
+		assert.Equal(t, http.StatusServiceUnavailable, post("/").Code)
+	})
+
+	t.Run("upload", func(t *testing.T) {
+		srv := startHTTPTestServer(t, 200)
+		defer srv.close()
+		err := Start(
+			WithAgentAddr(srv.address),
+			WithPeriod(time.Hour),
+			WithProfileTypes(HeapProfile),
+			WithLogStartup(false),
+		)
+		require.NoError(t, err)
+		defer Stop()
+
+		assert.Equal(t, http.StatusBadRequest, post("/?types=heap,unknown").Code)
+		assert.Equal(t, http.StatusBadRequest, post("/?types=metrics").Code)
+		w := post("/?types=heap,goroutine")
+		assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+		_, fields, tags := srv.wait()
+		assert.Contains(t, tags, manualTriggerTag)
+		assert.Contains(t, fields, "data[heap.pprof]")
+		assert.Contains(t, fields, "data[goroutines.pprof]")
+		assert.NotContains(t, fields, "data[delta-heap.pprof]")
+		assert.NotContains(t, fields, "data[metrics.json]")
+	})
+}
@@ -56,7 +56,7 @@ func (p *profiler) upload(bat batch) error {
 		}
 		return err
 	}
-	return fmt.Errorf("failed after %d retries, last error was: %v", maxRetries, err)
+	return &retriableError{fmt.Errorf("failed after %d retries, last error was: %v", maxRetries, err)}
 }
 
 // retriableError is an error returned by the server which may be retried at a later time.
@@ -68,10 +68,13 @@ func (e retriableError) Error() string { return e.err.Error() }
 // doRequest makes an HTTP POST request to the Datadog Profiling API with the
 // given profile.
 func (p *profiler) doRequest(bat batch) error {
-	tags := append(p.cfg.tags,
+	// Copy the tags as batches can be uploaded concurrently when the upload
+	// spool is enabled.
+	tags := append(append([]string(nil), p.cfg.tags...),
 		fmt.Sprintf("service:%s", p.cfg.service),
 		fmt.Sprintf("env:%s", p.cfg.env),
 	)
+	tags = append(tags, bat.extraTags...)
 	contentType, body, err := encode(bat, tags)
 	if err != nil {
 		return err